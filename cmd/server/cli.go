@@ -0,0 +1,413 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/lint"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/ruletest"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+)
+
+// runCommand runs a CLI subcommand (mockingbird <command> ...) and returns the exit code
+func runCommand(args []string) int {
+	switch args[0] {
+	case "export":
+		return runExport(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "har":
+		return runHAR(args[1:])
+	case "import-har":
+		return runImportHAR(args[1:])
+	case "lint":
+		return runLint(args[1:])
+	case "test":
+		return runTest(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `Usage:
+  mockingbird                                  Start the proxy and admin servers
+  mockingbird export <workspace> [-o file] [-traffic]
+  mockingbird import <file> [-name workspace] [-on-conflict fail|rename|overwrite] [-no-traffic]
+  mockingbird har <workspace> [-o file] [-service name] [-q query] [-limit n]
+  mockingbird import-har <file> [-workspace name] [-mode rules|traffic] [-group-by host|path]
+  mockingbird lint <workspace> [-service name]
+  mockingbird test <workspace> [-service name] [-v]`)
+}
+
+// openWorkspaceManager loads config and opens the workspace manager for a CLI command
+// (without the server's background work, and refusing workspaces that don't exist)
+func openWorkspaceManager() (*store.WorkspaceManager, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return store.NewCLIWorkspaceManager(cfg.ConfigDir, cfg)
+}
+
+// parseFlags parses flags that may appear before or after the positional argument
+func parseFlags(fs *flag.FlagSet, args []string) (string, error) {
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("expected exactly one argument, got %d", len(positional))
+	}
+	return positional[0], nil
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "", "Output file (default <workspace>.mockingbird.zip)")
+	traffic := fs.Bool("traffic", false, "Include traffic history")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+	if *output == "" {
+		*output = name + ".mockingbird.zip"
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if err := wm.ExportWorkspace(name, f, store.ExportOptions{IncludeTraffic: *traffic}); err != nil {
+		f.Close()
+		os.Remove(*output)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Exported workspace '%s' to %s\n", name, *output)
+	return 0
+}
+
+func runHAR(args []string) int {
+	fs := flag.NewFlagSet("har", flag.ContinueOnError)
+	output := fs.String("o", "", "Output file (default <workspace>.har)")
+	service := fs.String("service", "", "Only export this service's traffic")
+	search := fs.String("q", "", "Only export traffic matching this search query")
+	limit := fs.Int("limit", 0, "Only export the newest N matching entries (0 for all)")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+	q, err := query.Parse(*search, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid query: %v\n", err)
+		return 2
+	}
+	if *output == "" {
+		*output = name + ".har"
+		if *service != "" {
+			*output = name + "-" + *service + ".har"
+		}
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	count, err := wm.ExportHAR(name, f, store.HARExportOptions{Service: *service, Query: q, Limit: *limit})
+	if err != nil {
+		f.Close()
+		os.Remove(*output)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Exported %d traffic entries from '%s' to %s\n", count, name, *output)
+	return 0
+}
+
+func runImportHAR(args []string) int {
+	fs := flag.NewFlagSet("import-har", flag.ContinueOnError)
+	workspace := fs.String("workspace", "default", "Workspace to import into")
+	mode := fs.String("mode", store.HARImportRules, "Import as mock rules (rules) or as traffic history (traffic)")
+	groupBy := fs.String("group-by", "host", "Service per host (host) or per first path segment (path)")
+
+	file, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	result, err := wm.ImportHAR(*workspace, data, store.HARImportOptions{Mode: *mode, GroupBy: *groupBy})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	for _, skipped := range result.Skipped {
+		fmt.Printf("  skipped entry %d (%s): %s\n", skipped.Index, skipped.URL, skipped.Reason)
+	}
+	services := strings.Join(result.Services, ", ")
+	if result.Mode == store.HARImportTraffic {
+		fmt.Printf("Imported %d traffic entries into '%s' (%s)\n", result.TrafficAdded, result.Workspace, services)
+	} else {
+		fmt.Printf("Added %d rules to '%s' (%s), %d duplicates skipped\n", result.RulesAdded, result.Workspace, services, result.Duplicates)
+	}
+	return 0
+}
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	name := fs.String("name", "", "Workspace name (default: the exported name)")
+	onConflict := fs.String("on-conflict", "fail", "What to do if the workspace exists: fail, rename or overwrite")
+	noTraffic := fs.Bool("no-traffic", false, "Skip traffic history in the bundle")
+
+	file, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	result, err := wm.ImportWorkspace(f, info.Size(), store.ImportOptions{
+		Name:        *name,
+		OnConflict:  *onConflict,
+		SkipTraffic: *noTraffic,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Imported workspace '%s' (%d services)\n", result.Name, len(result.Services))
+	for _, warning := range result.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	if len(result.MissingConfigKeys) > 0 {
+		fmt.Printf("Missing config keys (set them in config.json or the dashboard): %s\n", strings.Join(result.MissingConfigKeys, ", "))
+	}
+	return 0
+}
+
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	service := fs.String("service", "", "Only check this service")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	st, err := wm.GetStore(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var services map[string][]lint.Issue
+	if *service != "" {
+		services = map[string][]lint.Issue{*service: st.LintService(*service)}
+	} else {
+		services = st.LintAll()
+	}
+
+	names := make([]string, 0, len(services))
+	for svc := range services {
+		names = append(names, svc)
+	}
+	sort.Strings(names)
+
+	count := 0
+	for _, svc := range names {
+		for _, issue := range services[svc] {
+			location := fmt.Sprintf("%s[%d]", svc, issue.Index)
+			if issue.Origin != "" && issue.Origin != store.OriginService {
+				location = fmt.Sprintf("%s (%s[%d])", svc, issue.Origin, issue.Index)
+			}
+			fmt.Printf("%s %s %s: %s\n", location, issue.Severity, issue.Code, issue.Message)
+			count++
+		}
+	}
+
+	if count > 0 {
+		fmt.Printf("%d issue(s) found in workspace '%s'\n", count, name)
+		return 1
+	}
+	fmt.Printf("No issues found in workspace '%s'\n", name)
+	return 0
+}
+
+func runTest(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	service := fs.String("service", "", "Only run this service's examples")
+	verbose := fs.Bool("v", false, "Also show passing examples and rendered responses")
+
+	name, err := parseFlags(fs, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printUsage()
+		return 2
+	}
+
+	wm, err := openWorkspaceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer wm.Close()
+
+	st, err := wm.GetStore(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var services map[string][]ruletest.Result
+	if *service != "" {
+		services = map[string][]ruletest.Result{*service: st.TestService(*service)}
+	} else {
+		services = st.TestAll()
+	}
+
+	names := make([]string, 0, len(services))
+	for svc := range services {
+		names = append(names, svc)
+	}
+	sort.Strings(names)
+
+	var all []ruletest.Result
+	for _, svc := range names {
+		for _, result := range services[svc] {
+			all = append(all, result)
+
+			status := "PASS"
+			switch {
+			case result.Skipped:
+				status = "SKIP"
+			case !result.Passed:
+				status = "FAIL"
+			}
+			if status == "PASS" && !*verbose {
+				continue
+			}
+
+			method := result.Request.Method
+			if method == "" {
+				method = "GET"
+			}
+			line := fmt.Sprintf("%s %s[%d] example %d: %s %s", status, svc, result.Index, result.Example, method, result.Request.Path)
+			if result.Request.NoMatch {
+				line += " (noMatch)"
+			}
+			if result.Error != "" {
+				line += " - " + result.Error
+			}
+			fmt.Println(line)
+
+			if *verbose && result.Response != nil {
+				fmt.Printf("    -> [%d] %s\n", result.Response.StatusCode, result.Response.Body)
+			} else if *verbose && result.ProxyTo != "" {
+				fmt.Printf("    -> proxy %s\n", result.ProxyTo)
+			}
+		}
+	}
+
+	summary := ruletest.Summarize(all)
+	fmt.Printf("%d passed, %d failed, %d skipped\n", summary.Passed, summary.Failed, summary.Skipped)
+	if summary.Failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -26,6 +26,11 @@ var (
 )
 
 func main() {
+	// Subcommands (export, import, ...) run and exit without starting the servers
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	fmt.Println("🐦 Mockingbird - Starting...")
 
 	// Load configuration
@@ -62,8 +67,8 @@ func main() {
 	// Create proxy handler
 	proxyHandler := proxy.NewHandler(cfg, workspaceManager, pluginManager)
 
-	// Create admin API
-	adminAPI := admin.NewAPI(cfg, workspaceManager, pluginManager)
+	// Create admin API (it uses the proxy handler to simulate requests)
+	adminAPI := admin.NewAPI(cfg, workspaceManager, pluginManager, proxyHandler)
 
 	// Create HTTP servers
 	proxyServer := &http.Server{
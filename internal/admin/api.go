@@ -1,7 +1,11 @@
 package admin
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -13,27 +17,38 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
-	"github.com/theproductiveprogrammer/mockingbird.git/internal/dsl"
-	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/diff"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/plugin"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/proxy"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/ruletest"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/verify"
 )
 
+// maxBundleSize limits the size of an uploaded workspace bundle
+const maxBundleSize = 64 << 20
+
+// maxHARSize limits the size of an uploaded HAR file
+const maxHARSize = 64 << 20
+
 // API provides the admin REST API
 type API struct {
 	config           *config.Config
 	workspaceManager *store.WorkspaceManager
 	pluginManager    *plugin.Manager
+	proxyHandler     *proxy.Handler // Used to simulate requests without sending them
 	router           chi.Router
 }
 
 // NewAPI creates a new admin API
-func NewAPI(cfg *config.Config, wm *store.WorkspaceManager, pm *plugin.Manager) *API {
+func NewAPI(cfg *config.Config, wm *store.WorkspaceManager, pm *plugin.Manager, ph *proxy.Handler) *API {
 	api := &API{
 		config:           cfg,
 		workspaceManager: wm,
 		pluginManager:    pm,
+		proxyHandler:     ph,
 		router:           chi.NewRouter(),
 	}
 
@@ -57,29 +72,93 @@ func (a *API) setupRoutes() {
 	r.Route("/api/workspaces", func(r chi.Router) {
 		r.Get("/", a.handleGetWorkspaces)
 		r.Post("/", a.handleCreateWorkspace)
+		r.Post("/ephemeral", a.handleCreateEphemeralWorkspace)
+		r.Post("/import", a.handleImportWorkspace)
+		r.Delete("/ephemeral/{name}", a.handleTeardownWorkspace)
 		r.Delete("/{name}", a.handleDisableWorkspace)
 		r.Post("/{name}/enable", a.handleEnableWorkspace)
 		r.Post("/{name}/duplicate", a.handleDuplicateWorkspace)
+		r.Get("/{name}/chain", a.handleGetWorkspaceChain)
+		r.Put("/{name}/parent", a.handleSetWorkspaceParent)
+		r.Get("/{name}/retention", a.handleGetWorkspaceRetention)
+		r.Put("/{name}/retention", a.handleSetWorkspaceRetention)
+		r.Get("/{name}/export", a.handleExportWorkspace)
+		r.Post("/{name}/rename", a.handleRenameWorkspace)
+		r.Delete("/{name}/permanent", a.handleDeleteWorkspace)
+	})
+
+	// Archive: disabled workspaces and services
+	r.Route("/api/archive", func(r chi.Router) {
+		r.Get("/", a.handleGetArchive)
+		r.Post("/workspaces/{name}/restore", a.handleEnableWorkspace)
+		r.Delete("/workspaces/{name}", a.handlePurgeDisabledWorkspace)
+		r.Post("/services/{workspace}/{file}/restore", a.handleRestoreService)
+		r.Delete("/services/{workspace}/{file}", a.handlePurgeDisabledService)
 	})
 
+	// Shared rule library (services pull these in with include:)
+	r.Get("/api/library", a.handleGetLibrary)
+	r.Get("/api/library/{name}", a.handleGetLibraryRules)
+
+	// Rule and workspace change events (all workspaces)
+	r.Get("/api/events", a.handleEventStream)
+
+	// Host header based routing table (root-level, applies to all workspaces)
+	r.Get("/api/host-routes", a.handleGetHostRoutes)
+	r.Put("/api/host-routes", a.handleSetHostRoutes)
+
+	// Workspace selectors (header / cookie / query param) for proxy requests
+	r.Get("/api/workspace-selectors", a.handleGetWorkspaceSelectors)
+	r.Put("/api/workspace-selectors", a.handleSetWorkspaceSelectors)
+
 	// Workspace-specific API routes: /api/w/{workspace}/...
 	r.Route("/api/w/{workspace}", func(r chi.Router) {
 		// Traffic
 		r.Get("/traffic", a.handleGetTraffic)
 		r.Get("/traffic/stream", a.handleTrafficStream)
+		r.Get("/traffic/search", a.handleSearchTraffic)
+		r.Get("/traffic/har", a.handleExportHAR)
+		r.Post("/import/har", a.handleImportHAR)
 		r.Get("/traffic/{id}", a.handleGetTrafficByID)
+		r.Post("/verify", a.handleVerify)
 		r.Post("/traffic/{id}/generate-rule", a.handleGenerateRule)
 
+		// Change events for this workspace
+		r.Get("/events", a.handleWorkspaceEventStream)
+
 		// Rules
 		r.Get("/rules", a.handleGetAllRules)
+		r.Get("/lint", a.handleLintRules)
+		r.Get("/test", a.handleTestRules)
+		r.Post("/simulate", a.handleSimulate)
 		r.Get("/rules/{service}", a.handleGetServiceRules)
 		r.Get("/rules/{service}/raw", a.handleGetRawRules)
+		r.Get("/rules/{service}/lint", a.handleLintServiceRules)
+		r.Get("/rules/{service}/test", a.handleTestServiceRules)
 		r.Post("/rules/{service}", a.handleCreateRule)
 		r.Put("/rules/{service}/{index}", a.handleUpdateRule)
 		r.Delete("/rules/{service}/{index}", a.handleDeleteRule)
 		r.Post("/rules/{service}/{index}/move", a.handleMoveRule)
+		r.Get("/rules/{service}/history", a.handleGetRuleHistory)
+		r.Get("/rules/{service}/history/diff", a.handleDiffRuleHistory)
+		r.Get("/rules/{service}/history/{version}", a.handleGetRuleVersion)
+		r.Post("/rules/{service}/history/{version}/rollback", a.handleRollbackRules)
+		r.Get("/rules/{service}/id/{id}", a.handleGetRuleByID)
+		r.Put("/rules/{service}/id/{id}", a.handleUpdateRuleByID)
+		r.Delete("/rules/{service}/id/{id}", a.handleDeleteRuleByID)
+		r.Post("/rules/{service}/id/{id}/move", a.handleMoveRuleByID)
 		r.Delete("/rules/{service}", a.handleDeleteService)
 
+		// Profiles (enable/disable rules by tag)
+		r.Get("/profiles", a.handleGetProfiles)
+		r.Put("/profiles/active", a.handleSetActiveProfile)
+		r.Put("/profiles/{name}", a.handleSaveProfile)
+		r.Delete("/profiles/{name}", a.handleDeleteProfile)
+
+		// Expired rules (activeUntil passed or once / expiresAfter used up)
+		r.Get("/expired-rules", a.handleGetExpiredRules)
+		r.Post("/expired-rules/cleanup", a.handleCleanupExpiredRules)
+
 		// Config
 		r.Get("/config", a.handleGetConfig)
 		r.Get("/config/{key}", a.handleGetConfigValue)
@@ -157,28 +236,9 @@ func (a *API) handleGetTraffic(w http.ResponseWriter, r *http.Request) {
 	entries := st.GetTraffic(limit, service)
 
 	// Compute current matched rule for each entry
+	workspace := workspaceParam(r)
 	for i := range entries {
-		entry := &entries[i]
-
-		// Get current rules for this service
-		rules := st.GetRules(entry.Service)
-
-		// Create request context from entry
-		ctx := &models.RequestContext{
-			Method:      entry.Method,
-			Path:        entry.Path,
-			QueryParams: entry.QueryParams,
-			Headers:     entry.Headers,
-			Body:        entry.Body,
-		}
-
-		// Match against current rules
-		_, ruleIndex := matcher.Match(rules, ctx)
-
-		// Set current matched rule (nil if no match)
-		if ruleIndex >= 0 {
-			entry.CurrentMatchedRule = &ruleIndex
-		}
+		setCurrentMatch(a.workspaceManager, workspace, &entries[i])
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
@@ -188,18 +248,177 @@ func (a *API) handleGetTraffic(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleSearchTraffic searches traffic history with the query language, a page at a time
+func (a *API) handleSearchTraffic(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	params := r.URL.Query()
+	q, err := query.Parse(params.Get("q"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid query: %v", err), "INVALID_QUERY")
+		return
+	}
+
+	opts := query.Options{Cursor: params.Get("cursor")}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", "INVALID_LIMIT")
+			return
+		}
+		opts.Limit = limit
+	}
+	switch params.Get("order") {
+	case "", "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		respondError(w, http.StatusBadRequest, "Order must be asc or desc", "INVALID_ORDER")
+		return
+	}
+
+	page, err := st.SearchTraffic(q, opts)
+	if errors.Is(err, query.ErrInvalidCursor) {
+		respondError(w, http.StatusBadRequest, "Invalid cursor", "INVALID_CURSOR")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to search traffic: %v", err), "SEARCH_FAILED")
+		return
+	}
+
+	workspace := workspaceParam(r)
+	for i := range page.Entries {
+		setCurrentMatch(a.workspaceManager, workspace, &page.Entries[i])
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"entries":     page.Entries,
+		"returned":    len(page.Entries),
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// handleExportHAR downloads the workspace's traffic (optionally one service's, or matching
+// a search query) as a HAR 1.2 file
+func (a *API) handleExportHAR(w http.ResponseWriter, r *http.Request) {
+	workspace := workspaceParam(r)
+	params := r.URL.Query()
+
+	q, err := query.Parse(params.Get("q"), time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid query: %v", err), "INVALID_QUERY")
+		return
+	}
+	opts := store.HARExportOptions{Service: params.Get("service"), Query: q}
+	if limitStr := params.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			respondError(w, http.StatusBadRequest, "Invalid limit", "INVALID_LIMIT")
+			return
+		}
+		opts.Limit = limit
+	}
+
+	// Build the file in memory so errors can still be reported as JSON
+	var buf bytes.Buffer
+	if _, err := a.workspaceManager.ExportHAR(workspace, &buf, opts); err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	filename := workspace
+	if opts.Service != "" {
+		filename += "-" + opts.Service
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".har"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// handleImportHAR imports a HAR file into the workspace as mock rules or as traffic history
+func (a *API) handleImportHAR(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.getWorkspaceStore(r); err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxHARSize+1))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to read HAR", "INVALID_HAR")
+		return
+	}
+	if len(data) > maxHARSize {
+		respondError(w, http.StatusRequestEntityTooLarge, "HAR too large", "HAR_TOO_LARGE")
+		return
+	}
+
+	params := r.URL.Query()
+	opts := store.HARImportOptions{Mode: params.Get("mode"), GroupBy: params.Get("group_by")}
+	result, err := a.workspaceManager.ImportHAR(workspaceParam(r), data, opts)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "HAR_IMPORT_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+// handleVerify counts recorded requests matching the given criteria and checks the count
+// Responds 200 when the expectation holds, 412 (with the closest requests) when it doesn't
+func (a *API) handleVerify(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	var req verify.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "INVALID_VERIFICATION")
+		return
+	}
+
+	result := st.VerifyTraffic(req)
+	status := http.StatusOK
+	if !result.Passed {
+		status = http.StatusPreconditionFailed
+	}
+	respondJSON(w, status, result)
+}
+
 // handleTrafficStream streams traffic via SSE
 func (a *API) handleTrafficStream(w http.ResponseWriter, r *http.Request) {
-	workspace := chi.URLParam(r, "workspace")
-	if workspace == "" {
-		workspace = "default"
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
 	}
+	streamTraffic(w, r, st, a.workspaceManager)
+}
+
+// handleEventStream streams rule and workspace change events via SSE
+func (a *API) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	streamEvents(w, r, a.workspaceManager, r.URL.Query().Get("workspace"))
+}
+
+// handleWorkspaceEventStream streams one workspace's change events via SSE
+func (a *API) handleWorkspaceEventStream(w http.ResponseWriter, r *http.Request) {
 	st, err := a.getWorkspaceStore(r)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
 		return
 	}
-	streamTraffic(w, r, st, workspace, a.workspaceManager)
+	streamEvents(w, r, a.workspaceManager, st.Name())
 }
 
 // handleGetTrafficByID returns a specific traffic entry
@@ -219,36 +438,7 @@ func (a *API) handleGetTrafficByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Compute current matched rule
-	workspace := chi.URLParam(r, "workspace")
-	if workspace == "" {
-		workspace = "default"
-	}
-	rules := st.GetRules(entry.Service)
-	ctx := &models.RequestContext{
-		Method:      entry.Method,
-		Path:        entry.Path,
-		QueryParams: entry.QueryParams,
-		Headers:     entry.Headers,
-		Body:        entry.Body,
-	}
-	_, ruleIndex := matcher.Match(rules, ctx)
-	matchedWorkspace := workspace
-
-	// Fallback to default workspace if no match and not already in default
-	if ruleIndex < 0 && workspace != "default" {
-		if defaultStore, err := a.workspaceManager.GetStore("default"); err == nil {
-			defaultRules := defaultStore.GetRules(entry.Service)
-			_, ruleIndex = matcher.Match(defaultRules, ctx)
-			if ruleIndex >= 0 {
-				matchedWorkspace = "default"
-			}
-		}
-	}
-
-	if ruleIndex >= 0 {
-		entry.CurrentMatchedRule = &ruleIndex
-		entry.CurrentMatchedWorkspace = matchedWorkspace
-	}
+	setCurrentMatch(a.workspaceManager, workspaceParam(r), entry)
 
 	respondJSON(w, http.StatusOK, entry)
 }
@@ -270,7 +460,7 @@ func (a *API) handleGenerateRule(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate rule template
-	rule := generateRuleFromTraffic(entry)
+	rule := store.GenerateRule(entry)
 
 	// Convert to YAML
 	data, err := yaml.Marshal(rule)
@@ -297,68 +487,247 @@ func (a *API) handleGetAllRules(w http.ResponseWriter, r *http.Request) {
 
 	services := make(map[string]interface{})
 	for service, rules := range allRules {
-		indexed := make([]map[string]interface{}, len(rules))
-		for i, rule := range rules {
-			indexed[i] = map[string]interface{}{
-				"index": i,
-				"match": rule.Match,
-			}
-			if rule.ProxyTo != "" {
-				indexed[i]["proxyto"] = rule.ProxyTo
-				indexed[i]["headers"] = rule.Headers
-			}
-			if rule.Response != "" {
-				indexed[i]["response"] = rule.Response
-			}
-			if rule.Enabled != nil {
-				indexed[i]["enabled"] = *rule.Enabled
-			}
-		}
+		indexed := indexRules(st, service, rules)
 
 		services[service] = map[string]interface{}{
 			"service": service,
 			"file":    service + ".yaml",
 			"rules":   indexed,
+			"etag":    st.ServiceETag(service),
+		}
+	}
+
+	// Files that failed to load (the last good rules, if any, stay active)
+	loadErrors := st.GetLoadErrors()
+	for service, loadErr := range loadErrors {
+		if entry, ok := services[service].(map[string]interface{}); ok {
+			entry["load_error"] = loadErr
 		}
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"services": services,
+		"services":    services,
+		"load_errors": loadErrors,
 	})
 }
 
-// handleGetServiceRules returns rules for a service
-func (a *API) handleGetServiceRules(w http.ResponseWriter, r *http.Request) {
-	st, err := a.getWorkspaceStore(r)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
-		return
+// indexRules builds the listing for a service's own rules, annotating each with its
+// index and, for scheduled or expired rules, its status
+func indexRules(st *store.Store, service string, rules []models.Rule) []map[string]interface{} {
+	// Status and match counts come from the resolved rules
+	resolved, _ := st.GetResolvedRules(service)
+	states := make(map[string]models.ResolvedRule)
+	for _, rr := range resolved {
+		if rr.Origin == store.OriginService {
+			states[rr.ID] = rr
+		}
 	}
 
-	service := chi.URLParam(r, "service")
-	rules := st.GetRules(service)
-
 	indexed := make([]map[string]interface{}, len(rules))
 	for i, rule := range rules {
 		indexed[i] = map[string]interface{}{
 			"index": i,
+			"id":    rule.ID,
 			"match": rule.Match,
 		}
 		if rule.ProxyTo != "" {
 			indexed[i]["proxyto"] = rule.ProxyTo
 			indexed[i]["headers"] = rule.Headers
 		}
+		if rule.TLS != nil {
+			indexed[i]["tls"] = rule.TLS
+		}
 		if rule.Response != "" {
 			indexed[i]["response"] = rule.Response
 		}
 		if rule.Enabled != nil {
 			indexed[i]["enabled"] = *rule.Enabled
 		}
+		if len(rule.Tags) > 0 {
+			indexed[i]["tags"] = rule.Tags
+		}
+		if rule.ActiveFrom != nil {
+			indexed[i]["activeFrom"] = rule.ActiveFrom
+		}
+		if rule.ActiveUntil != nil {
+			indexed[i]["activeUntil"] = rule.ActiveUntil
+		}
+		if limit := rule.MatchLimit(); limit > 0 {
+			indexed[i]["expiresAfter"] = limit
+			indexed[i]["hits"] = states[rule.ID].Hits
+		}
+		if status := states[rule.ID].Status; status != "" {
+			indexed[i]["status"] = status
+		}
+	}
+	return indexed
+}
+
+// handleGetServiceRules returns rules for a service
+func (a *API) handleGetServiceRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	rules := st.GetRules(service)
+
+	indexed := indexRules(st, service, rules)
+
+	// Effective rules in match order, each annotated with its origin
+	resolved, warnings := st.GetResolvedRules(service)
+
+	etag := st.ServiceETag(service)
+	result := map[string]interface{}{
+		"service":  service,
+		"settings": st.GetServiceSettings(service),
+		"include":  st.GetServiceRules(service).Include,
+		"rules":    indexed,
+		"resolved": resolved,
+		"etag":     etag,
+	}
+	if len(warnings) > 0 {
+		result["include_warnings"] = warnings
+	}
+	if loadErr, ok := st.GetLoadErrors()[service]; ok {
+		result["load_error"] = loadErr
+	}
+
+	w.Header().Set("ETag", etag)
+	respondJSON(w, http.StatusOK, result)
+}
+
+// handleLintServiceRules checks a service's rules for unreachable rules, bad patterns and templates
+func (a *API) handleLintServiceRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	issues := st.LintService(service)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"service": service,
+		"issues":  issues,
+		"count":   len(issues),
+	})
+}
+
+// handleLintRules checks every service in the workspace
+func (a *API) handleLintRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	services := st.LintAll()
+	count := 0
+	for _, issues := range services {
+		count += len(issues)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"services": services,
+		"count":    count,
+	})
+}
+
+// handleTestServiceRules runs the examples embedded in a service's rules
+func (a *API) handleTestServiceRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
 	}
 
+	service := chi.URLParam(r, "service")
+	results := st.TestService(service)
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"service": service,
-		"rules":   indexed,
+		"results": results,
+		"summary": ruletest.Summarize(results),
+	})
+}
+
+// handleTestRules runs the rule examples of every service in the workspace
+func (a *API) handleTestRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	services := st.TestAll()
+	var all []ruletest.Result
+	for _, results := range services {
+		all = append(all, results...)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"services": services,
+		"summary":  ruletest.Summarize(all),
+	})
+}
+
+// handleSimulate shows how the proxy would answer a request, without sending or recording it
+func (a *API) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.getWorkspaceStore(r); err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	var req proxy.SimulateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+	if req.Path == "" {
+		respondError(w, http.StatusBadRequest, "Path is required", "INVALID_PATH")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, a.proxyHandler.Simulate(workspaceParam(r), req))
+}
+
+// handleGetLibrary lists the shared rule libraries
+func (a *API) handleGetLibrary(w http.ResponseWriter, r *http.Request) {
+	library := a.workspaceManager.Library()
+
+	libraries := make(map[string]interface{})
+	for _, name := range library.Names() {
+		rules, _ := library.Get(name)
+		libraries[name] = map[string]interface{}{
+			"count": len(rules),
+		}
+	}
+	loadErrors := library.GetLoadErrors()
+	for name, loadErr := range loadErrors {
+		if entry, ok := libraries[name].(map[string]interface{}); ok {
+			entry["load_error"] = loadErr
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"libraries":   libraries,
+		"load_errors": loadErrors,
+	})
+}
+
+// handleGetLibraryRules returns the rules of a shared library
+func (a *API) handleGetLibraryRules(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	rules, ok := a.workspaceManager.Library().Get(name)
+	if !ok {
+		respondError(w, http.StatusNotFound, "Library not found", "LIBRARY_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"library": name,
+		"rules":   rules,
 	})
 }
 
@@ -371,10 +740,8 @@ func (a *API) handleGetRawRules(w http.ResponseWriter, r *http.Request) {
 	}
 
 	service := chi.URLParam(r, "service")
-	rules := st.GetRules(service)
 
-	serviceRules := models.ServiceRules{Rules: rules}
-	data, err := yaml.Marshal(serviceRules)
+	data, err := yaml.Marshal(st.GetServiceRules(service))
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to marshal YAML", "YAML_ERROR")
 		return
@@ -400,14 +767,17 @@ func (a *API) handleCreateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := st.AddRule(service, rule); err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error(), "ADD_FAILED")
+	id, err := st.AddRule(service, rule, r.Header.Get("If-Match"))
+	if err != nil {
+		respondRuleError(w, http.StatusInternalServerError, err, "ADD_FAILED")
 		return
 	}
+	w.Header().Set("ETag", st.ServiceETag(service))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"service": service,
+		"id":      id,
 		"message": "Rule created successfully",
 	})
 }
@@ -435,10 +805,11 @@ func (a *API) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := st.UpdateRule(service, index, rule); err != nil {
-		respondError(w, http.StatusNotFound, err.Error(), "RULE_NOT_FOUND")
+	if err := st.UpdateRule(service, index, rule, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusInternalServerError, err, "UPDATE_FAILED")
 		return
 	}
+	w.Header().Set("ETag", st.ServiceETag(service))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -465,10 +836,11 @@ func (a *API) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := st.DeleteRule(service, index); err != nil {
-		respondError(w, http.StatusNotFound, err.Error(), "RULE_NOT_FOUND")
+	if err := st.DeleteRule(service, index, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusInternalServerError, err, "DELETE_FAILED")
 		return
 	}
+	w.Header().Set("ETag", st.ServiceETag(service))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -488,8 +860,8 @@ func (a *API) handleDeleteService(w http.ResponseWriter, r *http.Request) {
 
 	service := chi.URLParam(r, "service")
 
-	if err := st.DisableService(service); err != nil {
-		respondError(w, http.StatusNotFound, err.Error(), "SERVICE_NOT_FOUND")
+	if err := st.DisableService(service, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusNotFound, err, "SERVICE_NOT_FOUND")
 		return
 	}
 
@@ -525,10 +897,11 @@ func (a *API) handleMoveRule(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := st.MoveRule(service, index, req.Direction); err != nil {
-		respondError(w, http.StatusBadRequest, err.Error(), "MOVE_FAILED")
+	if err := st.MoveRule(service, index, req.Direction, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusBadRequest, err, "MOVE_FAILED")
 		return
 	}
+	w.Header().Set("ETag", st.ServiceETag(service))
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
@@ -537,45 +910,468 @@ func (a *API) handleMoveRule(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleGetConfig returns configuration
-func (a *API) handleGetConfig(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"proxy_port":  a.config.ProxyPort,
-		"admin_port":  a.config.AdminPort,
-		"config_dir":  a.config.ConfigDir,
-		"values":      a.config.GetAll(true), // Masked
-		"version":     a.config.Version,
-		"build_name":  a.config.BuildName,
-		"build_time":  a.config.BuildTime,
-		"commit_hash": a.config.CommitHash,
-		"go_version":  a.config.GoVersion,
-	})
-}
+// handleGetRuleHistory lists the versions of a service's rules (newest first)
+func (a *API) handleGetRuleHistory(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
 
-// handleGetConfigValue returns a specific config value
+	service := chi.URLParam(r, "service")
+
+	versions, err := st.GetHistory(service)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error(), "HISTORY_FAILED")
+		return
+	}
+	if versions == nil {
+		versions = []models.RuleVersion{}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"service":  service,
+		"versions": versions,
+	})
+}
+
+// handleGetRuleVersion returns one version of a service's rules, including its content
+func (a *API) handleGetRuleVersion(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid version", "INVALID_VERSION")
+		return
+	}
+
+	v, err := st.GetHistoryVersion(service, version)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "VERSION_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, v)
+}
+
+// handleDiffRuleHistory returns a unified diff between two versions
+// ?from=<version>&to=<version>; "to" defaults to the latest version
+func (a *API) handleDiffRuleHistory(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 1 {
+		respondError(w, http.StatusBadRequest, "Invalid from version", "INVALID_VERSION")
+		return
+	}
+	to := 0
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if to, err = strconv.Atoi(toStr); err != nil || to < 1 {
+			respondError(w, http.StatusBadRequest, "Invalid to version", "INVALID_VERSION")
+			return
+		}
+	}
+
+	fromVersion, err := st.GetHistoryVersion(service, from)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "VERSION_NOT_FOUND")
+		return
+	}
+	toVersion, err := st.GetHistoryVersion(service, to)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "VERSION_NOT_FOUND")
+		return
+	}
+
+	unified := diff.Unified(fromVersion.Content, toVersion.Content,
+		fmt.Sprintf("%s.yaml@%d", service, fromVersion.Version),
+		fmt.Sprintf("%s.yaml@%d", service, toVersion.Version), 3)
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"service": service,
+		"from":    fromVersion.Version,
+		"to":      toVersion.Version,
+		"diff":    unified,
+	})
+}
+
+// handleRollbackRules restores a service's rules to an earlier version
+func (a *API) handleRollbackRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 1 {
+		respondError(w, http.StatusBadRequest, "Invalid version", "INVALID_VERSION")
+		return
+	}
+
+	if err := st.RollbackRules(service, version, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusBadRequest, err, "ROLLBACK_FAILED")
+		return
+	}
+	w.Header().Set("ETag", st.ServiceETag(service))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"service": service,
+		"version": version,
+		"message": "Rules rolled back successfully",
+	})
+}
+
+// handleGetRuleByID returns a rule by its stable ID
+func (a *API) handleGetRuleByID(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	id := chi.URLParam(r, "id")
+
+	rule, index, err := st.GetRuleByID(service, id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "RULE_NOT_FOUND")
+		return
+	}
+
+	w.Header().Set("ETag", st.ServiceETag(service))
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"service": service,
+		"index":   index,
+		"rule":    rule,
+	})
+}
+
+// handleUpdateRuleByID updates a rule by its stable ID
+func (a *API) handleUpdateRuleByID(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	id := chi.URLParam(r, "id")
+
+	var rule models.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := st.UpdateRuleByID(service, id, rule, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusInternalServerError, err, "UPDATE_FAILED")
+		return
+	}
+	w.Header().Set("ETag", st.ServiceETag(service))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"service": service,
+		"id":      id,
+		"message": "Rule updated successfully",
+	})
+}
+
+// handleDeleteRuleByID deletes a rule by its stable ID
+func (a *API) handleDeleteRuleByID(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	id := chi.URLParam(r, "id")
+
+	if err := st.DeleteRuleByID(service, id, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusInternalServerError, err, "DELETE_FAILED")
+		return
+	}
+	w.Header().Set("ETag", st.ServiceETag(service))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"service": service,
+		"id":      id,
+		"message": "Rule deleted successfully",
+	})
+}
+
+// handleMoveRuleByID moves a rule up or down by its stable ID
+func (a *API) handleMoveRuleByID(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	service := chi.URLParam(r, "service")
+	id := chi.URLParam(r, "id")
+
+	var req struct {
+		Direction string `json:"direction"` // "up" or "down"
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := st.MoveRuleByID(service, id, req.Direction, r.Header.Get("If-Match")); err != nil {
+		respondRuleError(w, http.StatusBadRequest, err, "MOVE_FAILED")
+		return
+	}
+	w.Header().Set("ETag", st.ServiceETag(service))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"service": service,
+		"id":      id,
+		"message": "Rule moved successfully",
+	})
+}
+
+// handleGetProfiles returns the workspace's profiles and the active one
+func (a *API) handleGetProfiles(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, st.GetProfiles())
+}
+
+// handleSetActiveProfile switches the active profile ("" for none)
+func (a *API) handleSetActiveProfile(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := st.SetActiveProfile(req.Name); err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "PROFILE_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"active":  req.Name,
+		"message": "Active profile switched successfully",
+	})
+}
+
+// handleSaveProfile creates or replaces a profile
+func (a *API) handleSaveProfile(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	var profile models.Profile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := st.SaveProfile(name, profile); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "SAVE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"message": "Profile saved successfully",
+	})
+}
+
+// handleDeleteProfile deletes a profile
+func (a *API) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+	if err := st.DeleteProfile(name); err != nil {
+		respondError(w, http.StatusNotFound, err.Error(), "PROFILE_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"message": "Profile deleted successfully",
+	})
+}
+
+// handleGetExpiredRules lists the workspace's expired rules
+func (a *API) handleGetExpiredRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	expired := st.GetExpiredRules()
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"rules": expired,
+		"count": len(expired),
+	})
+}
+
+// handleCleanupExpiredRules removes the workspace's expired rules from their files
+func (a *API) handleCleanupExpiredRules(w http.ResponseWriter, r *http.Request) {
+	st, err := a.getWorkspaceStore(r)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	removed, err := st.CleanupExpiredRules()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error(), "SAVE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"removed": removed,
+		"count":   len(removed),
+		"message": "Expired rules removed successfully",
+	})
+}
+
+// handleGetConfig returns configuration
+func (a *API) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"proxy_port":          a.config.ProxyPort,
+		"admin_port":          a.config.AdminPort,
+		"config_dir":          a.config.ConfigDir,
+		"values":              a.config.GetAll(true), // Masked
+		"host_routes":         a.config.GetHostRoutes(),
+		"workspace_selectors": a.config.GetWorkspaceSelectors(),
+		"version":             a.config.Version,
+		"build_name":          a.config.BuildName,
+		"build_time":          a.config.BuildTime,
+		"commit_hash":         a.config.CommitHash,
+		"go_version":          a.config.GoVersion,
+	})
+}
+
+// handleGetConfigValue returns a specific config value
 func (a *API) handleGetConfigValue(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "key")
 	value := a.config.Get(key)
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"key":   key,
-		"value": value,
+		"key":   key,
+		"value": value,
+	})
+}
+
+// handleSetConfigValue sets a config value
+func (a *API) handleSetConfigValue(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	a.config.Set(key, req.Value)
+
+	// Save to disk
+	if err := a.config.Save(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save config", "SAVE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"message": "Config value updated successfully",
+	})
+}
+
+// handleDeleteConfigValue deletes a config value
+func (a *API) handleDeleteConfigValue(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	a.config.Delete(key)
+
+	// Save to disk
+	if err := a.config.Save(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to save config", "SAVE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"key":     key,
+		"message": "Config value deleted successfully",
 	})
 }
 
-// handleSetConfigValue sets a config value
-func (a *API) handleSetConfigValue(w http.ResponseWriter, r *http.Request) {
-	key := chi.URLParam(r, "key")
+// handleGetHostRoutes returns the host routing table
+func (a *API) handleGetHostRoutes(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"routes": a.config.GetHostRoutes(),
+	})
+}
 
+// handleSetHostRoutes replaces the host routing table
+func (a *API) handleSetHostRoutes(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Value string `json:"value"`
+		Routes []config.HostRoute `json:"routes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
 		return
 	}
 
-	a.config.Set(key, req.Value)
+	for _, route := range req.Routes {
+		if strings.TrimSpace(route.Host) == "" || strings.TrimSpace(route.Service) == "" {
+			respondError(w, http.StatusBadRequest, "Each route needs a host and a service", "INVALID_ROUTE")
+			return
+		}
+	}
+
+	a.config.SetHostRoutes(req.Routes)
 
 	// Save to disk
 	if err := a.config.Save(); err != nil {
@@ -585,15 +1381,46 @@ func (a *API) handleSetConfigValue(w http.ResponseWriter, r *http.Request) {
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"key":     key,
-		"message": "Config value updated successfully",
+		"routes":  req.Routes,
+		"message": "Host routes updated successfully",
 	})
 }
 
-// handleDeleteConfigValue deletes a config value
-func (a *API) handleDeleteConfigValue(w http.ResponseWriter, r *http.Request) {
-	key := chi.URLParam(r, "key")
-	a.config.Delete(key)
+// handleGetWorkspaceSelectors returns the workspace selectors in priority order
+func (a *API) handleGetWorkspaceSelectors(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"selectors": a.config.GetWorkspaceSelectors(),
+	})
+}
+
+// handleSetWorkspaceSelectors replaces the workspace selectors
+func (a *API) handleSetWorkspaceSelectors(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Selectors []config.WorkspaceSelector `json:"selectors"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	for _, sel := range req.Selectors {
+		switch sel.Type {
+		case "header", "cookie", "query":
+		default:
+			respondError(w, http.StatusBadRequest, "Selector type must be header, cookie or query", "INVALID_SELECTOR")
+			return
+		}
+		if strings.TrimSpace(sel.Name) == "" {
+			respondError(w, http.StatusBadRequest, "Selector name cannot be empty", "INVALID_SELECTOR")
+			return
+		}
+	}
+
+	// An empty list disables selectors (nil would restore the defaults)
+	if req.Selectors == nil {
+		req.Selectors = []config.WorkspaceSelector{}
+	}
+	a.config.SetWorkspaceSelectors(req.Selectors)
 
 	// Save to disk
 	if err := a.config.Save(); err != nil {
@@ -602,9 +1429,9 @@ func (a *API) handleDeleteConfigValue(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"key":     key,
-		"message": "Config value deleted successfully",
+		"success":   true,
+		"selectors": req.Selectors,
+		"message":   "Workspace selectors updated successfully",
 	})
 }
 
@@ -643,32 +1470,10 @@ func (a *API) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		"total_requests": len(allTraffic),
 		"total_rules":    totalRules,
 		"services":       services,
+		"recording":      st.RecorderStats(),
 	})
 }
 
-// generateRuleFromTraffic creates a rule template from a traffic entry
-func generateRuleFromTraffic(entry *models.TrafficEntry) models.Rule {
-	rule := models.Rule{
-		Match: models.MatchCondition{
-			Method: []string{entry.Method},
-			Path:   entry.Path,
-		},
-	}
-
-	if entry.Response != nil {
-		// Create .mock template from response
-		parsed := &models.ParsedTemplate{
-			StatusCode: entry.Response.StatusCode,
-			Headers:    entry.Response.Headers,
-			Body:       entry.Response.Body,
-			Delay:      time.Duration(entry.Response.DelayMS) * time.Millisecond,
-		}
-		rule.Response = dsl.Format(parsed)
-	}
-
-	return rule
-}
-
 // Helper functions
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -684,11 +1489,28 @@ func respondError(w http.ResponseWriter, status int, message, code string) {
 	})
 }
 
+// respondRuleError responds to a failed rule change, using 412 when an If-Match
+// precondition failed (someone else changed the rules), 404 for a missing rule and
+// 409 for a duplicate rule ID; other errors use the given status and code
+func respondRuleError(w http.ResponseWriter, status int, err error, code string) {
+	switch {
+	case errors.Is(err, store.ErrPreconditionFailed):
+		respondError(w, http.StatusPreconditionFailed, err.Error(), "PRECONDITION_FAILED")
+	case errors.Is(err, store.ErrRuleNotFound):
+		respondError(w, http.StatusNotFound, err.Error(), "RULE_NOT_FOUND")
+	case errors.Is(err, store.ErrRuleIDExists):
+		respondError(w, http.StatusConflict, err.Error(), "RULE_ID_EXISTS")
+	default:
+		respondError(w, status, err.Error(), code)
+	}
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -701,11 +1523,37 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 // getWorkspaceStore gets the store for the workspace in the URL
 func (a *API) getWorkspaceStore(r *http.Request) (*store.Store, error) {
+	return a.workspaceManager.GetStore(workspaceParam(r))
+}
+
+// workspaceParam returns the workspace in the URL (defaults to "default")
+func workspaceParam(r *http.Request) string {
 	workspace := chi.URLParam(r, "workspace")
 	if workspace == "" {
 		workspace = "default" // default
 	}
-	return a.workspaceManager.GetStore(workspace)
+	return workspace
+}
+
+// setCurrentMatch computes which rule would match a traffic entry with the current rules
+// (walking the workspace inheritance chain) and records it on the entry
+func setCurrentMatch(wm *store.WorkspaceManager, workspace string, entry *models.TrafficEntry) {
+	ctx := &models.RequestContext{
+		Method:      entry.Method,
+		Path:        entry.Path,
+		QueryParams: entry.QueryParams,
+		Headers:     entry.Headers,
+		Body:        entry.Body,
+	}
+
+	match := wm.MatchRule(workspace, entry.Service, ctx)
+	if match.Matched() {
+		index := match.Index
+		entry.CurrentMatchedRule = &index
+		entry.CurrentMatchedRuleID = match.Rule.ID
+		entry.CurrentMatchedRuleOrigin = match.Origin
+		entry.CurrentMatchedWorkspace = match.Workspace
+	}
 }
 
 // serveWorkspaceUI returns a handler for serving the workspace-specific UI
@@ -765,6 +1613,64 @@ func (a *API) handleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (a *API) handleCreateEphemeralWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name   string                   `json:"name"`
+		TTL    string                   `json:"ttl"` // e.g. "30m", "2h"
+		Parent string                   `json:"parent"`
+		Rules  map[string][]models.Rule `json:"rules"` // service -> rules
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	opts := store.EphemeralOptions{Name: req.Name, Parent: req.Parent, Rules: req.Rules}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid ttl (use e.g. 30m or 2h)", "INVALID_TTL")
+			return
+		}
+		opts.TTL = ttl
+	}
+
+	metadata, name, err := a.workspaceManager.CreateEphemeralWorkspace(opts)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_CREATE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    true,
+		"name":       name,
+		"parent":     metadata.Parent,
+		"expires_at": metadata.ExpiresAt,
+		"proxy_path": "/w/" + name,
+		"message":    "Ephemeral workspace created successfully",
+	})
+}
+
+func (a *API) handleTeardownWorkspace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if !a.workspaceManager.IsEphemeral(name) {
+		respondError(w, http.StatusBadRequest, "Not an ephemeral workspace: "+name, "NOT_EPHEMERAL")
+		return
+	}
+
+	if err := a.workspaceManager.DeleteWorkspace(name); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error(), "WORKSPACE_DELETE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"message": "Workspace torn down successfully",
+	})
+}
+
 func (a *API) handleDisableWorkspace(w http.ResponseWriter, r *http.Request) {
 	name := chi.URLParam(r, "name")
 
@@ -819,6 +1725,253 @@ func (a *API) handleDuplicateWorkspace(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (a *API) handleExportWorkspace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	// Build the bundle in memory so errors can still be reported as JSON
+	var buf bytes.Buffer
+	opts := store.ExportOptions{IncludeTraffic: r.URL.Query().Get("traffic") == "true"}
+	if err := a.workspaceManager.ExportWorkspace(name, &buf, opts); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_EXPORT_FAILED")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".mockingbird.zip"))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (a *API) handleImportWorkspace(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBundleSize+1))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Failed to read bundle", "INVALID_BUNDLE")
+		return
+	}
+	if len(data) > maxBundleSize {
+		respondError(w, http.StatusRequestEntityTooLarge, "Bundle too large", "BUNDLE_TOO_LARGE")
+		return
+	}
+
+	query := r.URL.Query()
+	opts := store.ImportOptions{
+		Name:        query.Get("name"),
+		OnConflict:  query.Get("on_conflict"),
+		SkipTraffic: query.Get("traffic") == "false",
+	}
+
+	result, err := a.workspaceManager.ImportWorkspace(bytes.NewReader(data), int64(len(data)), opts)
+	if err != nil {
+		status, code := http.StatusBadRequest, "WORKSPACE_IMPORT_FAILED"
+		switch {
+		case errors.Is(err, store.ErrWorkspaceExists):
+			status = http.StatusConflict
+		case errors.Is(err, store.ErrBundleTooLarge):
+			status, code = http.StatusRequestEntityTooLarge, "BUNDLE_TOO_LARGE"
+		}
+		respondError(w, status, err.Error(), code)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"result":  result,
+		"message": "Workspace imported successfully",
+	})
+}
+
+func (a *API) handleRenameWorkspace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := a.workspaceManager.RenameWorkspace(name, req.Name); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_RENAME_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"old":     name,
+		"name":    req.Name,
+		"message": "Workspace renamed successfully",
+	})
+}
+
+func (a *API) handleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := a.workspaceManager.DeleteWorkspace(name); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_DELETE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"message": "Workspace deleted successfully",
+	})
+}
+
+func (a *API) handleGetArchive(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := a.workspaceManager.GetDisabledWorkspaces()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error(), "ARCHIVE_LIST_FAILED")
+		return
+	}
+
+	services, err := a.workspaceManager.GetDisabledServices()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error(), "ARCHIVE_LIST_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"workspaces": workspaces,
+		"services":   services,
+	})
+}
+
+func (a *API) handlePurgeDisabledWorkspace(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := a.workspaceManager.PurgeDisabledWorkspace(name); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_PURGE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"message": "Workspace purged successfully",
+	})
+}
+
+func (a *API) handleRestoreService(w http.ResponseWriter, r *http.Request) {
+	workspace := chi.URLParam(r, "workspace")
+	file := chi.URLParam(r, "file")
+
+	service, err := a.workspaceManager.RestoreService(workspace, file)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "SERVICE_RESTORE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"workspace": workspace,
+		"service":   service,
+		"message":   "Service restored successfully",
+	})
+}
+
+func (a *API) handlePurgeDisabledService(w http.ResponseWriter, r *http.Request) {
+	workspace := chi.URLParam(r, "workspace")
+	file := chi.URLParam(r, "file")
+
+	if err := a.workspaceManager.PurgeDisabledService(workspace, file); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "SERVICE_PURGE_FAILED")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"workspace": workspace,
+		"file":      file,
+		"message":   "Service purged successfully",
+	})
+}
+
+func (a *API) handleGetWorkspaceChain(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	chain, err := a.workspaceManager.Chain(name)
+	result := map[string]interface{}{
+		"name":  name,
+		"chain": chain,
+	}
+	if err != nil {
+		result["error"] = err.Error()
+	}
+
+	respondJSON(w, http.StatusOK, result)
+}
+
+func (a *API) handleSetWorkspaceParent(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req struct {
+		Parent string `json:"parent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	if err := a.workspaceManager.SetParent(name, req.Parent); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_PARENT_FAILED")
+		return
+	}
+
+	chain, _ := a.workspaceManager.Chain(name)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"name":    name,
+		"parent":  req.Parent,
+		"chain":   chain,
+		"message": "Workspace parent updated successfully",
+	})
+}
+
+// handleGetWorkspaceRetention returns a workspace's traffic retention policy
+func (a *API) handleGetWorkspaceRetention(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	retention, err := a.workspaceManager.GetRetention(name)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Workspace not found", "WORKSPACE_NOT_FOUND")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"name":      name,
+		"retention": retention,
+	})
+}
+
+// handleSetWorkspaceRetention sets (or, with an empty policy, removes) a workspace's
+// traffic retention policy and applies it straight away
+func (a *API) handleSetWorkspaceRetention(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req models.Retention
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON", "INVALID_JSON")
+		return
+	}
+
+	dropped, err := a.workspaceManager.SetRetention(name, &req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error(), "WORKSPACE_RETENTION_FAILED")
+		return
+	}
+
+	retention, _ := a.workspaceManager.GetRetention(name)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"success":   true,
+		"name":      name,
+		"retention": retention,
+		"dropped":   dropped,
+		"message":   "Workspace retention updated successfully",
+	})
+}
+
 // handleGetPlugins returns a list of all loaded plugins
 func (a *API) handleGetPlugins(w http.ResponseWriter, r *http.Request) {
 	if a.pluginManager == nil {
@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
-	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
 )
 
 // streamTraffic handles Server-Sent Events for live traffic
-func streamTraffic(w http.ResponseWriter, r *http.Request, st *store.Store, workspace string, wm *store.WorkspaceManager) {
+func streamTraffic(w http.ResponseWriter, r *http.Request, st *store.Store, wm *store.WorkspaceManager) {
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -27,6 +25,7 @@ func streamTraffic(w http.ResponseWriter, r *http.Request, st *store.Store, work
 
 	// Subscribe to traffic updates
 	trafficChan := st.SubscribeTraffic()
+	defer st.UnsubscribeTraffic(trafficChan)
 
 	// Stream events
 	for {
@@ -38,32 +37,8 @@ func streamTraffic(w http.ResponseWriter, r *http.Request, st *store.Store, work
 			}
 
 			// Compute current matched rule for this entry
-			rules := st.GetRules(entry.Service)
-			ctx := &models.RequestContext{
-				Method:      entry.Method,
-				Path:        entry.Path,
-				QueryParams: entry.QueryParams,
-				Headers:     entry.Headers,
-				Body:        entry.Body,
-			}
-			_, ruleIndex := matcher.Match(rules, ctx)
-			matchedWorkspace := workspace
-
-			// Fallback to default workspace if no match
-			if ruleIndex < 0 && workspace != "default" {
-				if defaultStore, err := wm.GetStore("default"); err == nil {
-					defaultRules := defaultStore.GetRules(entry.Service)
-					_, ruleIndex = matcher.Match(defaultRules, ctx)
-					if ruleIndex >= 0 {
-						matchedWorkspace = "default"
-					}
-				}
-			}
-
-			if ruleIndex >= 0 {
-				entry.CurrentMatchedRule = &ruleIndex
-				entry.CurrentMatchedWorkspace = matchedWorkspace
-			}
+			// (the store's name, not the URL's, so the stream survives a workspace rename)
+			setCurrentMatch(wm, st.Name(), &entry)
 
 			// Marshal entry to JSON
 			data, err := json.Marshal(entry)
@@ -82,3 +57,59 @@ func streamTraffic(w http.ResponseWriter, r *http.Request, st *store.Store, work
 		}
 	}
 }
+
+// streamEvents handles Server-Sent Events for rule and workspace changes
+// If workspace is non-empty only that workspace's (and the shared library's) events are sent,
+// following the workspace if it is renamed
+func streamEvents(w http.ResponseWriter, r *http.Request, wm *store.WorkspaceManager, workspace string) {
+	// Set SSE headers
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// Get flusher
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe to change events
+	eventChan := wm.SubscribeEvents()
+	defer wm.UnsubscribeEvents(eventChan)
+
+	// Stream events
+	for {
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				// Channel closed, server shutting down
+				return
+			}
+
+			// Library events have no workspace and concern every workspace
+			if workspace != "" && event.Workspace != "" && event.Workspace != workspace {
+				continue
+			}
+
+			if event.Type == store.EventWorkspaceRenamed && event.Workspace == workspace {
+				workspace = event.RenamedTo
+			}
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Printf("Error marshaling change event: %v\n", err)
+				continue
+			}
+
+			// Send SSE event, named by type so clients can listen selectively
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			// Client disconnected or server shutting down
+			return
+		}
+	}
+}
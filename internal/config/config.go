@@ -12,17 +12,103 @@ import (
 
 // Config holds application configuration
 type Config struct {
-	ProxyPort         int               `json:"proxy_port"`
-	AdminPort         int               `json:"admin_port"`
-	ConfigDir         string            `json:"-"`                         // Where rules are stored (never serialize - use env var only)
-	MaxTrafficEntries int               `json:"max_traffic_entries"`       // Maximum traffic entries to store
-	Values            map[string]string `json:"values"`                    // Custom key-value pairs (API keys, etc.)
-	Version           string            `json:"version,omitempty"`         // Version (e.g., "v1.3.0")
-	BuildName         string            `json:"build_name,omitempty"`      // Fun build name (e.g., "raging_rhino")
-	BuildTime         string            `json:"build_time,omitempty"`      // Build timestamp
-	CommitHash        string            `json:"commit_hash,omitempty"`     // Git commit hash
-	GoVersion         string            `json:"go_version,omitempty"`      // Go compiler version
-	mu                sync.RWMutex      `json:"-"`
+	ProxyPort           int                 `json:"proxy_port"`
+	AdminPort           int                 `json:"admin_port"`
+	ConfigDir           string              `json:"-"`                               // Where rules are stored (never serialize - use env var only)
+	MaxTrafficEntries   int                 `json:"max_traffic_entries"`             // Maximum traffic entries to store
+	Values              map[string]string   `json:"values"`                          // Custom key-value pairs (API keys, etc.)
+	HostRoutes          []HostRoute         `json:"host_routes,omitempty"`           // Host header based service routing
+	WorkspaceSelectors  []WorkspaceSelector `json:"workspace_selectors"`             // Where to read the workspace from (in priority order)
+	CleanupExpiredRules bool                `json:"cleanup_expired_rules,omitempty"` // Periodically remove expired rules from rule files
+	TrafficStorage      string              `json:"traffic_storage,omitempty"`       // Traffic persistence: "ndjson" (default) or "sqlite"
+	TrafficRecording    TrafficRecording    `json:"traffic_recording,omitzero"`      // Background traffic writer settings
+	Version             string              `json:"version,omitempty"`               // Version (e.g., "v1.3.0")
+	BuildName           string              `json:"build_name,omitempty"`            // Fun build name (e.g., "raging_rhino")
+	BuildTime           string              `json:"build_time,omitempty"`            // Build timestamp
+	CommitHash          string              `json:"commit_hash,omitempty"`           // Git commit hash
+	GoVersion           string              `json:"go_version,omitempty"`            // Go compiler version
+	mu                  sync.RWMutex        `json:"-"`
+}
+
+// Traffic storage backends (TrafficStorage)
+const (
+	TrafficStorageNDJSON = "ndjson" // One JSON entry per line in each workspace's traffic.ndjson
+	TrafficStorageSQLite = "sqlite" // Embedded SQLite database in each workspace's traffic.db
+)
+
+// TrafficRecording configures the background writer that persists traffic
+// Zero values use the defaults below
+type TrafficRecording struct {
+	QueueSize     int    `json:"queue_size,omitempty"`     // Entries waiting to be written (default 1024)
+	BatchSize     int    `json:"batch_size,omitempty"`     // Most entries written at once (default 100)
+	FlushInterval string `json:"flush_interval,omitempty"` // Longest an entry waits to be written (default "100ms")
+	Fsync         string `json:"fsync,omitempty"`          // "none" (default, left to the OS), "batch" or "interval"
+	FsyncInterval string `json:"fsync_interval,omitempty"` // Time between fsyncs with fsync: interval (default "1s")
+	Backpressure  string `json:"backpressure,omitempty"`   // When the queue is full: "drop" (default), "block" or "sample"
+	SampleEvery   int    `json:"sample_every,omitempty"`   // With backpressure: sample, write 1 in N entries once the queue is half full (default 10)
+}
+
+// Traffic recording fsync policies (TrafficRecording.Fsync)
+const (
+	FsyncNone     = "none"
+	FsyncBatch    = "batch"
+	FsyncInterval = "interval"
+)
+
+// Traffic recording backpressure policies (TrafficRecording.Backpressure)
+const (
+	BackpressureDrop   = "drop"   // Don't persist entries while the queue is full
+	BackpressureBlock  = "block"  // Wait for room in the queue (disk latency reaches requests)
+	BackpressureSample = "sample" // Persist 1 in SampleEvery entries once the queue is half full, drop when full
+)
+
+// WithDefaults returns the settings with defaults filled in and invalid values replaced
+func (r TrafficRecording) WithDefaults() TrafficRecording {
+	if r.QueueSize <= 0 {
+		r.QueueSize = 1024
+	}
+	if r.BatchSize <= 0 {
+		r.BatchSize = 100
+	}
+	if d, err := time.ParseDuration(r.FlushInterval); err != nil || d <= 0 {
+		r.FlushInterval = "100ms"
+	}
+	if d, err := time.ParseDuration(r.FsyncInterval); err != nil || d <= 0 {
+		r.FsyncInterval = "1s"
+	}
+	switch r.Fsync {
+	case FsyncNone, FsyncBatch, FsyncInterval:
+	default:
+		r.Fsync = FsyncNone
+	}
+	switch r.Backpressure {
+	case BackpressureDrop, BackpressureBlock, BackpressureSample:
+	default:
+		r.Backpressure = BackpressureDrop
+	}
+	if r.SampleEvery <= 0 {
+		r.SampleEvery = 10
+	}
+	return r
+}
+
+// HostRoute maps a request Host pattern to a service (and optionally a workspace)
+// Patterns are exact hosts ("api.stripe.local") or wildcards ("*.servicex.test")
+type HostRoute struct {
+	Host      string `json:"host"`
+	Service   string `json:"service"`
+	Workspace string `json:"workspace,omitempty"` // Defaults to "default"
+}
+
+// WorkspaceSelector picks the workspace for a proxy request from a header, cookie or query parameter
+type WorkspaceSelector struct {
+	Type string `json:"type"` // "header", "cookie" or "query"
+	Name string `json:"name"` // Header, cookie or query parameter name
+}
+
+// DefaultWorkspaceSelectors are used when config.json doesn't define any
+var DefaultWorkspaceSelectors = []WorkspaceSelector{
+	{Type: "header", Name: "X-Mockingbird-Workspace"},
 }
 
 // Load loads configuration from a file or environment variables
@@ -111,6 +197,46 @@ func (c *Config) Delete(key string) {
 	delete(c.Values, key)
 }
 
+// GetHostRoutes returns a copy of the host routing table (thread-safe)
+func (c *Config) GetHostRoutes() []HostRoute {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	routes := make([]HostRoute, len(c.HostRoutes))
+	copy(routes, c.HostRoutes)
+	return routes
+}
+
+// SetHostRoutes replaces the host routing table (thread-safe)
+func (c *Config) SetHostRoutes(routes []HostRoute) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.HostRoutes = routes
+}
+
+// GetWorkspaceSelectors returns the workspace selectors in priority order (thread-safe)
+// Falls back to DefaultWorkspaceSelectors if none are configured
+func (c *Config) GetWorkspaceSelectors() []WorkspaceSelector {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	selectors := c.WorkspaceSelectors
+	if selectors == nil {
+		selectors = DefaultWorkspaceSelectors
+	}
+
+	result := make([]WorkspaceSelector, len(selectors))
+	copy(result, selectors)
+	return result
+}
+
+// SetWorkspaceSelectors replaces the workspace selectors (thread-safe)
+func (c *Config) SetWorkspaceSelectors(selectors []WorkspaceSelector) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.WorkspaceSelectors = selectors
+}
+
 // GetAll returns all config values (masked for security)
 func (c *Config) GetAll(mask bool) map[string]string {
 	c.mu.RLock()
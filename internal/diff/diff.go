@@ -0,0 +1,230 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a diff line
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// Line is one line of a line-based diff
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxEdits bounds the work and memory of a diff (Myers' algorithm needs O(D²) for D
+// edits); inputs further apart than this have their differing middle replaced wholesale
+const maxEdits = 2000
+
+// Lines computes a line-based diff between a and b (Myers' shortest edit script)
+func Lines(a, b string) []Line {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// Common prefix and suffix are equal lines whatever the edits in between
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(x)+len(y)-prefix-suffix)
+	for _, text := range x[:prefix] {
+		lines = append(lines, Line{Equal, text})
+	}
+	lines = append(lines, editScript(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, text := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, text})
+	}
+	return lines
+}
+
+// editScript returns the shortest edit script turning x into y, or x deleted and y
+// inserted if that takes more than maxEdits edits
+func editScript(x, y []string) []Line {
+	n, m := len(x), len(y)
+	limit := min(n+m, maxEdits)
+
+	// v[offset+k] is the furthest x reached on diagonal k (x - y = k); trace keeps
+	// v[-d..d] after each step d for walking back
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				i = v[offset+k+1] // Insert y[j-1]
+			} else {
+				i = v[offset+k-1] + 1 // Delete x[i-1]
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[offset+k] = i
+
+			if i >= n && j >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrack(x, y, trace)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	lines := make([]Line, 0, n+m)
+	for _, text := range x {
+		lines = append(lines, Line{Delete, text})
+	}
+	for _, text := range y {
+		lines = append(lines, Line{Insert, text})
+	}
+	return lines
+}
+
+// backtrack walks an edit script's trace back from the end of x and y
+func backtrack(x, y []string, trace [][]int) []Line {
+	var reversed []Line
+	i, j := len(x), len(y)
+	for d := len(trace) - 1; d > 0; d-- {
+		// Furthest x on diagonal k after step d-1 (which covers diagonals -(d-1)..d-1)
+		prev := func(k int) int { return trace[d-1][k+d-1] }
+
+		k := i - j
+		prevK := k - 1
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			prevK = k + 1
+		}
+		prevI := prev(prevK)
+		prevJ := prevI - prevK
+
+		for i > prevI && j > prevJ {
+			reversed = append(reversed, Line{Equal, x[i-1]})
+			i--
+			j--
+		}
+		if i == prevI {
+			reversed = append(reversed, Line{Insert, y[j-1]})
+			j--
+		} else {
+			reversed = append(reversed, Line{Delete, x[i-1]})
+			i--
+		}
+	}
+	for i > 0 && j > 0 {
+		reversed = append(reversed, Line{Equal, x[i-1]})
+		i--
+		j--
+	}
+
+	lines := make([]Line, len(reversed))
+	for n, line := range reversed {
+		lines[len(reversed)-1-n] = line
+	}
+	return lines
+}
+
+// Unified returns a unified diff of a and b with the given lines of context
+// Returns "" if the inputs are equal
+func Unified(a, b, fromName, toName string, context int) string {
+	lines := Lines(a, b)
+
+	// Find the changed lines and group them into hunks
+	var sb strings.Builder
+	n := len(lines)
+	for start := 0; start < n; {
+		// Next change
+		first := start
+		for first < n && lines[first].Op == Equal {
+			first++
+		}
+		if first == n {
+			break
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		last := first
+		for k := first; k < n; k++ {
+			if lines[k].Op != Equal {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+
+		from := max(first-context, start)
+		to := min(last+context+1, n)
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&sb, lines, from, to)
+		start = to
+	}
+
+	return sb.String()
+}
+
+// writeHunk writes lines[from:to] as a unified diff hunk
+func writeHunk(sb *strings.Builder, lines []Line, from, to int) {
+	// Line numbers (1-based) of the hunk start in a and b
+	aStart, bStart := 1, 1
+	for _, l := range lines[:from] {
+		if l.Op != Insert {
+			aStart++
+		}
+		if l.Op != Delete {
+			bStart++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, l := range lines[from:to] {
+		if l.Op != Insert {
+			aCount++
+		}
+		if l.Op != Delete {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aStart--
+	}
+	if bCount == 0 {
+		bStart--
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, l := range lines[from:to] {
+		switch l.Op {
+		case Equal:
+			sb.WriteString(" ")
+		case Delete:
+			sb.WriteString("-")
+		case Insert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(l.Text)
+		sb.WriteString("\n")
+	}
+}
+
+// splitLines splits text into lines, ignoring a trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
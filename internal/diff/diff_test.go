@@ -0,0 +1,125 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "equal",
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			expected: "",
+		},
+		{
+			name:     "changed line",
+			a:        "rules:\n  - path: /a\n    response: \"[200]\"\n",
+			b:        "rules:\n  - path: /a\n    response: \"[404]\"\n",
+			expected: "--- v1\n+++ v2\n@@ -2,2 +2,2 @@\n   - path: /a\n-    response: \"[200]\"\n+    response: \"[404]\"\n",
+		},
+		{
+			name:     "insert into empty",
+			a:        "",
+			b:        "a\n",
+			expected: "--- v1\n+++ v2\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			name:     "separate hunks",
+			a:        "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			b:        "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			expected: "--- v1\n+++ v2\n@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := Unified(tt.a, tt.b, "v1", "v2", 1); result != tt.expected {
+				t.Errorf("Unified() =\n%s\nexpected\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	// Reconstructs both sides with the fewest edits
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&sb, "%d\n", rng.Intn(4))
+		}
+		return sb.String()
+	}
+	for i := 0; i < 200; i++ {
+		a, b := random(rng.Intn(12)), random(rng.Intn(12))
+		lines := Lines(a, b)
+		if from, to := sides(lines); from != a || to != b {
+			t.Fatalf("Lines(%q, %q) rebuilds %q, %q", a, b, from, to)
+		}
+		if edits, minimal := countEdits(lines), len(splitLines(a))+len(splitLines(b))-2*lcsLength(splitLines(a), splitLines(b)); edits != minimal {
+			t.Fatalf("Lines(%q, %q) has %d edits, expected %d", a, b, edits, minimal)
+		}
+	}
+
+	// Large, entirely different inputs are replaced wholesale rather than compared line by line
+	var a, b strings.Builder
+	for i := 0; i < 50000; i++ {
+		fmt.Fprintf(&a, "a%d\n", i)
+		fmt.Fprintf(&b, "b%d\n", i)
+	}
+	lines := Lines("same\n"+a.String()+"end\n", "same\n"+b.String()+"end\n")
+	if len(lines) != 100002 || lines[0].Op != Equal || lines[1].Op != Delete || lines[50001].Op != Insert || lines[100001].Op != Equal {
+		t.Errorf("unexpected diff of %d lines", len(lines))
+	}
+}
+
+// sides rebuilds both inputs from a diff
+func sides(lines []Line) (string, string) {
+	var from, to strings.Builder
+	for _, l := range lines {
+		if l.Op != Insert {
+			from.WriteString(l.Text + "\n")
+		}
+		if l.Op != Delete {
+			to.WriteString(l.Text + "\n")
+		}
+	}
+	return from.String(), to.String()
+}
+
+func countEdits(lines []Line) int {
+	edits := 0
+	for _, l := range lines {
+		if l.Op != Equal {
+			edits++
+		}
+	}
+	return edits
+}
+
+// lcsLength is the length of the longest common subsequence (the reference for a minimal diff)
+func lcsLength(x, y []string) int {
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return lcs[0][0]
+}
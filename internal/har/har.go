@@ -0,0 +1,261 @@
+// Package har converts recorded traffic to HTTP Archive (HAR 1.2) logs, which browser
+// devtools and most HTTP tools can open
+package har
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// Version is the HAR format version written
+const Version = "1.2"
+
+// HAR is the top-level HAR document
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log holds the recorded entries
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator names the application that wrote the log
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is one request/response pair
+// Fields starting with an underscore are Mockingbird's own (allowed by the spec)
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Time            float64   `json:"time"` // Total time in milliseconds
+	Request         Request   `json:"request"`
+	Response        Response  `json:"response"`
+	Cache           struct{}  `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	ID              string    `json:"_id,omitempty"`        // Traffic entry ID
+	Service         string    `json:"_service,omitempty"`   // Service the request was routed to
+	RuleType        string    `json:"_ruleType,omitempty"`  // "proxy", "mock", "timeout", ...
+	RuleID          string    `json:"_ruleId,omitempty"`    // ID of the matched rule
+	Workspace       string    `json:"_workspace,omitempty"` // Workspace whose rule matched
+}
+
+// Request is a HAR request
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// Response is a HAR response
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+// NameValue is a header or query parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Cookie is a request or response cookie (cookies stay in the headers; these are never written)
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is a request body
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// Content is a response body
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary bodies
+}
+
+// Timings breaks down an entry's time in milliseconds (-1 when not applicable)
+// Mockingbird only knows the total, so it is all reported as waiting
+type Timings struct {
+	Blocked float64 `json:"blocked,omitempty"`
+	DNS     float64 `json:"dns,omitempty"`
+	Connect float64 `json:"connect,omitempty"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl,omitempty"`
+}
+
+// Options controls how traffic is converted
+type Options struct {
+	BaseURL        string // Scheme and host for request URLs, e.g. "http://localhost:6625"
+	CreatorVersion string // Mockingbird version recorded as the creator
+}
+
+// FromTraffic converts traffic entries to a HAR log, in the order given
+// Values are exported as recorded, so masked config values stay masked
+func FromTraffic(entries []models.TrafficEntry, opts Options) *HAR {
+	version := opts.CreatorVersion
+	if version == "" {
+		version = "dev"
+	}
+
+	log := Log{
+		Version: Version,
+		Creator: Creator{Name: "Mockingbird", Version: version},
+		Entries: make([]Entry, 0, len(entries)),
+	}
+	for i := range entries {
+		log.Entries = append(log.Entries, fromEntry(&entries[i], opts.BaseURL))
+	}
+	return &HAR{Log: log}
+}
+
+// fromEntry converts one traffic entry
+func fromEntry(entry *models.TrafficEntry, baseURL string) Entry {
+	base := strings.TrimSuffix(baseURL, "/")
+	if entry.Host != "" {
+		base = "http://" + entry.Host
+	}
+	requestURL := base + entry.Path
+	if len(entry.QueryParams) > 0 {
+		requestURL += "?" + url.Values(entry.QueryParams).Encode()
+	}
+
+	request := Request{
+		Method:      entry.Method,
+		URL:         requestURL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []Cookie{},
+		Headers:     multiValues(entry.Headers),
+		QueryString: multiValues(entry.QueryParams),
+		HeadersSize: -1,
+	}
+	if text := bodyText(entry.Body); text != "" {
+		mimeType := firstValue(entry.Headers, "Content-Type")
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+			if _, ok := entry.Body.(string); !ok {
+				mimeType = "application/json"
+			}
+		}
+		request.PostData = &PostData{MimeType: mimeType, Text: text}
+		request.BodySize = len(text)
+	}
+
+	response := Response{
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []Cookie{},
+		Headers:     []NameValue{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	var elapsed float64
+	if entry.Response != nil {
+		response.Status = entry.Response.StatusCode
+		response.StatusText = http.StatusText(entry.Response.StatusCode)
+		response.Headers = singleValues(entry.Response.Headers)
+		response.Content = Content{
+			Size:     len(entry.Response.Body),
+			MimeType: entry.Response.Headers["Content-Type"],
+			Text:     entry.Response.Body,
+		}
+		response.BodySize = len(entry.Response.Body)
+		response.RedirectURL = entry.Response.Headers["Location"]
+		elapsed = float64(entry.Response.DelayMS)
+	}
+
+	return Entry{
+		StartedDateTime: entry.Timestamp,
+		Time:            elapsed,
+		Request:         request,
+		Response:        response,
+		Timings:         Timings{Wait: elapsed},
+		ID:              entry.ID,
+		Service:         entry.Service,
+		RuleType:        entry.RuleType,
+		RuleID:          entry.MatchedRuleID,
+		Workspace:       entry.MatchedWorkspace,
+	}
+}
+
+// bodyText returns a recorded request body as text (JSON bodies are re-encoded)
+func bodyText(body interface{}) string {
+	switch b := body.(type) {
+	case nil:
+		return ""
+	case string:
+		return b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+}
+
+// multiValues flattens headers or query parameters, sorted by name
+func multiValues(values map[string][]string) []NameValue {
+	result := []NameValue{}
+	for _, name := range sortedKeys(values) {
+		for _, value := range values[name] {
+			result = append(result, NameValue{Name: name, Value: value})
+		}
+	}
+	return result
+}
+
+// singleValues flattens response headers, sorted by name
+func singleValues(values map[string]string) []NameValue {
+	result := []NameValue{}
+	for _, name := range sortedKeys(values) {
+		result = append(result, NameValue{Name: name, Value: values[name]})
+	}
+	return result
+}
+
+// firstValue returns the first value of a header
+func firstValue(values map[string][]string, name string) string {
+	if v := values[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+package har
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestFromTraffic(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []models.TrafficEntry{
+		{
+			ID:          "req-1",
+			Timestamp:   started,
+			Service:     "servicex",
+			Method:      "POST",
+			Path:        "/servicex/users",
+			QueryParams: map[string][]string{"page": {"2"}, "tag": {"a", "b"}},
+			Headers: map[string][]string{
+				"X-Api-Key":    {"SERVICEX_KEY"}, // masked when recorded
+				"Content-Type": {"application/json"},
+			},
+			Body: map[string]interface{}{"name": "Ada"},
+			Response: &models.Response{
+				StatusCode: 201,
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       `{"id":42}`,
+				DelayMS:    150,
+			},
+			RuleType:      "proxy",
+			MatchedRuleID: "create-user",
+		},
+		{
+			ID:        "req-2",
+			Timestamp: started.Add(time.Second),
+			Service:   "servicex",
+			Method:    "GET",
+			Path:      "/servicex/health",
+			Host:      "api.servicex.test",
+		},
+	}
+
+	log := FromTraffic(entries, Options{BaseURL: "http://localhost:6625/w/team-a/", CreatorVersion: "v1.2.0"})
+	if log.Log.Version != "1.2" || log.Log.Creator.Version != "v1.2.0" || len(log.Log.Entries) != 2 {
+		t.Fatalf("log = %+v", log.Log)
+	}
+
+	tests := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"url", log.Log.Entries[0].Request.URL, "http://localhost:6625/w/team-a/servicex/users?page=2&tag=a&tag=b"},
+		{"host routed url", log.Log.Entries[1].Request.URL, "http://api.servicex.test/servicex/health"},
+		{"query string", len(log.Log.Entries[0].Request.QueryString), 3},
+		{"headers sorted", log.Log.Entries[0].Request.Headers[0].Name, "Content-Type"},
+		{"masked value kept", log.Log.Entries[0].Request.Headers[1].Value, "SERVICEX_KEY"},
+		{"request body", log.Log.Entries[0].Request.PostData.Text, `{"name":"Ada"}`},
+		{"request mime type", log.Log.Entries[0].Request.PostData.MimeType, "application/json"},
+		{"no request body", log.Log.Entries[1].Request.PostData == nil, true},
+		{"status", log.Log.Entries[0].Response.StatusText, "Created"},
+		{"response body", log.Log.Entries[0].Response.Content.Text, `{"id":42}`},
+		{"time", log.Log.Entries[0].Time, 150.0},
+		{"wait", log.Log.Entries[0].Timings.Wait, 150.0},
+		{"rule", log.Log.Entries[0].RuleID, "create-user"},
+		{"no response", log.Log.Entries[1].Response.Status, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("got %v, expected %v", tt.got, tt.expected)
+			}
+		})
+	}
+
+	// Required arrays are present even when empty
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{`"cookies":[]`, `"headers":[]`, `"cache":{}`, `"startedDateTime":"2026-01-01T12:00:00Z"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("HAR is missing %s", field)
+		}
+	}
+}
+
+func TestToEntry(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	request := func(method, rawURL string) Request {
+		return Request{
+			Method: method,
+			URL:    rawURL,
+			Headers: []NameValue{
+				{Name: ":authority", Value: "api.stripe.com"},
+				{Name: "accept", Value: "application/json"},
+			},
+		}
+	}
+	response := Response{
+		Status: 200,
+		Headers: []NameValue{
+			{Name: "content-type", Value: "application/json"},
+			{Name: "content-encoding", Value: "br"},
+		},
+		Content: Content{Text: `{"ok":true}`},
+	}
+
+	tests := []struct {
+		name    string
+		entry   Entry
+		groupBy string
+		service string
+		path    string
+		err     string
+	}{
+		{"by host", Entry{Request: request("get", "https://www.api.stripe.com/v1/customers?limit=3")}, GroupByHost, "api-stripe-com", "/api-stripe-com/v1/customers", ""},
+		{"by path", Entry{Request: request("GET", "http://localhost:8080/billing/invoices")}, GroupByPath, "billing", "/billing/invoices", ""},
+		{"exported by mockingbird", Entry{Request: request("GET", "http://localhost:6625/w/team-a/servicex/users"), Service: "servicex"}, GroupByHost, "servicex", "/servicex/users", ""},
+		{"no path segment", Entry{Request: request("GET", "http://localhost:8080/")}, GroupByPath, "", "", "no service in path"},
+		{"reserved path segment", Entry{Request: request("GET", "http://localhost:8080/_service/x")}, GroupByPath, "", "", "reserved service name"},
+		{"reserved exported service", Entry{Request: request("GET", "http://localhost:6625/_profiles/x"), Service: "_profiles"}, GroupByHost, "", "", "reserved service name"},
+		{"dot path segment", Entry{Request: request("GET", "http://localhost:8080/../x")}, GroupByPath, "", "", "invalid service name"},
+		{"data url", Entry{Request: request("GET", "data:image/png;base64,AAAA")}, GroupByHost, "", "", "unsupported URL scheme"},
+		{"base64 text body", Entry{Request: request("GET", "https://api.stripe.com/v1/ping"), Response: Response{Status: 200, Content: Content{Text: "cG9uZw==", Encoding: "base64"}}}, GroupByHost, "api-stripe-com", "/api-stripe-com/v1/ping", ""},
+		{"binary body", Entry{Request: request("GET", "https://cdn.test/logo.png"), Response: Response{Status: 200, Content: Content{Text: "iVBORw0KGgr/", Encoding: "base64", MimeType: "image/png"}}}, GroupByHost, "", "", "binary response body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.entry.StartedDateTime = started
+			if tt.entry.Response.Status == 0 {
+				tt.entry.Response = response
+			}
+			entry, err := ToEntry(&tt.entry, tt.groupBy)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ToEntry() error = %v, expected %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.Service != tt.service || entry.Path != tt.path {
+				t.Errorf("service, path = %s, %s, expected %s, %s", entry.Service, entry.Path, tt.service, tt.path)
+			}
+			if entry.Method != "GET" || !entry.Timestamp.Equal(started) {
+				t.Errorf("method, timestamp = %s, %v", entry.Method, entry.Timestamp)
+			}
+			if _, ok := entry.Headers[":authority"]; ok || entry.Headers["Accept"][0] != "application/json" {
+				t.Errorf("headers = %v", entry.Headers)
+			}
+			if _, ok := entry.Response.Headers["Content-Encoding"]; ok {
+				t.Errorf("Content-Encoding should be dropped (bodies are decoded): %v", entry.Response.Headers)
+			}
+		})
+	}
+}
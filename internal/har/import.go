@@ -0,0 +1,204 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// How imported entries are grouped into services
+const (
+	GroupByHost = "host" // One service per host (api.stripe.com -> api-stripe-com)
+	GroupByPath = "path" // The first path segment is the service, as for proxied requests
+)
+
+// droppedResponseHeaders no longer describe a recorded body: HAR bodies are already
+// decoded and de-chunked, and the length is recomputed when a mock is served
+var droppedResponseHeaders = map[string]bool{
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+}
+
+// serviceNameChars matches runs of characters not allowed in a service name derived from a host
+var serviceNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Skipped is a HAR entry that wasn't imported
+type Skipped struct {
+	Index  int    `json:"index"` // Position in the HAR's entries
+	URL    string `json:"url"`
+	Reason string `json:"reason"`
+}
+
+// Parse reads a HAR document
+func Parse(data []byte) (*HAR, error) {
+	var h HAR
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+	if h.Log.Entries == nil {
+		return nil, fmt.Errorf("invalid HAR: no log.entries")
+	}
+	return &h, nil
+}
+
+// ToEntry converts a HAR entry to a traffic entry, assigning it to a service by host or
+// by path (groupBy); entries Mockingbird exported keep their service
+// Entries that can't be recorded (e.g. data: URLs or binary responses) return an error
+func ToEntry(e *Entry, groupBy string) (models.TrafficEntry, error) {
+	u, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return models.TrafficEntry{}, fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return models.TrafficEntry{}, fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	service, path, err := serviceAndPath(e, u, groupBy)
+	if err != nil {
+		return models.TrafficEntry{}, err
+	}
+
+	entry := models.TrafficEntry{
+		ID:            e.ID,
+		Timestamp:     e.StartedDateTime,
+		Service:       service,
+		Method:        strings.ToUpper(e.Request.Method),
+		Path:          path,
+		QueryParams:   u.Query(),
+		Headers:       make(map[string][]string),
+		RuleType:      e.RuleType,
+		MatchedRuleID: e.RuleID,
+	}
+	for _, header := range e.Request.Headers {
+		// HTTP/2 pseudo headers (:authority, :path, ...) aren't real headers
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		name := http.CanonicalHeaderKey(header.Name)
+		entry.Headers[name] = append(entry.Headers[name], header.Value)
+	}
+	if e.Request.PostData != nil && e.Request.PostData.Text != "" {
+		entry.Body = parseBody(e.Request.PostData.Text)
+	}
+
+	if e.Response.Status > 0 {
+		response := &models.Response{
+			StatusCode: e.Response.Status,
+			Headers:    make(map[string]string),
+			DelayMS:    int64(e.Time),
+		}
+		// The server's share of the time, if the browser recorded it
+		if e.Timings.Wait > 0 {
+			response.DelayMS = int64(e.Timings.Wait)
+		}
+		for _, header := range e.Response.Headers {
+			name := http.CanonicalHeaderKey(header.Name)
+			if strings.HasPrefix(header.Name, ":") || droppedResponseHeaders[name] {
+				continue
+			}
+			// Headers are single valued in recorded traffic; keep the first
+			if _, ok := response.Headers[name]; !ok {
+				response.Headers[name] = header.Value
+			}
+		}
+		body, err := contentText(e.Response.Content)
+		if err != nil {
+			return models.TrafficEntry{}, err
+		}
+		response.Body = body
+		entry.Response = response
+	}
+
+	return entry, nil
+}
+
+// serviceAndPath picks the service for an entry and the recorded path (which, as for
+// proxied traffic, starts with the service name)
+func serviceAndPath(e *Entry, u *url.URL, groupBy string) (string, string, error) {
+	urlPath := u.Path
+	if urlPath == "" {
+		urlPath = "/"
+	}
+
+	// Exported by Mockingbird: the URL has the service as a path segment
+	if e.Service != "" {
+		if i := strings.Index(urlPath+"/", "/"+e.Service+"/"); i >= 0 {
+			if err := checkService(e.Service); err != nil {
+				return "", "", err
+			}
+			return e.Service, urlPath[i:], nil
+		}
+	}
+
+	switch groupBy {
+	case GroupByPath:
+		segment := strings.SplitN(strings.TrimPrefix(urlPath, "/"), "/", 2)[0]
+		if segment == "" {
+			return "", "", fmt.Errorf("no service in path %q", urlPath)
+		}
+		if err := checkService(segment); err != nil {
+			return "", "", err
+		}
+		return segment, urlPath, nil
+	case GroupByHost, "":
+		service := hostService(u.Hostname())
+		if service == "" {
+			return "", "", fmt.Errorf("no host in URL")
+		}
+		return service, "/" + service + urlPath, nil
+	default:
+		return "", "", fmt.Errorf("unknown grouping %q", groupBy)
+	}
+}
+
+// checkService rejects service names that can't have a rules file of their own; names
+// starting with _ are reserved for workspace files such as _rules/_service.yaml
+func checkService(service string) error {
+	if service == "." || service == ".." || strings.ContainsAny(service, "/\\") {
+		return fmt.Errorf("invalid service name %q", service)
+	}
+	if strings.HasPrefix(service, "_") {
+		return fmt.Errorf("reserved service name %q", service)
+	}
+	return nil
+}
+
+// hostService derives a service name from a host name (www.api.example.com -> api-example-com)
+func hostService(host string) string {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	return strings.Trim(serviceNameChars.ReplaceAllString(host, "-"), "-")
+}
+
+// parseBody returns a request body the way the proxy records it: parsed JSON, or a string
+func parseBody(text string) interface{} {
+	var body interface{}
+	if err := json.Unmarshal([]byte(text), &body); err == nil {
+		return body
+	}
+	return text
+}
+
+// contentText returns a response body as text, decoding base64 content
+// Binary bodies (images, fonts, ...) can't be recorded and are reported as errors
+func contentText(content Content) (string, error) {
+	if content.Encoding != "base64" {
+		return content.Text, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(content.Text)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 response body: %w", err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("binary response body (%s)", content.MimeType)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,243 @@
+// Package lint statically checks a service's rules for mistakes that would
+// otherwise only show up at match time
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/dsl"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+)
+
+// Issue codes
+const (
+	CodeUnreachable     = "unreachable"      // An earlier rule always matches first
+	CodeInvalidRegex    = "invalid_regex"    // A body or query pattern doesn't compile
+	CodeInvalidTemplate = "invalid_template" // The response fails .mock or Go template parsing
+	CodeNoAction        = "no_action"        // The rule has neither proxyto nor response
+)
+
+// Issue severities
+const (
+	SeverityError   = "error"   // The rule is broken
+	SeverityWarning = "warning" // The rule works but probably not as intended
+)
+
+// Issue is a problem found in a rule
+type Issue struct {
+	Index      int    `json:"index"`                 // Position of the rule in the list that was checked
+	ID         string `json:"id,omitempty"`          // Rule ID
+	Origin     string `json:"origin,omitempty"`      // Where the rule came from (set by callers checking resolved rules)
+	Code       string `json:"code"`                  // One of the Code* constants
+	Severity   string `json:"severity"`              // "error" or "warning"
+	Message    string `json:"message"`               // Human readable description
+	ShadowedBy string `json:"shadowed_by,omitempty"` // ID of the earlier rule that always wins (unreachable only)
+}
+
+// Options tune the checks to the service's settings
+type Options struct {
+	DefaultUpstream bool // The service settings have a proxyto, so rules without an action proxy there
+}
+
+// Rules checks rules in match order and returns the issues found
+func Rules(rules []models.Rule, opts Options) []Issue {
+	issues := []Issue{}
+	add := func(i int, code, severity, message string) {
+		issues = append(issues, Issue{Index: i, ID: rules[i].ID, Code: code, Severity: severity, Message: message})
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+
+		if rule.Match.Body != nil && rule.Match.Body.Matches != "" {
+			if _, err := regexp.Compile(rule.Match.Body.Matches); err != nil {
+				add(i, CodeInvalidRegex, SeverityError, fmt.Sprintf("body pattern %q: %v", rule.Match.Body.Matches, err))
+			}
+		}
+		for _, key := range sortedKeys(rule.Match.Query) {
+			if _, err := regexp.Compile(rule.Match.Query[key]); err != nil {
+				add(i, CodeInvalidRegex, SeverityError, fmt.Sprintf("query %s pattern %q: %v", key, rule.Match.Query[key], err))
+			}
+		}
+
+		if rule.Response != "" {
+			if err := checkTemplate(rule.Response); err != nil {
+				add(i, CodeInvalidTemplate, SeverityError, err.Error())
+			}
+		}
+		if rule.ProxyTo == "" && rule.Response == "" && !opts.DefaultUpstream {
+			add(i, CodeNoAction, SeverityError, "rule has neither proxyto nor response")
+		}
+
+		if !active(rule) {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			earlier := &rules[j]
+			if !active(earlier) || bounded(earlier) || !covers(&earlier.Match, &rule.Match) {
+				continue
+			}
+			issues = append(issues, Issue{
+				Index:      i,
+				ID:         rule.ID,
+				Code:       CodeUnreachable,
+				Severity:   SeverityWarning,
+				Message:    fmt.Sprintf("never matches: rule %s always matches first", ruleName(earlier, j)),
+				ShadowedBy: earlier.ID,
+			})
+			break
+		}
+	}
+
+	return issues
+}
+
+// checkTemplate parses a .mock response and its header and body templates
+func checkTemplate(response string) error {
+	parsed, err := dsl.Parse(response)
+	if err != nil {
+		return fmt.Errorf("invalid .mock template: %w", err)
+	}
+	for _, key := range sortedKeys(parsed.Headers) {
+		if err := render.Check(parsed.Headers[key]); err != nil {
+			return fmt.Errorf("header %s: %w", key, err)
+		}
+	}
+	if err := render.Check(parsed.Body); err != nil {
+		return fmt.Errorf("body: %w", err)
+	}
+	return nil
+}
+
+// active reports whether a rule takes part in matching
+func active(rule *models.Rule) bool {
+	return rule.Enabled == nil || *rule.Enabled
+}
+
+// bounded reports whether a rule can stop matching on its own (time window or match limit),
+// so it can't permanently hide later rules
+func bounded(rule *models.Rule) bool {
+	return rule.ActiveFrom != nil || rule.ActiveUntil != nil || rule.MatchLimit() > 0
+}
+
+// ruleName identifies a rule in messages
+func ruleName(rule *models.Rule, index int) string {
+	if rule.ID != "" {
+		return rule.ID
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// covers reports whether every request matching b also matches a
+func covers(a, b *models.MatchCondition) bool {
+	return coversMethods(a.Method, b.Method) &&
+		coversPath(a.Path, b.Path) &&
+		coversExact(a.Headers, b.Headers, true) &&
+		coversBody(a.Body, b.Body) &&
+		coversExact(a.Query, b.Query, false)
+}
+
+// coversMethods reports whether methods a include every method of b
+func coversMethods(a, b []string) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, bm := range b {
+		found := false
+		for _, am := range a {
+			if strings.EqualFold(am, bm) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// coversPath reports whether path pattern a matches every path pattern b matches
+func coversPath(a, b string) bool {
+	if a == "" || a == b {
+		return true
+	}
+	if b == "" {
+		return false
+	}
+
+	// /servicex/** covers the prefix itself and anything below it
+	if strings.HasSuffix(a, "/**") {
+		prefix := strings.TrimSuffix(a, "/**")
+		return b == prefix || strings.HasPrefix(b, prefix+"/")
+	}
+
+	// Single segment wildcards (* or {param}) cover any one segment
+	if !strings.Contains(a, "/*") && !strings.Contains(a, "{") {
+		return false
+	}
+	aSegments := strings.Split(a, "/")
+	bSegments := strings.Split(b, "/")
+	if len(aSegments) != len(bSegments) {
+		return false
+	}
+	for i, seg := range aSegments {
+		if isSegmentWildcard(seg) {
+			if bSegments[i] == "" || bSegments[i] == "**" {
+				return false
+			}
+			continue
+		}
+		if seg != bSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isSegmentWildcard reports whether a path segment matches any single segment
+func isSegmentWildcard(seg string) bool {
+	return seg == "*" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"))
+}
+
+// coversExact reports whether conditions a are all required (with the same value) by b
+func coversExact(a, b map[string]string, foldKeys bool) bool {
+	for key, value := range a {
+		found := false
+		for bKey, bValue := range b {
+			if (bKey == key || (foldKeys && strings.EqualFold(bKey, key))) && bValue == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// coversBody reports whether body condition a is implied by b
+func coversBody(a, b *models.BodyMatch) bool {
+	if a == nil || a.Matches == "" {
+		return true
+	}
+	return b != nil && b.Matches == a.Matches
+}
+
+// sortedKeys returns a map's keys in order, so issues are reported consistently
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
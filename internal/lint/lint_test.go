@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestRules(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name     string
+		rules    []models.Rule
+		opts     Options
+		expected []string // "index:code" for each issue, in order
+	}{
+		{
+			name: "catch-all shadows a later specific rule",
+			rules: []models.Rule{
+				{ID: "all", Match: models.MatchCondition{Path: "/servicex/**"}, ProxyTo: "https://api.servicex.com"},
+				{ID: "users", Match: models.MatchCondition{Method: []string{"GET"}, Path: "/servicex/users"}, Response: "[200]"},
+			},
+			expected: []string{"1:unreachable"},
+		},
+		{
+			name: "specific rule before catch-all is fine",
+			rules: []models.Rule{
+				{ID: "users", Match: models.MatchCondition{Path: "/servicex/users"}, Response: "[200]"},
+				{ID: "all", Match: models.MatchCondition{Path: "/servicex/**"}, ProxyTo: "https://api.servicex.com"},
+			},
+		},
+		{
+			name: "param path shadows wildcard path of the same shape",
+			rules: []models.Rule{
+				{ID: "param", Match: models.MatchCondition{Path: "/servicex/users/{id}"}, Response: "[200]"},
+				{ID: "star", Match: models.MatchCondition{Path: "/servicex/users/*"}, Response: "[404]"},
+				{ID: "one", Match: models.MatchCondition{Path: "/servicex/users/42"}, Response: "[404]"},
+				{ID: "deeper", Match: models.MatchCondition{Path: "/servicex/users/42/posts"}, Response: "[404]"},
+			},
+			expected: []string{"1:unreachable", "2:unreachable"},
+		},
+		{
+			name: "narrower earlier conditions don't shadow",
+			rules: []models.Rule{
+				{ID: "post", Match: models.MatchCondition{Method: []string{"POST"}, Path: "/servicex/**"}, Response: "[201]"},
+				{ID: "header", Match: models.MatchCondition{Path: "/servicex/**", Headers: map[string]string{"X-Test": "1"}}, Response: "[500]"},
+				{ID: "body", Match: models.MatchCondition{Path: "/servicex/**", Body: &models.BodyMatch{Matches: "error"}}, Response: "[500]"},
+				{ID: "any", Match: models.MatchCondition{Path: "/servicex/users"}, Response: "[200]"},
+			},
+		},
+		{
+			name: "disabled and once rules don't shadow",
+			rules: []models.Rule{
+				{ID: "off", Enabled: &disabled, Match: models.MatchCondition{Path: "/servicex/**"}, Response: "[500]"},
+				{ID: "once", Once: true, Match: models.MatchCondition{Path: "/servicex/**"}, Response: "[503]"},
+				{ID: "users", Match: models.MatchCondition{Path: "/servicex/users"}, Response: "[200]"},
+			},
+		},
+		{
+			name: "invalid regexes",
+			rules: []models.Rule{
+				{ID: "body", Match: models.MatchCondition{Body: &models.BodyMatch{Matches: "(unclosed"}}, Response: "[200]"},
+				{ID: "query", Match: models.MatchCondition{Path: "/servicex/x", Query: map[string]string{"q": "[a-"}}, Response: "[200]"},
+			},
+			expected: []string{"0:invalid_regex", "1:invalid_regex"},
+		},
+		{
+			name: "invalid templates",
+			rules: []models.Rule{
+				{ID: "body", Match: models.MatchCondition{Path: "/a"}, Response: "[200]\nbody:\n{{.method"},
+				{ID: "func", Match: models.MatchCondition{Path: "/b"}, Response: "[200]\nheaders:\n  X-Id: {{nosuchfunc}}\nbody:\nok"},
+				{ID: "good", Match: models.MatchCondition{Path: "/c"}, Response: "[200]\nbody:\n{{reqBody \"user.name\"}} {{uuid}}"},
+			},
+			expected: []string{"0:invalid_template", "1:invalid_template"},
+		},
+		{
+			name: "rule without an action",
+			rules: []models.Rule{
+				{ID: "empty", Match: models.MatchCondition{Path: "/a"}},
+			},
+			expected: []string{"0:no_action"},
+		},
+		{
+			name: "rule without an action uses the service upstream",
+			rules: []models.Rule{
+				{ID: "empty", Match: models.MatchCondition{Path: "/a"}},
+			},
+			opts: Options{DefaultUpstream: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := Rules(tt.rules, tt.opts)
+			var got []string
+			for _, issue := range issues {
+				got = append(got, formatIssue(issue))
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Rules() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Rules() = %v, expected %v", got, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+func formatIssue(issue Issue) string {
+	return fmt.Sprintf("%d:%s", issue.Index, issue.Code)
+}
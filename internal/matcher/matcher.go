@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
 )
@@ -12,12 +14,18 @@ import (
 // Match finds the first matching rule for a request
 // Returns the matched rule and its index, or (nil, -1) if no match
 func Match(rules []models.Rule, ctx *models.RequestContext) (*models.Rule, int) {
+	now := time.Now()
 	for i, rule := range rules {
 		// Skip disabled rules (enabled defaults to true if not specified)
 		if rule.Enabled != nil && !*rule.Enabled {
 			continue
 		}
 
+		// Skip rules outside their activeFrom / activeUntil window
+		if rule.TimeStatus(now) != "" {
+			continue
+		}
+
 		if matchRule(&rule, ctx) {
 			return &rule, i
 		}
@@ -55,6 +63,44 @@ func matchRule(rule *models.Rule, ctx *models.RequestContext) bool {
 	return true
 }
 
+// Mismatches lists the conditions a request fails ("method", "path", "header <name>",
+// "body" or "query <name>"); an empty list means the request matches
+func Mismatches(cond *models.MatchCondition, ctx *models.RequestContext) []string {
+	var failed []string
+
+	if !matchMethod(cond.Method, ctx.Method) {
+		failed = append(failed, "method")
+	}
+	if !matchPath(cond.Path, ctx.Path) {
+		failed = append(failed, "path")
+	}
+	for _, key := range sortedKeys(cond.Headers) {
+		if !matchHeaders(map[string]string{key: cond.Headers[key]}, ctx.Headers) {
+			failed = append(failed, "header "+key)
+		}
+	}
+	if !matchBody(cond.Body, ctx.Body) {
+		failed = append(failed, "body")
+	}
+	for _, key := range sortedKeys(cond.Query) {
+		if !matchQuery(map[string]string{key: cond.Query[key]}, ctx.QueryParams) {
+			failed = append(failed, "query "+key)
+		}
+	}
+
+	return failed
+}
+
+// sortedKeys returns a map's keys in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // matchMethod checks if the request method matches
 func matchMethod(ruleMethods []string, reqMethod string) bool {
 	// If no methods specified, match any
@@ -71,6 +117,11 @@ func matchMethod(ruleMethods []string, reqMethod string) bool {
 	return false
 }
 
+// MatchPath checks a path against a rule path pattern (exact, /*, /** or {param})
+func MatchPath(pattern, path string) bool {
+	return matchPath(pattern, path)
+}
+
 // matchPath checks if the request path matches
 // Supports exact match and wildcard matching with **
 func matchPath(rulePath, reqPath string) bool {
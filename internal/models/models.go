@@ -2,24 +2,45 @@ package models
 
 import (
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // TrafficEntry represents a recorded request/response pair
 type TrafficEntry struct {
-	ID                 string              `json:"id"`
-	Timestamp          time.Time           `json:"timestamp"`
-	Service            string              `json:"service"`
-	Method             string              `json:"method"`
-	Path               string              `json:"path"`
-	QueryParams        map[string][]string `json:"query"`
-	Headers            map[string][]string `json:"headers"`
-	Body               interface{}         `json:"body"` // JSON object or string
-	Response           *Response           `json:"response,omitempty"`
-	MatchedRule             *int                `json:"matched_rule,omitempty"`               // Historical matched rule (may be stale after rule changes)
-	MatchedWorkspace        string              `json:"matched_workspace,omitempty"`          // Workspace where rule matched (may differ from request workspace due to fallback)
-	CurrentMatchedRule      *int                `json:"current_matched_rule,omitempty"`       // Current match with active rules (computed on-demand by API)
-	CurrentMatchedWorkspace string              `json:"current_matched_workspace,omitempty"`  // Current match workspace (computed on-demand by API)
-	RuleType                string              `json:"rule_type,omitempty"`                  // "proxy", "mock", or "timeout"
+	ID                       string              `json:"id"`
+	Timestamp                time.Time           `json:"timestamp"`
+	Service                  string              `json:"service"`
+	Method                   string              `json:"method"`
+	Path                     string              `json:"path"`
+	QueryParams              map[string][]string `json:"query"`
+	Headers                  map[string][]string `json:"headers"`
+	Body                     interface{}         `json:"body"`                       // JSON object or string
+	Host                     string              `json:"host,omitempty"`             // Request host (set when routed by the host routing table)
+	WorkspaceSource          string              `json:"workspace_source,omitempty"` // How the workspace was chosen ("path", "header:X-Mockingbird-Workspace", ...)
+	Session                  string              `json:"session,omitempty"`          // Test session from the X-Mockingbird-Session header
+	Response                 *Response           `json:"response,omitempty"`
+	MatchedRule              *int                `json:"matched_rule,omitempty"`                // Index of the matched rule at match time (may be stale after rule changes)
+	MatchedRuleID            string              `json:"matched_rule_id,omitempty"`             // ID of the matched rule (stable across reordering)
+	MatchedRuleOrigin        string              `json:"matched_rule_origin,omitempty"`         // Where the matched rule came from ("service" or "library:<name>"); the index is within that file
+	MatchedWorkspace         string              `json:"matched_workspace,omitempty"`           // Workspace where rule matched (may differ from request workspace due to fallback)
+	CurrentMatchedRule       *int                `json:"current_matched_rule,omitempty"`        // Current match with active rules (computed on-demand by API)
+	CurrentMatchedRuleID     string              `json:"current_matched_rule_id,omitempty"`     // ID of the current match (computed on-demand by API)
+	CurrentMatchedRuleOrigin string              `json:"current_matched_rule_origin,omitempty"` // Origin of the current match (computed on-demand by API)
+	CurrentMatchedWorkspace  string              `json:"current_matched_workspace,omitempty"`   // Current match workspace (computed on-demand by API)
+	RuleType                 string              `json:"rule_type,omitempty"`                   // "proxy", "mock", "timeout", "plugin", "cors", "passthrough" or "unmatched_mock"
+	UpstreamTLS              *UpstreamTLSInfo    `json:"upstream_tls,omitempty"`                // TLS settings used for the upstream connection (proxy rules only)
+}
+
+// UpstreamTLSInfo describes the TLS settings applied to a proxied request
+// Only describes the settings - certificate and key material is never recorded
+type UpstreamTLSInfo struct {
+	Source             string `json:"source"`                        // "rule" or "service"
+	ClientCert         bool   `json:"client_cert"`                   // Whether a client certificate was presented
+	ClientCertSubject  string `json:"client_cert_subject,omitempty"` // Subject of the presented client certificate
+	CustomCA           bool   `json:"custom_ca"`                     // Whether a custom CA bundle was used
+	ServerName         string `json:"server_name,omitempty"`         // SNI override
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
 }
 
 // Response represents an HTTP response
@@ -32,11 +53,69 @@ type Response struct {
 
 // Rule represents a single matching rule
 type Rule struct {
+	ID       string            `json:"id,omitempty" yaml:"id,omitempty"` // Stable ID (auto-assigned when missing)
 	Match    MatchCondition    `json:"match" yaml:"match"`
 	ProxyTo  string            `json:"proxyto,omitempty" yaml:"proxyto,omitempty"`   // Upstream URL
 	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`   // Headers to inject
 	Response string            `json:"response,omitempty" yaml:"response,omitempty"` // .mock template
 	Enabled  *bool             `json:"enabled,omitempty" yaml:"enabled,omitempty"`   // Whether rule is enabled (defaults to true)
+	Tags     []string          `json:"tags,omitempty" yaml:"tags,omitempty"`         // Labels profiles use to enable or disable the rule
+	TLS      *TLSConfig        `json:"tls,omitempty" yaml:"tls,omitempty"`           // Upstream TLS settings (overrides service settings)
+
+	ActiveFrom   *time.Time `json:"activeFrom,omitempty" yaml:"activeFrom,omitempty"`     // Rule is skipped before this time
+	ActiveUntil  *time.Time `json:"activeUntil,omitempty" yaml:"activeUntil,omitempty"`   // Rule expires at this time
+	ExpiresAfter int        `json:"expiresAfter,omitempty" yaml:"expiresAfter,omitempty"` // Rule expires after this many matches
+	Once         bool       `json:"once,omitempty" yaml:"once,omitempty"`                 // Shorthand for expiresAfter: 1
+
+	Examples []RuleExample `json:"examples,omitempty" yaml:"examples,omitempty"` // Sample requests checked by mockingbird test
+}
+
+// RuleExample is a sample request that must be answered by its rule (or, with noMatch, must not match it)
+type RuleExample struct {
+	Method  string            `json:"method,omitempty" yaml:"method,omitempty"`   // Defaults to GET
+	Path    string            `json:"path" yaml:"path"`                           // Full request path, e.g. /servicex/users/42
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Request headers
+	Query   map[string]string `json:"query,omitempty" yaml:"query,omitempty"`     // Query parameters
+	Body    string            `json:"body,omitempty" yaml:"body,omitempty"`       // Request body (parsed as JSON when it is JSON)
+	NoMatch bool              `json:"noMatch,omitempty" yaml:"noMatch,omitempty"` // The rule must not match this request
+}
+
+// Rule states reported by the admin API
+const (
+	RuleStatusScheduled = "scheduled" // activeFrom is in the future
+	RuleStatusExpired   = "expired"   // activeUntil has passed or the match limit is used up
+)
+
+// MatchLimit returns how many matches a rule allows (0 for unlimited)
+func (r *Rule) MatchLimit() int {
+	if r.ExpiresAfter > 0 {
+		return r.ExpiresAfter
+	}
+	if r.Once {
+		return 1
+	}
+	return 0
+}
+
+// TimeStatus reports whether a rule is scheduled or expired at t by its time window ("" if active)
+func (r *Rule) TimeStatus(t time.Time) string {
+	if r.ActiveUntil != nil && !t.Before(*r.ActiveUntil) {
+		return RuleStatusExpired
+	}
+	if r.ActiveFrom != nil && t.Before(*r.ActiveFrom) {
+		return RuleStatusScheduled
+	}
+	return ""
+}
+
+// TLSConfig defines TLS settings for connecting to an upstream
+// Cert, Key and CA accept PEM content, a file path, or a template such as {{ config `PARTNER_CERT` }}
+type TLSConfig struct {
+	Cert               string `json:"cert,omitempty" yaml:"cert,omitempty"`                                 // Client certificate (PEM)
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`                                   // Client private key (PEM)
+	CA                 string `json:"ca,omitempty" yaml:"ca,omitempty"`                                     // CA bundle used to verify the upstream (PEM)
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"`                   // SNI / verification name override
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"` // Skip upstream certificate verification
 }
 
 // MatchCondition defines criteria for matching requests
@@ -55,7 +134,114 @@ type BodyMatch struct {
 
 // ServiceRules represents all rules for a service
 type ServiceRules struct {
-	Rules []Rule `yaml:"rules"`
+	Settings *ServiceSettings `yaml:"settings,omitempty"`
+	Include  []Include        `yaml:"include,omitempty"` // Shared library rule sets, in priority order
+	Rules    []Rule           `yaml:"rules"`
+}
+
+// Include pulls the rules of a shared library ({ConfigDir}/_library/{name}.yaml) into a service
+// Written as a plain name (`- cors-preflight`) or as `{library: health, position: after}`
+type Include struct {
+	Library  string `json:"library" yaml:"library"`
+	Position string `json:"position,omitempty" yaml:"position,omitempty"` // "before" (default) or "after" the service's own rules
+}
+
+// Include positions
+const (
+	IncludeBefore = "before"
+	IncludeAfter  = "after"
+)
+
+// UnmarshalYAML accepts either a library name or a mapping
+func (inc *Include) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		inc.Library = value.Value
+		inc.Position = ""
+		return nil
+	}
+
+	type plain Include
+	return value.Decode((*plain)(inc))
+}
+
+// MarshalYAML writes an include with the default position as a plain name
+func (inc Include) MarshalYAML() (interface{}, error) {
+	if inc.Position == "" || inc.Position == IncludeBefore {
+		return inc.Library, nil
+	}
+
+	type plain Include
+	return plain(inc), nil
+}
+
+// ResolvedRule is a rule in a service's effective rule list (includes expanded,
+// enabled reflecting the active profile)
+type ResolvedRule struct {
+	Rule
+	Origin  string `json:"origin"`            // "service" or "library:<name>"
+	Index   int    `json:"index"`             // Index of the rule within the file it came from
+	Profile string `json:"profile,omitempty"` // Active profile that overrode the rule's enabled state
+	Status  string `json:"status,omitempty"`  // "scheduled" or "expired" ("" if active)
+	Hits    int    `json:"hits,omitempty"`    // Matches counted against the rule's limit (once / expiresAfter)
+}
+
+// Profile enables or disables rules by tag (disable wins when a rule has tags in both)
+type Profile struct {
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Enable      []string `json:"enable,omitempty" yaml:"enable,omitempty"`   // Tags whose rules are switched on
+	Disable     []string `json:"disable,omitempty" yaml:"disable,omitempty"` // Tags whose rules are switched off
+}
+
+// Profiles holds a workspace's named profiles and the active one (_rules/_profiles.yaml)
+type Profiles struct {
+	Active   string             `json:"active" yaml:"active,omitempty"`
+	Profiles map[string]Profile `json:"profiles" yaml:"profiles"`
+}
+
+// ServiceSettings holds defaults that apply to every rule of a service
+// Set in a service's rules file (settings:) or in the workspace's _rules/_service.yaml
+type ServiceSettings struct {
+	ProxyTo           string            `json:"proxyto,omitempty" yaml:"proxyto,omitempty"`                       // Default upstream for rules with neither proxyto nor response
+	Headers           map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`                       // Headers injected into every proxied request (rule headers win)
+	Delay             string            `json:"delay,omitempty" yaml:"delay,omitempty"`                           // Default latency, e.g. "250ms" (a .mock delay line wins)
+	Unmatched         string            `json:"unmatched,omitempty" yaml:"unmatched,omitempty"`                   // When no rule matches: "timeout" (504, default), "passthrough" or "mock"
+	UnmatchedResponse string            `json:"unmatched_response,omitempty" yaml:"unmatched_response,omitempty"` // .mock template used when unmatched is "mock"
+	CORS              *CORSPolicy       `json:"cors,omitempty" yaml:"cors,omitempty"`                             // Answer preflights and add CORS headers to every response
+	TLS               *TLSConfig        `json:"tls,omitempty" yaml:"tls,omitempty"`                               // Upstream TLS settings for proxy rules
+	Recording         *RecordingPolicy  `json:"recording,omitempty" yaml:"recording,omitempty"`                   // Whether and how the service's traffic is recorded
+}
+
+// RecordingPolicy controls how a service's traffic is recorded and how much of it is kept
+type RecordingPolicy struct {
+	Disabled   bool       `json:"disabled,omitempty" yaml:"disabled,omitempty"`       // Don't record the service's traffic at all (e.g. health checks)
+	SkipBodies bool       `json:"skip_bodies,omitempty" yaml:"skip_bodies,omitempty"` // Record requests without request and response bodies
+	SampleRate float64    `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"` // Fraction of requests recorded, e.g. 0.1 (0 or 1 records all)
+	Retention  *Retention `json:"retention,omitempty" yaml:"retention,omitempty"`     // How much of the service's traffic is kept
+}
+
+// Retention limits how much traffic is kept; the oldest entries go first
+// Zero values are unlimited (the global max_traffic_entries still applies)
+type Retention struct {
+	MaxEntries int    `json:"max_entries,omitempty" yaml:"max_entries,omitempty"` // Most entries kept
+	MaxAge     string `json:"max_age,omitempty" yaml:"max_age,omitempty"`         // Oldest entry kept, e.g. "24h"
+	MaxBytes   int64  `json:"max_bytes,omitempty" yaml:"max_bytes,omitempty"`     // Total size of the kept entries (as stored JSON)
+}
+
+// Unmatched behaviours
+const (
+	UnmatchedTimeout     = "timeout"
+	UnmatchedPassthrough = "passthrough"
+	UnmatchedMock        = "mock"
+)
+
+// CORSPolicy defines the CORS headers Mockingbird adds for a service
+type CORSPolicy struct {
+	AllowOrigins     []string `json:"allow_origins,omitempty" yaml:"allow_origins,omitempty"`         // Defaults to any origin ("*")
+	AllowMethods     []string `json:"allow_methods,omitempty" yaml:"allow_methods,omitempty"`         // Defaults to the common methods
+	AllowHeaders     []string `json:"allow_headers,omitempty" yaml:"allow_headers,omitempty"`         // Defaults to the headers the preflight asks for
+	ExposeHeaders    []string `json:"expose_headers,omitempty" yaml:"expose_headers,omitempty"`       // Response headers readable by the browser
+	AllowCredentials bool     `json:"allow_credentials,omitempty" yaml:"allow_credentials,omitempty"` // Send Access-Control-Allow-Credentials
+	MaxAge           int      `json:"max_age,omitempty" yaml:"max_age,omitempty"`                     // Preflight cache time in seconds
 }
 
 // ParsedTemplate represents a parsed .mock template
@@ -68,19 +254,61 @@ type ParsedTemplate struct {
 
 // RequestContext provides data for template rendering
 type RequestContext struct {
-	Method      string
-	Path        string
+	Method       string
+	Path         string
 	PathSegments []string
-	QueryParams map[string][]string
-	Headers     map[string][]string
-	Body        interface{} // JSON object or string
+	QueryParams  map[string][]string
+	Headers      map[string][]string
+	Body         interface{} // JSON object or string
 }
 
 // Workspace represents an isolated environment with its own rules and traffic
 type Workspace struct {
-	Name         string    `json:"name"`
-	Created      time.Time `json:"created"`
-	RuleCount    int       `json:"rule_count"`
-	TrafficCount int       `json:"traffic_count"`
-	BirdIcon     string    `json:"bird_icon"` // e.g., "bird01.svg"
+	Name         string     `json:"name"`
+	Created      time.Time  `json:"created"`
+	RuleCount    int        `json:"rule_count"`
+	TrafficCount int        `json:"traffic_count"`
+	BirdIcon     string     `json:"bird_icon"`             // e.g., "bird01.svg"
+	Parent       string     `json:"parent,omitempty"`      // Workspace this one falls back to ("" for default)
+	Ephemeral    bool       `json:"ephemeral,omitempty"`   // Created for a single test run
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`  // When an ephemeral workspace is purged
+	ChainError   string     `json:"chain_error,omitempty"` // Why the inheritance chain is broken (missing parent or cycle)
+}
+
+// RuleVersion is one version of a service's rules file
+type RuleVersion struct {
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`            // "api", "file" or "rollback:<version>"
+	Content   string    `json:"content,omitempty"` // Full YAML content (omitted in listings)
+	Size      int       `json:"size,omitempty"`    // Content size in bytes (listings only)
+}
+
+// ChangeEvent reports a change to rules or workspaces (streamed to the dashboard)
+type ChangeEvent struct {
+	Type      string    `json:"type"` // e.g. "rules.changed", "workspace.created"
+	Workspace string    `json:"workspace"`
+	Service   string    `json:"service,omitempty"`
+	Source    string    `json:"source,omitempty"`     // "api", "file" or "rollback:<version>"
+	Library   string    `json:"library,omitempty"`    // Shared library name (library events)
+	RenamedTo string    `json:"renamed_to,omitempty"` // New workspace name (workspace.renamed)
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RuleLoadError describes a rules file that failed to load (the last good rules stay active)
+type RuleLoadError struct {
+	Service string    `json:"service"`
+	File    string    `json:"file"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+}
+
+// DisabledService is an archived service rules file (service.yaml.disabled-<timestamp>)
+type DisabledService struct {
+	Workspace  string    `json:"workspace"`
+	Service    string    `json:"service"`
+	File       string    `json:"file"`
+	DisabledAt time.Time `json:"disabled_at"`
+	RuleCount  int       `json:"rule_count"`
 }
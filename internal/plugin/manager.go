@@ -440,6 +440,22 @@ func (m *Manager) HandleRequest(ctx *models.RequestContext) (*PluginResponse, er
 	return nil, nil // No plugin handled the request
 }
 
+// RoutePlugins returns the enabled plugins whose routes match a path, without running them
+// (each may still decline the request when it is handled)
+func (m *Manager) RoutePlugins(path string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var names []string
+	for _, plugin := range m.plugins {
+		if plugin.Enabled && plugin.matchesRoute(path) {
+			names = append(names, plugin.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // matchesRoute checks if a path matches any of the plugin's routes
 func (p *Plugin) matchesRoute(path string) bool {
 	for _, route := range p.Routes {
@@ -16,7 +16,6 @@ import (
 	"github.com/google/uuid"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/dsl"
-	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/plugin"
 	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
@@ -29,6 +28,7 @@ type Handler struct {
 	workspaceManager *store.WorkspaceManager
 	renderer         *render.Renderer
 	pluginManager    *plugin.Manager
+	transports       transportCache // TLS settings hash -> *cachedTransport
 }
 
 // NewHandler creates a new proxy handler
@@ -45,22 +45,11 @@ func NewHandler(cfg *config.Config, wm *store.WorkspaceManager, pm *plugin.Manag
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	// Parse workspace from URL: /w/{workspace}/{path}
-	workspace := "default" // default
-	path := r.URL.Path
-
-	if strings.HasPrefix(path, "/w/") {
-		// Extract workspace and strip prefix
-		parts := strings.SplitN(path[3:], "/", 2)
-		if len(parts) >= 1 && parts[0] != "" {
-			workspace = parts[0]
-			if len(parts) >= 2 {
-				path = "/" + parts[1]
-			} else {
-				path = "/"
-			}
-		}
-	}
+	// Work out workspace, service and path (host routes or /w/{workspace}/{path})
+	rt := h.resolveRoute(r)
+	workspace := rt.Workspace
+	path := rt.Path
+	service := rt.Service
 
 	// Get workspace store
 	st, err := h.workspaceManager.GetStore(workspace)
@@ -72,9 +61,6 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Update request path (strip workspace prefix)
 	r.URL.Path = path
 
-	// Extract service name from path
-	service := extractService(path)
-
 	// Parse request body
 	body := h.parseRequestBody(r)
 
@@ -88,8 +74,19 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Body:         body,
 	}
 
+	// Service settings from the closest workspace in the chain (CORS, unmatched behaviour and recording)
+	settings := h.workspaceManager.ServiceSettings(workspace, service)
+	preflight := false
+	if settings != nil && settings.CORS != nil {
+		if isPreflight(r) {
+			preflight = true
+		} else {
+			w = &corsWriter{ResponseWriter: w, policy: settings.CORS, origin: r.Header.Get("Origin")}
+		}
+	}
+
 	// Check if any plugin wants to handle this request
-	if h.pluginManager != nil {
+	if h.pluginManager != nil && !preflight {
 		pluginResp, err := h.pluginManager.HandleRequest(ctx)
 		if err != nil {
 			fmt.Printf("Plugin error: %v\n", err)
@@ -103,14 +100,17 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 			// Record traffic
 			entry := models.TrafficEntry{
-				ID:          uuid.New().String(),
-				Timestamp:   start,
-				Service:     service,
-				Method:      r.Method,
-				Path:        path,
-				QueryParams: r.URL.Query(),
-				Headers:     r.Header,
-				Body:        body,
+				ID:              uuid.New().String(),
+				Timestamp:       start,
+				Service:         service,
+				Method:          r.Method,
+				Path:            path,
+				QueryParams:     r.URL.Query(),
+				Headers:         r.Header,
+				Body:            body,
+				Host:            rt.Host,
+				WorkspaceSource: rt.WorkspaceSource,
+				Session:         rt.Session,
 				Response: &models.Response{
 					StatusCode: pluginResp.Status,
 					Headers:    pluginResp.Headers,
@@ -120,73 +120,80 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				RuleType: "plugin",
 			}
 			maskBackendKeys(&entry, h.config)
-			st.AddTraffic(entry)
+			st.RecordTraffic(entry, recordingPolicy(settings))
 			return
 		}
 	}
 
-	// Get rules for service
-	rules := st.GetRules(service)
-
-	// Match request against rules
-	rule, ruleIndex := matcher.Match(rules, ctx)
-	matchedWorkspace := workspace
-
-	// If no match in this workspace, fall back to default workspace
-	if rule == nil && workspace != "default" {
-		defaultStore, err := h.workspaceManager.GetStore("default")
-		if err == nil {
-			defaultRules := defaultStore.GetRules(service)
-			rule, ruleIndex = matcher.Match(defaultRules, ctx)
-			if rule != nil {
-				matchedWorkspace = "default"
-			}
-		}
-	}
-
+	// Match request against rules, walking up the workspace inheritance chain
+	// (the match counts against once / expiresAfter limits)
+	var match store.RuleMatch
 	var response *models.Response
 	var ruleType string
+	var tlsInfo *models.UpstreamTLSInfo
+
+	if preflight {
+		// CORS preflight answered from the service's policy
+		response = writePreflight(w, r, settings.CORS)
+		ruleType = "cors"
+	} else if match = h.workspaceManager.MatchRequest(workspace, service, ctx); match.Matched() {
+		// Rule matched: apply the service defaults of the workspace that matched
+		ruleSettings := match.Store.GetServiceSettings(service)
+		rule := applyServiceDefaults(match.Rule, ruleSettings)
 
-	if rule != nil {
-		// Rule matched
 		if rule.ProxyTo != "" {
-			// Proxy to upstream
-			response = h.handleProxy(w, r, rule, ctx)
+			// Proxy to upstream (TLS settings come from the workspace that matched)
+			opts := upstreamOptions{keepPath: rt.HostRouted, delay: settingsDelay(ruleSettings)}
+			opts.tls, opts.tlsSource = upstreamTLSConfig(match.Store, service, rule)
+			response, tlsInfo = h.handleProxy(w, r, rule, ctx, opts)
 			ruleType = "proxy"
 		} else if rule.Response != "" {
 			// Return mocked response
-			response = h.handleMock(w, r, rule, ctx)
+			response = h.handleMock(w, r, rule, ctx, settingsDelay(ruleSettings))
 			ruleType = "mock"
 		}
 	} else {
-		// No match - return 504 Gateway Timeout
-		response = h.handleTimeout(w, r)
-		ruleType = "timeout"
+		// No match - apply the service's unmatched behaviour (504 by default)
+		response, tlsInfo, ruleType = h.handleUnmatched(w, r, ctx, settings, rt.HostRouted)
 	}
 
 	// Record traffic
 	entry := models.TrafficEntry{
-		ID:          uuid.New().String(),
-		Timestamp:   start,
-		Service:     service,
-		Method:      r.Method,
-		Path:        path, // Use stripped path
-		QueryParams: r.URL.Query(),
-		Headers:     r.Header,
-		Body:        body,
-		Response:    response,
-		RuleType:    ruleType,
+		ID:              uuid.New().String(),
+		Timestamp:       start,
+		Service:         service,
+		Method:          r.Method,
+		Path:            path, // Use stripped path
+		QueryParams:     r.URL.Query(),
+		Headers:         r.Header,
+		Body:            body,
+		Host:            rt.Host,
+		WorkspaceSource: rt.WorkspaceSource,
+		Session:         rt.Session,
+		Response:        response,
+		RuleType:        ruleType,
+		UpstreamTLS:     tlsInfo,
 	}
 
-	if ruleIndex >= 0 {
-		entry.MatchedRule = &ruleIndex
-		entry.MatchedWorkspace = matchedWorkspace
+	if match.Matched() {
+		entry.MatchedRule = &match.Index
+		entry.MatchedRuleID = match.Rule.ID
+		entry.MatchedRuleOrigin = match.Origin
+		entry.MatchedWorkspace = match.Workspace
 	}
 
 	// Mask backend keys before storing (replace config values with key names)
 	maskBackendKeys(&entry, h.config)
 
-	st.AddTraffic(entry)
+	st.RecordTraffic(entry, recordingPolicy(settings))
+}
+
+// recordingPolicy returns the service's recording policy (nil records everything)
+func recordingPolicy(settings *models.ServiceSettings) *models.RecordingPolicy {
+	if settings == nil {
+		return nil
+	}
+	return settings.Recording
 }
 
 // extractService extracts the service name from the path
@@ -224,8 +231,69 @@ func (h *Handler) parseRequestBody(r *http.Request) interface{} {
 	return string(bodyBytes)
 }
 
+// prepareUpstream works out the request a proxy rule sends upstream and returns its URL:
+// the request path (without its service prefix, unless keepPath) is joined to the
+// target's path and the request's query appended to the target's. The header is
+// prepared in place, dropping hop-by-hop headers and setting the rule's headers
+// Shared by handleProxy and Simulate, so a simulation shows what is actually sent
+func (h *Handler) prepareUpstream(target *url.URL, rule *models.Rule, ctx *models.RequestContext, rawQuery string, header http.Header, keepPath bool) *url.URL {
+	path := ctx.Path
+	if !keepPath {
+		path = strings.TrimPrefix(path, "/"+extractService(path))
+	}
+	upstream := *target
+	upstream.Path = joinURLPath(target.Path, path)
+	upstream.RawPath = ""
+	if target.RawQuery == "" || rawQuery == "" {
+		upstream.RawQuery = target.RawQuery + rawQuery
+	} else {
+		upstream.RawQuery = target.RawQuery + "&" + rawQuery
+	}
+
+	// Remove hop-by-hop headers that cause issues with HTTPS proxying
+	// The h2c upgrade is invalid for HTTPS targets (they use ALPN instead)
+	header.Del("Upgrade")
+	header.Del("Connection")
+	header.Del("Http2-Settings")
+
+	// Inject headers from rule
+	for key, value := range rule.Headers {
+		// Render header value with templates
+		renderedValue, err := h.renderer.Render(value, ctx)
+		if err != nil {
+			fmt.Printf("Error rendering header %s: %v\n", key, err)
+			renderedValue = value
+		}
+		header.Set(key, renderedValue)
+	}
+
+	return &upstream
+}
+
+// joinURLPath joins an upstream base path and a request path like httputil.ReverseProxy
+func joinURLPath(base, path string) string {
+	switch {
+	case base == "":
+		return path
+	case strings.HasSuffix(base, "/") && strings.HasPrefix(path, "/"):
+		return base + path[1:]
+	case !strings.HasSuffix(base, "/") && !strings.HasPrefix(path, "/"):
+		return base + "/" + path
+	}
+	return base + path
+}
+
+// upstreamOptions holds per-request settings for proxying upstream
+type upstreamOptions struct {
+	tls       *models.TLSConfig // Upstream TLS settings (nil for defaults)
+	tlsSource string            // Where the TLS settings came from ("rule" or "service")
+	keepPath  bool              // Forward the path as-is (host routed requests have no service prefix)
+	delay     time.Duration     // Added latency before proxying (service default)
+}
+
 // handleProxy proxies the request to upstream
-func (h *Handler) handleProxy(w http.ResponseWriter, r *http.Request, rule *models.Rule, ctx *models.RequestContext) *models.Response {
+// Returns the recorded response and a description of the upstream TLS settings (nil if none)
+func (h *Handler) handleProxy(w http.ResponseWriter, r *http.Request, rule *models.Rule, ctx *models.RequestContext, opts upstreamOptions) (*models.Response, *models.UpstreamTLSInfo) {
 	// Replace localhost with container URL if running in Docker
 	proxyTo := replaceLocalhostURL(rule.ProxyTo)
 
@@ -242,45 +310,51 @@ func (h *Handler) handleProxy(w http.ResponseWriter, r *http.Request, rule *mode
 		return &models.Response{
 			StatusCode: http.StatusInternalServerError,
 			Body:       "Invalid upstream URL",
-		}
+		}, nil
 	}
 
 	// Create reverse proxy
 	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
 
+	// Apply upstream TLS settings (client certificate, CA bundle, SNI)
+	var tlsInfo *models.UpstreamTLSInfo
+	if opts.tls != nil {
+		transport, info, err := h.transportFor(opts.tls, opts.tlsSource, ctx)
+		if err != nil {
+			fmt.Printf("Error configuring upstream TLS: %v\n", err)
+			body := fmt.Sprintf("Invalid upstream TLS configuration: %v", err)
+			http.Error(w, body, http.StatusBadGateway)
+			return &models.Response{
+				StatusCode: http.StatusBadGateway,
+				Body:       body,
+			}, &models.UpstreamTLSInfo{Source: opts.tlsSource}
+		}
+		proxy.Transport = transport
+		tlsInfo = info
+	}
+
 	// Modify request
 	originalDirector := proxy.Director
+	rawQuery := r.URL.RawQuery
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
 
-		// Remove service prefix from path
-		service := extractService(req.URL.Path)
-		req.URL.Path = strings.TrimPrefix(req.URL.Path, "/"+service)
-
-		// Remove hop-by-hop headers that cause issues with HTTPS proxying
-		// The h2c upgrade is invalid for HTTPS targets (they use ALPN instead)
-		req.Header.Del("Upgrade")
-		req.Header.Del("Connection")
-		req.Header.Del("Http2-Settings")
+		upstream := h.prepareUpstream(upstreamURL, rule, ctx, rawQuery, req.Header, opts.keepPath)
+		req.URL.Path = upstream.Path
+		req.URL.RawPath = ""
+		req.URL.RawQuery = upstream.RawQuery
 
 		// Set Host header to match the target for proper routing
 		req.Host = req.URL.Host
-
-		// Inject headers from rule
-		for key, value := range rule.Headers {
-			// Render header value with templates
-			renderedValue, err := h.renderer.Render(value, ctx)
-			if err != nil {
-				fmt.Printf("Error rendering header %s: %v\n", key, err)
-				renderedValue = value
-			}
-			req.Header.Set(key, renderedValue)
-		}
 	}
 
 	// Capture response
 	rec := &responseRecorder{ResponseWriter: w, statusCode: 200, body: &strings.Builder{}}
 
+	if opts.delay > 0 {
+		time.Sleep(opts.delay)
+	}
+
 	start := time.Now()
 	proxy.ServeHTTP(rec, r)
 	duration := time.Since(start)
@@ -303,11 +377,12 @@ func (h *Handler) handleProxy(w http.ResponseWriter, r *http.Request, rule *mode
 		Headers:    flattenHeaders(rec.Header()),
 		Body:       body,
 		DelayMS:    duration.Milliseconds(),
-	}
+	}, tlsInfo
 }
 
 // handleMock returns a mocked response
-func (h *Handler) handleMock(w http.ResponseWriter, r *http.Request, rule *models.Rule, ctx *models.RequestContext) *models.Response {
+// defaultDelay (the service default) applies when the template has no delay line
+func (h *Handler) handleMock(w http.ResponseWriter, r *http.Request, rule *models.Rule, ctx *models.RequestContext, defaultDelay time.Duration) *models.Response {
 	// Parse .mock template
 	parsed, err := dsl.Parse(rule.Response)
 	if err != nil {
@@ -321,6 +396,8 @@ func (h *Handler) handleMock(w http.ResponseWriter, r *http.Request, rule *model
 	// Apply delay if specified
 	if parsed.Delay > 0 {
 		time.Sleep(parsed.Delay)
+	} else if defaultDelay > 0 {
+		time.Sleep(defaultDelay)
 	}
 
 	// Render headers
@@ -354,6 +431,40 @@ func (h *Handler) handleMock(w http.ResponseWriter, r *http.Request, rule *model
 	}
 }
 
+// handleUnmatched applies a service's unmatched behaviour when no rule matched:
+// a 504 (default), a pass-through to the service's default upstream, or a custom .mock
+// Returns the response, upstream TLS info and the rule type to record
+func (h *Handler) handleUnmatched(w http.ResponseWriter, r *http.Request, ctx *models.RequestContext, settings *models.ServiceSettings, keepPath bool) (*models.Response, *models.UpstreamTLSInfo, string) {
+	delay := settingsDelay(settings)
+
+	if settings != nil {
+		switch settings.Unmatched {
+		case models.UnmatchedPassthrough:
+			if settings.ProxyTo == "" {
+				fmt.Printf("Warning: unmatched is passthrough but the service has no default proxyto\n")
+				break
+			}
+			rule := &models.Rule{ProxyTo: settings.ProxyTo, Headers: settings.Headers}
+			opts := upstreamOptions{keepPath: keepPath, delay: delay, tls: settings.TLS}
+			if opts.tls != nil {
+				opts.tlsSource = "service"
+			}
+			response, tlsInfo := h.handleProxy(w, r, rule, ctx, opts)
+			return response, tlsInfo, "passthrough"
+
+		case models.UnmatchedMock:
+			rule := &models.Rule{Response: settings.UnmatchedResponse}
+			return h.handleMock(w, r, rule, ctx, delay), nil, "unmatched_mock"
+		}
+	}
+
+	// No match - return 504 Gateway Timeout
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return h.handleTimeout(w, r), nil, "timeout"
+}
+
 // handleTimeout returns a 504 Gateway Timeout
 func (h *Handler) handleTimeout(w http.ResponseWriter, r *http.Request) *models.Response {
 	w.WriteHeader(http.StatusGatewayTimeout)
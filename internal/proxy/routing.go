@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+)
+
+// route describes where an incoming proxy request is sent
+type route struct {
+	Workspace       string
+	WorkspaceSource string // "path", "header:<name>", "cookie:<name>", "query:<name>", "host" or "default"
+	Service         string
+	Path            string // Path used for matching (workspace prefix stripped)
+	Host            string // Request host when routed by the host table
+	HostRouted      bool   // Routed by Host header - path is kept as-is upstream
+	Session         string // Test session the request belongs to (SessionHeader)
+}
+
+// SessionHeader tags a request with a test session, so its traffic can be verified on its own
+// (the header is recorded with the traffic entry and not forwarded upstream)
+const SessionHeader = "X-Mockingbird-Session"
+
+// resolveRoute works out the workspace, service and path for a request
+// A matching host route wins; otherwise the path is parsed as /w/{workspace}/{service}/...
+// The workspace comes from (in order): the /w/ prefix, the configured selectors,
+// the host route, then "default". Selector headers and query params are removed
+// from the request so they are never forwarded upstream.
+func (h *Handler) resolveRoute(r *http.Request) route {
+	var rt route
+
+	if hr, host := matchHostRoute(h.config.GetHostRoutes(), r.Host); hr != nil {
+		rt = route{
+			Workspace:  hr.Workspace,
+			Service:    hr.Service,
+			Path:       r.URL.Path,
+			Host:       host,
+			HostRouted: true,
+		}
+		if rt.Workspace != "" {
+			rt.WorkspaceSource = "host"
+		}
+	} else {
+		// Parse workspace from URL: /w/{workspace}/{path}
+		path := r.URL.Path
+
+		if strings.HasPrefix(path, "/w/") {
+			// Extract workspace and strip prefix
+			parts := strings.SplitN(path[3:], "/", 2)
+			if len(parts) >= 1 && parts[0] != "" {
+				rt.Workspace = parts[0]
+				rt.WorkspaceSource = "path"
+				if len(parts) >= 2 {
+					path = "/" + parts[1]
+				} else {
+					path = "/"
+				}
+			}
+		}
+
+		rt.Service = extractService(path)
+		rt.Path = path
+	}
+
+	// Selectors are always evaluated so they can be stripped from the request,
+	// but only the first one present is used, and only if the URL didn't name a workspace
+	selected := rt.WorkspaceSource == "path"
+	for _, sel := range h.config.GetWorkspaceSelectors() {
+		value := takeSelector(r, sel)
+		if value == "" || selected {
+			continue
+		}
+		if err := store.ValidateWorkspaceName(value); err != nil {
+			fmt.Printf("Ignoring workspace from %s %s: %v\n", sel.Type, sel.Name, err)
+			continue
+		}
+		rt.Workspace = value
+		rt.WorkspaceSource = sel.Type + ":" + sel.Name
+		selected = true
+	}
+
+	if rt.Workspace == "" {
+		rt.Workspace = "default"
+		rt.WorkspaceSource = "default"
+	}
+
+	rt.Session = strings.TrimSpace(r.Header.Get(SessionHeader))
+	r.Header.Del(SessionHeader)
+
+	return rt
+}
+
+// takeSelector reads a workspace selector from the request and removes it
+// Returns an empty string if the selector is not present
+func takeSelector(r *http.Request, sel config.WorkspaceSelector) string {
+	switch strings.ToLower(sel.Type) {
+	case "header":
+		value := strings.TrimSpace(r.Header.Get(sel.Name))
+		r.Header.Del(sel.Name)
+		return value
+
+	case "query":
+		query := r.URL.Query()
+		if _, ok := query[sel.Name]; !ok {
+			return ""
+		}
+		value := strings.TrimSpace(query.Get(sel.Name))
+		query.Del(sel.Name)
+		r.URL.RawQuery = query.Encode()
+		return value
+
+	case "cookie":
+		cookie, err := r.Cookie(sel.Name)
+		if err != nil {
+			return ""
+		}
+		// Rebuild the Cookie header without the selector cookie
+		var kept []string
+		for _, c := range r.Cookies() {
+			if c.Name != sel.Name {
+				kept = append(kept, c.String())
+			}
+		}
+		r.Header.Del("Cookie")
+		if len(kept) > 0 {
+			r.Header.Set("Cookie", strings.Join(kept, "; "))
+		}
+		return strings.TrimSpace(cookie.Value)
+	}
+
+	return ""
+}
+
+// matchHostRoute returns the first host route matching the request host
+// Also returns the normalized host (lowercase, port stripped)
+func matchHostRoute(routes []config.HostRoute, requestHost string) (*config.HostRoute, string) {
+	if len(routes) == 0 {
+		return nil, ""
+	}
+
+	host := normalizeHost(requestHost)
+	for i := range routes {
+		if matchHost(routes[i].Host, host) {
+			return &routes[i], host
+		}
+	}
+	return nil, host
+}
+
+// matchHost checks if a host matches a pattern
+// "*.servicex.test" matches any subdomain of servicex.test (but not servicex.test itself)
+func matchHost(pattern, host string) bool {
+	pattern = normalizeHost(pattern)
+	if pattern == "" || host == "" {
+		return false
+	}
+
+	if pattern == "*" {
+		return true
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		suffix := pattern[1:] // ".servicex.test"
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+
+	return pattern == host
+}
+
+// normalizeHost lowercases a host and strips any port
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		host     string
+		expected bool
+	}{
+		{"api.stripe.local", "api.stripe.local", true},
+		{"api.stripe.local", "API.Stripe.Local", true},
+		{"api.stripe.local", "api.stripe.local:6625", true},
+		{"api.stripe.local", "stripe.local", false},
+		{"*.servicex.test", "api.servicex.test", true},
+		{"*.servicex.test", "a.b.servicex.test:8080", true},
+		{"*.servicex.test", "servicex.test", false},
+		{"*.servicex.test", "evilservicex.test", false},
+		{"*", "anything.example", true},
+		{"", "api.stripe.local", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"|"+tt.host, func(t *testing.T) {
+			if result := matchHost(tt.pattern, normalizeHost(tt.host)); result != tt.expected {
+				t.Errorf("matchHost(%q, %q) = %v, expected %v", tt.pattern, tt.host, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveRoute(t *testing.T) {
+	h := &Handler{config: &config.Config{HostRoutes: []config.HostRoute{
+		{Host: "api.stripe.local", Service: "stripe"},
+		{Host: "*.servicex.test", Service: "servicex", Workspace: "team"},
+	}}}
+
+	tests := []struct {
+		name       string
+		host       string
+		path       string
+		workspace  string
+		service    string
+		routedPath string
+		hostRouted bool
+	}{
+		{"host route keeps path", "api.stripe.local:6625", "/v1/customers", "default", "stripe", "/v1/customers", true},
+		{"wildcard host route with workspace", "eu.servicex.test", "/users/1", "team", "servicex", "/users/1", true},
+		{"path routing", "localhost:6625", "/servicex/users", "default", "servicex", "/servicex/users", false},
+		{"workspace prefix", "localhost:6625", "/w/dave/servicex/users", "dave", "servicex", "/servicex/users", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://"+tt.host+tt.path, nil)
+			rt := h.resolveRoute(req)
+			if rt.Workspace != tt.workspace || rt.Service != tt.service || rt.Path != tt.routedPath || rt.HostRouted != tt.hostRouted {
+				t.Errorf("resolveRoute() = %+v", rt)
+			}
+		})
+	}
+}
+
+func TestResolveRouteWorkspaceSelectors(t *testing.T) {
+	h := &Handler{config: &config.Config{
+		HostRoutes: []config.HostRoute{{Host: "api.stripe.local", Service: "stripe", Workspace: "shared"}},
+		WorkspaceSelectors: []config.WorkspaceSelector{
+			{Type: "header", Name: "X-Mockingbird-Workspace"},
+			{Type: "cookie", Name: "mb_workspace"},
+			{Type: "query", Name: "_workspace"},
+		},
+	}}
+
+	tests := []struct {
+		name      string
+		url       string
+		header    string
+		cookie    string
+		workspace string
+		source    string
+	}{
+		{"header wins over cookie", "http://localhost/servicex/users", "run-1", "run-2", "run-1", "header:X-Mockingbird-Workspace"},
+		{"cookie", "http://localhost/servicex/users", "", "run-2", "run-2", "cookie:mb_workspace"},
+		{"query", "http://localhost/servicex/users?_workspace=run-3&a=1", "", "", "run-3", "query:_workspace"},
+		{"path prefix wins over selectors", "http://localhost/w/dave/servicex/users", "run-1", "", "dave", "path"},
+		{"selector wins over host route", "http://api.stripe.local/v1/charges", "run-1", "", "run-1", "header:X-Mockingbird-Workspace"},
+		{"host route workspace", "http://api.stripe.local/v1/charges", "", "", "shared", "host"},
+		{"invalid selector ignored", "http://localhost/servicex/users", "..", "", "default", "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Mockingbird-Workspace", tt.header)
+			}
+			req.Header.Set("Cookie", "session=abc")
+			if tt.cookie != "" {
+				req.Header.Set("Cookie", "session=abc; mb_workspace="+tt.cookie)
+			}
+
+			rt := h.resolveRoute(req)
+			if rt.Workspace != tt.workspace || rt.WorkspaceSource != tt.source {
+				t.Errorf("resolveRoute() workspace = %q (%s), expected %q (%s)", rt.Workspace, rt.WorkspaceSource, tt.workspace, tt.source)
+			}
+
+			// Selectors are never forwarded upstream
+			if req.Header.Get("X-Mockingbird-Workspace") != "" || req.URL.Query().Get("_workspace") != "" {
+				t.Errorf("selector was not stripped from request")
+			}
+			if req.Header.Get("Cookie") != "session=abc" {
+				t.Errorf("Cookie header = %q, expected selector cookie removed", req.Header.Get("Cookie"))
+			}
+		})
+	}
+}
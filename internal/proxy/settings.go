@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// Defaults used by a CORS policy that doesn't list methods
+var defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// applyServiceDefaults returns a copy of a matched rule with the service settings applied:
+// the default upstream for rules with neither proxyto nor response, and the default
+// injected headers (the rule's own headers win)
+func applyServiceDefaults(rule *models.Rule, settings *models.ServiceSettings) *models.Rule {
+	if settings == nil {
+		return rule
+	}
+
+	applied := *rule
+	if applied.ProxyTo == "" && applied.Response == "" {
+		applied.ProxyTo = settings.ProxyTo
+	}
+	if len(settings.Headers) > 0 {
+		headers := make(map[string]string, len(settings.Headers)+len(rule.Headers))
+		for key, value := range settings.Headers {
+			headers[key] = value
+		}
+		for key, value := range rule.Headers {
+			headers[key] = value
+		}
+		applied.Headers = headers
+	}
+	return &applied
+}
+
+// settingsDelay returns a service's default latency (0 if unset or invalid)
+func settingsDelay(settings *models.ServiceSettings) time.Duration {
+	if settings == nil || settings.Delay == "" {
+		return 0
+	}
+	delay, err := time.ParseDuration(settings.Delay)
+	if err != nil {
+		fmt.Printf("Warning: Invalid service delay %q: %v\n", settings.Delay, err)
+		return 0
+	}
+	return delay
+}
+
+// isPreflight reports whether a request is a CORS preflight
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request origin
+// ("" if the policy doesn't allow it)
+func allowedOrigin(policy *models.CORSPolicy, origin string) string {
+	if origin == "" {
+		return ""
+	}
+	if len(policy.AllowOrigins) == 0 {
+		if policy.AllowCredentials {
+			return origin // Browsers reject "*" with credentials
+		}
+		return "*"
+	}
+	for _, allowed := range policy.AllowOrigins {
+		if allowed == "*" {
+			if policy.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// setCORSHeaders adds a policy's headers for a request origin to a response
+// Upstream CORS headers are replaced so the policy is the single source of truth
+func setCORSHeaders(header http.Header, policy *models.CORSPolicy, origin string) {
+	allowOrigin := allowedOrigin(policy, origin)
+	if allowOrigin == "" {
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if allowOrigin != "*" {
+		header.Add("Vary", "Origin")
+	}
+	if policy.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	} else {
+		header.Del("Access-Control-Allow-Credentials")
+	}
+	if len(policy.ExposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposeHeaders, ", "))
+	}
+}
+
+// writePreflight answers a CORS preflight request from the policy
+func writePreflight(w http.ResponseWriter, r *http.Request, policy *models.CORSPolicy) *models.Response {
+	header := w.Header()
+	setCORSHeaders(header, policy, r.Header.Get("Origin"))
+
+	if header.Get("Access-Control-Allow-Origin") != "" {
+		methods := policy.AllowMethods
+		if len(methods) == 0 {
+			methods = defaultCORSMethods
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+		if len(policy.AllowHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowHeaders, ", "))
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return &models.Response{
+		StatusCode: http.StatusNoContent,
+		Headers:    flattenHeaders(header),
+	}
+}
+
+// corsWriter adds a CORS policy's headers to a response just before it is written
+type corsWriter struct {
+	http.ResponseWriter
+	policy      *models.CORSPolicy
+	origin      string
+	wroteHeader bool
+}
+
+func (c *corsWriter) WriteHeader(statusCode int) {
+	if !c.wroteHeader {
+		c.wroteHeader = true
+		setCORSHeaders(c.Header(), c.policy, c.origin)
+	}
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *corsWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer (flushing)
+func (c *corsWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
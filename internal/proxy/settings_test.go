@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   models.CORSPolicy
+		origin   string
+		expected string
+	}{
+		{"any origin", models.CORSPolicy{}, "http://app.local", "*"},
+		{"any origin with credentials echoes", models.CORSPolicy{AllowCredentials: true}, "http://app.local", "http://app.local"},
+		{"listed origin", models.CORSPolicy{AllowOrigins: []string{"http://app.local"}}, "http://APP.local", "http://APP.local"},
+		{"unlisted origin", models.CORSPolicy{AllowOrigins: []string{"http://app.local"}}, "http://evil.local", ""},
+		{"no origin", models.CORSPolicy{}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := allowedOrigin(&tt.policy, tt.origin); result != tt.expected {
+				t.Errorf("allowedOrigin() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServiceSettingsApplied(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "http://upstream.local")
+		w.Write([]byte(r.URL.Path + " key=" + r.Header.Get("X-API-Key")))
+	}))
+	defer upstream.Close()
+
+	configDir := t.TempDir()
+	rulesDir := filepath.Join(configDir, "workspaces", "default", "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	rules := `settings:
+  proxyto: ` + upstream.URL + `
+  headers:
+    X-API-Key: secret
+  unmatched: mock
+  unmatched_response: "[404]\nbody:\nnot mocked yet"
+  cors:
+    allow_methods: [GET, POST]
+rules:
+  - id: users
+    match: {path: /servicex/users}
+`
+	if err := os.WriteFile(filepath.Join(rulesDir, "servicex.yaml"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 100, Values: map[string]string{}}
+	wm, err := store.NewWorkspaceManager(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+	h := NewHandler(cfg, wm, nil)
+
+	serve := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://localhost:6625"+path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A rule without proxyto uses the default upstream and headers; CORS replaces upstream's
+	rec := serve("GET", "/servicex/users", map[string]string{"Origin": "http://app.local"})
+	if rec.Body.String() != "/users key=secret" {
+		t.Errorf("proxied body = %q", rec.Body.String())
+	}
+	if origin := rec.Header().Values("Access-Control-Allow-Origin"); len(origin) != 1 || origin[0] != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %v", origin)
+	}
+
+	// Unmatched requests get the custom .mock
+	if rec := serve("GET", "/servicex/other", nil); rec.Code != http.StatusNotFound || rec.Body.String() != "not mocked yet" {
+		t.Errorf("unmatched = %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Preflights are answered from the policy
+	rec = serve("OPTIONS", "/servicex/users", map[string]string{
+		"Origin":                         "http://app.local",
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "Content-Type",
+	})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || rec.Header().Get("Access-Control-Allow-Headers") != "Content-Type" {
+		t.Errorf("preflight = %d %v", rec.Code, rec.Header())
+	}
+}
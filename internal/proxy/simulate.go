@@ -0,0 +1,259 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/ruletest"
+)
+
+// SimulateRequest is a request to run through the rules without sending or recording anything
+type SimulateRequest struct {
+	Method  string            `json:"method"`            // Defaults to GET
+	Path    string            `json:"path"`              // Path as sent to the proxy (without /w/{workspace}), e.g. /servicex/users
+	Host    string            `json:"host,omitempty"`    // Host header, for host routed services
+	Headers map[string]string `json:"headers,omitempty"` // Request headers
+	Query   map[string]string `json:"query,omitempty"`   // Query parameters
+	Body    json.RawMessage   `json:"body,omitempty"`    // JSON body, or a JSON string holding a raw body
+}
+
+// SimulatedUpstream is the request a proxy rule would send upstream
+type SimulatedUpstream struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`              // Config values are masked with their key names
+	TLSSource string            `json:"tls_source,omitempty"` // Where upstream TLS settings come from ("rule" or "service")
+}
+
+// SimulateResult describes how a request would be answered
+type SimulateResult struct {
+	Workspace         string             `json:"workspace"`
+	Service           string             `json:"service"`
+	Path              string             `json:"path"`
+	RuleType          string             `json:"rule_type"`                     // As in traffic: mock, proxy, cors, passthrough, unmatched_mock or timeout
+	MatchedRule       *int               `json:"matched_rule,omitempty"`        // Index of the rule within the file it came from
+	MatchedRuleID     string             `json:"matched_rule_id,omitempty"`     // ID of the matched rule
+	MatchedRuleOrigin string             `json:"matched_rule_origin,omitempty"` // "service" or "library:<name>"
+	MatchedWorkspace  string             `json:"matched_workspace,omitempty"`   // Workspace whose rules answered
+	Fallback          bool               `json:"fallback"`                      // Answered by an ancestor workspace's rules
+	Plugins           []string           `json:"plugins,omitempty"`             // Enabled plugins whose routes match (they are offered the request first)
+	PluginPreempts    bool               `json:"plugin_preempts,omitempty"`     // A plugin may answer instead of the result below (it isn't run, so this can't be known)
+	Response          *models.Response   `json:"response,omitempty"`            // Rendered response (mock, cors, unmatched mock or timeout)
+	Upstream          *SimulatedUpstream `json:"upstream,omitempty"`            // Request a proxy rule would send
+	Error             string             `json:"error,omitempty"`               // Why the response couldn't be rendered
+}
+
+// Simulate works out how the proxy would answer a request in a workspace, without
+// sending anything upstream, running plugins, counting rule matches or recording traffic
+func (h *Handler) Simulate(workspace string, req SimulateRequest) SimulateResult {
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := req.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// Host routes pick the service (the workspace is the one being simulated)
+	service := extractService(path)
+	hostRouted := false
+	if hr, _ := matchHostRoute(h.config.GetHostRoutes(), req.Host); hr != nil {
+		service = hr.Service
+		hostRouted = true
+	}
+
+	headers := make(http.Header, len(req.Headers))
+	for key, value := range req.Headers {
+		headers.Set(key, value)
+	}
+	query := make(url.Values, len(req.Query))
+	for key, value := range req.Query {
+		query.Set(key, value)
+	}
+
+	ctx := &models.RequestContext{
+		Method:       method,
+		Path:         path,
+		PathSegments: strings.Split(strings.Trim(path, "/"), "/"),
+		QueryParams:  query,
+		Headers:      headers,
+		Body:         simulatedBody(req.Body),
+	}
+
+	result := SimulateResult{Workspace: workspace, Service: service, Path: path}
+	settings := h.workspaceManager.ServiceSettings(workspace, service)
+
+	preflight := settings != nil && settings.CORS != nil && method == http.MethodOptions &&
+		headers.Get("Origin") != "" && headers.Get("Access-Control-Request-Method") != ""
+	if h.pluginManager != nil && !preflight {
+		result.Plugins = h.pluginManager.RoutePlugins(path)
+		result.PluginPreempts = len(result.Plugins) > 0
+	}
+
+	switch match := h.workspaceManager.MatchRule(workspace, service, ctx); {
+	case preflight:
+		r := &http.Request{Method: method, Header: headers}
+		result.Response = writePreflight(httptest.NewRecorder(), r, settings.CORS)
+		result.RuleType = "cors"
+
+	case match.Matched():
+		index := match.Index
+		result.MatchedRule = &index
+		result.MatchedRuleID = match.Rule.ID
+		result.MatchedRuleOrigin = match.Origin
+		result.MatchedWorkspace = match.Workspace
+		result.Fallback = match.Workspace != workspace
+
+		ruleSettings := match.Store.GetServiceSettings(service)
+		rule := applyServiceDefaults(match.Rule, ruleSettings)
+		if rule.ProxyTo != "" {
+			_, tlsSource := upstreamTLSConfig(match.Store, service, rule)
+			h.simulateProxy(&result, rule, ctx, hostRouted, tlsSource)
+			result.RuleType = "proxy"
+		} else if rule.Response != "" {
+			h.simulateMock(&result, rule.Response, ctx, ruleSettings)
+			result.RuleType = "mock"
+		}
+
+	default:
+		h.simulateUnmatched(&result, ctx, settings, hostRouted)
+	}
+
+	// The service's CORS policy is added to every response except proxied ones
+	// (whose headers come from upstream)
+	if settings != nil && settings.CORS != nil && !preflight && result.Response != nil {
+		header := make(http.Header)
+		for key, value := range result.Response.Headers {
+			header.Set(key, value)
+		}
+		setCORSHeaders(header, settings.CORS, headers.Get("Origin"))
+		result.Response.Headers = flattenHeaders(header)
+	}
+
+	return result
+}
+
+// simulateUnmatched mirrors handleUnmatched
+func (h *Handler) simulateUnmatched(result *SimulateResult, ctx *models.RequestContext, settings *models.ServiceSettings, hostRouted bool) {
+	if settings != nil {
+		switch settings.Unmatched {
+		case models.UnmatchedPassthrough:
+			if settings.ProxyTo == "" {
+				break
+			}
+			rule := &models.Rule{ProxyTo: settings.ProxyTo, Headers: settings.Headers}
+			tlsSource := ""
+			if settings.TLS != nil {
+				tlsSource = "service"
+			}
+			h.simulateProxy(result, rule, ctx, hostRouted, tlsSource)
+			result.RuleType = "passthrough"
+			return
+
+		case models.UnmatchedMock:
+			h.simulateMock(result, settings.UnmatchedResponse, ctx, settings)
+			result.RuleType = "unmatched_mock"
+			return
+		}
+	}
+
+	result.RuleType = "timeout"
+	result.Response = &models.Response{
+		StatusCode: http.StatusGatewayTimeout,
+		Body:       "No matching rule found",
+		DelayMS:    settingsDelay(settings).Milliseconds(),
+	}
+}
+
+// simulateMock renders a .mock response the way handleMock would
+// (the service's default delay is reported when the template has no delay line)
+func (h *Handler) simulateMock(result *SimulateResult, response string, ctx *models.RequestContext, settings *models.ServiceSettings) {
+	rendered, err := ruletest.Render(response, ctx, h.renderer)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	if rendered.DelayMS == 0 {
+		rendered.DelayMS = settingsDelay(settings).Milliseconds()
+	}
+	result.Response = rendered
+}
+
+// simulateProxy works out the upstream request the way handleProxy would
+func (h *Handler) simulateProxy(result *SimulateResult, rule *models.Rule, ctx *models.RequestContext, keepPath bool, tlsSource string) {
+	proxyTo := replaceLocalhostURL(rule.ProxyTo)
+	renderedProxyTo, err := h.renderer.Render(proxyTo, ctx)
+	if err != nil {
+		renderedProxyTo = proxyTo
+	}
+	target, err := url.Parse(renderedProxyTo)
+	if err != nil {
+		result.Error = "Invalid upstream URL"
+		return
+	}
+
+	header := http.Header(ctx.Headers).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	upstream := h.prepareUpstream(target, rule, ctx, url.Values(ctx.QueryParams).Encode(), header, keepPath)
+	header.Set("Host", upstream.Host)
+
+	configValues := h.config.GetAll(false)
+	headers := flattenHeaders(header)
+	for key, value := range headers {
+		headers[key] = maskConfigValues(value, configValues)
+	}
+
+	result.Upstream = &SimulatedUpstream{
+		URL:       maskConfigValues(upstream.String(), configValues),
+		Method:    ctx.Method,
+		Headers:   headers,
+		TLSSource: tlsSource,
+	}
+}
+
+// maskConfigValues replaces config values (API keys, etc.) with their key names
+func maskConfigValues(value string, configValues map[string]string) string {
+	keys := make([]string, 0, len(configValues))
+	for key := range configValues {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if configValue := configValues[key]; configValue != "" {
+			value = strings.ReplaceAll(value, configValue, key)
+		}
+	}
+	return value
+}
+
+// simulatedBody parses a simulated body like parseRequestBody: a JSON string holding a
+// raw body is itself parsed as JSON if possible, otherwise kept as a string
+func simulatedBody(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return string(raw)
+	}
+	if text, ok := body.(string); ok {
+		if text == "" {
+			return nil
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(text), &parsed); err == nil {
+			return parsed
+		}
+		return text
+	}
+	return body
+}
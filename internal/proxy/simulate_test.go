@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+)
+
+func TestSimulate(t *testing.T) {
+	configDir := t.TempDir()
+	writeRules := func(workspace, rules string) {
+		rulesDir := filepath.Join(configDir, "workspaces", workspace, "_rules")
+		if err := os.MkdirAll(rulesDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(rulesDir, "servicex.yaml"), []byte(rules), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRules("default", `rules:
+  - id: proxy
+    match: {path: /servicex/**}
+    proxyto: https://api.servicex.com/v1?src=mb
+    headers:
+      Authorization: Bearer {{config "API_KEY"}}
+`)
+	writeRules("run", `rules:
+  - id: user
+    once: true
+    match: {method: [POST], path: "/servicex/users/{id}"}
+    response: |
+      [201]
+      headers:
+        X-Id: "{{reqPathParam 2}}"
+      body:
+      {"name": "{{reqBody "name"}}"}
+`)
+
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 100, Values: map[string]string{"API_KEY": "sk-secret"}}
+	wm, err := store.NewWorkspaceManager(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+	h := NewHandler(cfg, wm, nil)
+
+	// A mock rule renders its response (twice: simulating doesn't use up once)
+	for i := 0; i < 2; i++ {
+		result := h.Simulate("run", SimulateRequest{Method: "post", Path: "/servicex/users/42", Body: json.RawMessage(`{"name": "Ann"}`)})
+		if result.RuleType != "mock" || result.MatchedRuleID != "user" || result.Fallback {
+			t.Fatalf("mock simulation = %+v", result)
+		}
+		if result.Response.StatusCode != 201 || result.Response.Headers["X-Id"] != "42" || result.Response.Body != "{\"name\": \"Ann\"}\n" {
+			t.Errorf("rendered response = %+v", result.Response)
+		}
+	}
+
+	// Falls back to default's proxy rule, which shows the upstream request with secrets masked
+	result := h.Simulate("run", SimulateRequest{Path: "/servicex/users", Query: map[string]string{"page": "2"}})
+	if result.RuleType != "proxy" || result.MatchedWorkspace != "default" || !result.Fallback || result.Upstream == nil {
+		t.Fatalf("proxy simulation = %+v", result)
+	}
+	if result.Upstream.URL != "https://api.servicex.com/v1/users?src=mb&page=2" {
+		t.Errorf("upstream URL = %s", result.Upstream.URL)
+	}
+	if auth := result.Upstream.Headers["Authorization"]; auth != "Bearer API_KEY" {
+		t.Errorf("upstream Authorization = %q", auth)
+	}
+
+	// Unmatched requests report the 504
+	if result := h.Simulate("run", SimulateRequest{Path: "/other/x"}); result.RuleType != "timeout" || result.Response.StatusCode != 504 {
+		t.Errorf("unmatched simulation = %+v", result)
+	}
+
+	// Nothing was recorded
+	st, _ := wm.GetStore("run")
+	if traffic := st.GetTraffic(0, ""); len(traffic) != 0 {
+		t.Errorf("simulation recorded %d traffic entries", len(traffic))
+	}
+}
+
+func TestSimulateMatchesProxy(t *testing.T) {
+	var sent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.URL.RequestURI() + " " + r.Header.Get("X-Team")
+	}))
+	defer upstream.Close()
+
+	configDir := t.TempDir()
+	rulesDir := filepath.Join(configDir, "workspaces", "default", "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	rules := `rules:
+  - match: {path: /servicex/**}
+    proxyto: ` + upstream.URL + `/v1?src=mb
+    headers:
+      X-Team: "{{reqPathParam 1}}"
+`
+	if err := os.WriteFile(filepath.Join(rulesDir, "servicex.yaml"), []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 100, Values: map[string]string{}}
+	wm, err := store.NewWorkspaceManager(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+	h := NewHandler(cfg, wm, nil)
+
+	// The target's path is kept and only the service prefix is dropped
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost:6625/servicex/users?page=2", nil))
+	if sent != "/v1/users?src=mb&page=2 users" {
+		t.Errorf("proxied request = %q", sent)
+	}
+
+	result := h.Simulate("default", SimulateRequest{Path: "/servicex/users", Query: map[string]string{"page": "2"}})
+	if result.Upstream == nil || result.Upstream.URL+" "+result.Upstream.Headers["X-Team"] != upstream.URL+sent {
+		t.Errorf("simulated upstream = %+v, proxied %q", result.Upstream, sent)
+	}
+	if result.PluginPreempts {
+		t.Errorf("no plugin should pre-empt the rule")
+	}
+}
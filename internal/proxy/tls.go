@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/store"
+)
+
+// maxCachedTransports bounds the transport cache; templated certificate paths can
+// produce a new set of settings per request
+const maxCachedTransports = 64
+
+// upstreamTLSConfig picks the TLS settings for a proxy rule
+// Rule-level settings win over the service settings block
+// Returns nil if neither defines any TLS settings
+func upstreamTLSConfig(st *store.Store, service string, rule *models.Rule) (*models.TLSConfig, string) {
+	if rule.TLS != nil {
+		return rule.TLS, "rule"
+	}
+	if settings := st.GetServiceSettings(service); settings != nil && settings.TLS != nil {
+		return settings.TLS, "service"
+	}
+	return nil, ""
+}
+
+// transportFor returns an HTTP transport configured with the given TLS settings
+// Transports are cached by their resolved settings so connections are reused across requests
+func (h *Handler) transportFor(tlsCfg *models.TLSConfig, source string, ctx *models.RequestContext) (http.RoundTripper, *models.UpstreamTLSInfo, error) {
+	// Resolve templates / files into PEM material
+	certPEM, err := h.loadTLSMaterial(tlsCfg.Cert, ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client certificate: %w", err)
+	}
+	keyPEM, err := h.loadTLSMaterial(tlsCfg.Key, ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client key: %w", err)
+	}
+	caPEM, err := h.loadTLSMaterial(tlsCfg.CA, ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CA bundle: %w", err)
+	}
+
+	info := &models.UpstreamTLSInfo{
+		Source:             source,
+		CustomCA:           caPEM != "",
+		ServerName:         tlsCfg.ServerName,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+	}
+
+	// Cache key covers everything that affects the TLS handshake
+	hash := sha256.New()
+	for _, part := range []string{certPEM, keyPEM, caPEM, tlsCfg.ServerName, fmt.Sprint(tlsCfg.InsecureSkipVerify)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	cacheKey := hex.EncodeToString(hash.Sum(nil))
+
+	if entry := h.transports.get(cacheKey); entry != nil {
+		info.ClientCert = entry.clientCert
+		info.ClientCertSubject = entry.subject
+		return entry.transport, info, nil
+	}
+
+	tlsClientConfig := &tls.Config{
+		ServerName:         tlsCfg.ServerName,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+	}
+
+	entry := &cachedTransport{}
+
+	// Client certificate (mTLS)
+	if certPEM != "" || keyPEM != "" {
+		if certPEM == "" || keyPEM == "" {
+			return nil, nil, fmt.Errorf("both cert and key are required for a client certificate")
+		}
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsClientConfig.Certificates = []tls.Certificate{cert}
+		entry.clientCert = true
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			entry.subject = leaf.Subject.String()
+		}
+	}
+
+	// Custom CA bundle (replaces the system roots)
+	if caPEM != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+			return nil, nil, fmt.Errorf("CA bundle contains no valid certificates")
+		}
+		tlsClientConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsClientConfig
+	entry.transport = transport
+
+	entry = h.transports.add(cacheKey, entry)
+	info.ClientCert = entry.clientCert
+	info.ClientCertSubject = entry.subject
+
+	return entry.transport, info, nil
+}
+
+// cachedTransport is a transport built for a specific set of TLS settings
+type cachedTransport struct {
+	key        string // Settings hash it is cached under
+	transport  *http.Transport
+	clientCert bool
+	subject    string
+}
+
+// transportCache holds the most recently used transports, closing the idle
+// connections of those it evicts
+// The zero value is an empty cache
+type transportCache struct {
+	mu    sync.Mutex
+	order list.List                // Most recently used first; values are *cachedTransport
+	items map[string]*list.Element // Cache key -> element in order
+}
+
+// get returns the transport cached for a key, or nil
+func (c *transportCache) get(key string) *cachedTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedTransport)
+}
+
+// add caches a transport unless one was cached for the key meanwhile, and returns
+// the cached transport
+func (c *transportCache) add(key string, entry *cachedTransport) *cachedTransport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cachedTransport)
+	}
+	if c.items == nil {
+		c.items = make(map[string]*list.Element)
+	}
+
+	entry.key = key
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > maxCachedTransports {
+		oldest := c.order.Remove(c.order.Back()).(*cachedTransport)
+		delete(c.items, oldest.key)
+		oldest.transport.CloseIdleConnections()
+	}
+	return entry
+}
+
+// len returns the number of cached transports
+func (c *transportCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// loadTLSMaterial resolves a cert/key/CA setting into PEM content
+// The value is rendered as a template first (so {{ config `KEY` }} works), then
+// used as-is if it is PEM, otherwise treated as a file path
+func (h *Handler) loadTLSMaterial(value string, ctx *models.RequestContext) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return "", nil
+	}
+
+	rendered, err := h.renderer.Render(value, ctx)
+	if err != nil {
+		return "", err
+	}
+	rendered = strings.TrimSpace(rendered)
+
+	if rendered == "" {
+		return "", fmt.Errorf("resolved to an empty value")
+	}
+
+	if strings.HasPrefix(rendered, "-----BEGIN") {
+		// Config values often store PEM on a single line with escaped newlines
+		if !strings.Contains(rendered, "\n") {
+			rendered = strings.ReplaceAll(rendered, `\n`, "\n")
+		}
+		return rendered, nil
+	}
+
+	data, err := os.ReadFile(rendered)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", rendered, err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+)
+
+func newTestHandler(values map[string]string) *Handler {
+	cfg := &config.Config{Values: values}
+	return &Handler{config: cfg, renderer: render.NewRenderer(cfg)}
+}
+
+func TestTransportForCustomCA(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}))
+
+	// Store the CA as a single-line config value with escaped newlines
+	h := newTestHandler(map[string]string{"UPSTREAM_CA": strings.ReplaceAll(caPEM, "\n", `\n`)})
+	tlsCfg := &models.TLSConfig{CA: "{{ config `UPSTREAM_CA` }}", ServerName: "example.com"}
+
+	transport, info, err := h.transportFor(tlsCfg, "service", &models.RequestContext{})
+	if err != nil {
+		t.Fatalf("transportFor() error = %v", err)
+	}
+	if !info.CustomCA || info.ClientCert || info.Source != "service" || info.ServerName != "example.com" {
+		t.Errorf("unexpected TLS info: %+v", info)
+	}
+
+	req, _ := http.NewRequest("GET", upstream.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request with custom CA failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// Same settings reuse the cached transport
+	again, _, err := h.transportFor(tlsCfg, "service", &models.RequestContext{})
+	if err != nil || again != transport {
+		t.Errorf("expected cached transport to be reused")
+	}
+}
+
+func TestTransportForInvalidMaterial(t *testing.T) {
+	h := newTestHandler(map[string]string{})
+
+	tests := []struct {
+		name string
+		cfg  *models.TLSConfig
+	}{
+		{"cert without key", &models.TLSConfig{Cert: "-----BEGIN CERTIFICATE-----\nxx\n-----END CERTIFICATE-----"}},
+		{"missing file", &models.TLSConfig{CA: "/nonexistent/ca.pem"}},
+		{"empty config value", &models.TLSConfig{CA: "{{ config `MISSING` }}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := h.transportFor(tt.cfg, "rule", &models.RequestContext{}); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTransportCacheBounded(t *testing.T) {
+	h := newTestHandler(map[string]string{})
+
+	// A templated server name gives each request its own settings
+	first, _, err := h.transportFor(&models.TLSConfig{ServerName: "host-0.test"}, "rule", &models.RequestContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= maxCachedTransports; i++ {
+		if _, _, err := h.transportFor(&models.TLSConfig{ServerName: fmt.Sprintf("host-%d.test", i)}, "rule", &models.RequestContext{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := h.transports.len(); n != maxCachedTransports {
+		t.Errorf("cached transports = %d, expected %d", n, maxCachedTransports)
+	}
+	again, _, _ := h.transportFor(&models.TLSConfig{ServerName: "host-0.test"}, "rule", &models.RequestContext{})
+	if again == first {
+		t.Errorf("expected the least recently used transport to be evicted")
+	}
+}
@@ -0,0 +1,439 @@
+// Package query implements the traffic search language and cursor pagination
+// used to search recorded traffic on the server
+//
+// A query is a list of space separated terms, all of which must match:
+//
+//	method:POST,PUT          request method (any of)
+//	path:/servicex/users/*   path pattern, as in rule matches (*, ** and {param})
+//	status:404 | 4xx | 400-499
+//	type:mock,proxy          rule type (any of)
+//	rule:<id>                matched rule ID
+//	service:<name>  session:<name>
+//	header.<Name>:<regex>    request header value
+//	body:<regex>             request body (JSON bodies are matched as compact JSON)
+//	$.user.name:<value>      JSONPath on the request body equals value ("*" for present)
+//	since:<time>  until:<time>   RFC 3339 timestamps, or a duration ago such as 15m
+//
+// Values containing spaces can be double quoted, and a term prefixed with "-" is negated
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+)
+
+// DefaultLimit is the page size when none is given
+const DefaultLimit = 100
+
+// ErrInvalidCursor is returned for cursors that weren't produced by Search
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query is a parsed traffic query
+type Query struct {
+	terms  []term
+	bounds Bounds
+}
+
+// Bounds are conditions every match of a query satisfies, so storage can narrow a search
+// with its indexes before matching each entry (zero values are unbounded)
+type Bounds struct {
+	Service   string    // Only this service
+	RuleID    string    // Only entries matched by this rule
+	MinStatus int       // Only response statuses in MinStatus..MaxStatus
+	MaxStatus int       // (0 for any status)
+	Since     time.Time // Only entries at or after this time
+	Until     time.Time // Only entries before this time
+}
+
+// term is one condition of a query
+type term struct {
+	negate bool
+	match  func(entry *models.TrafficEntry) bool
+}
+
+// Options controls which page of results Search returns
+type Options struct {
+	Limit     int    // Page size (DefaultLimit if 0)
+	Cursor    string // NextCursor of the previous page
+	Ascending bool   // Oldest first (default is newest first)
+}
+
+// Page is one page of search results
+type Page struct {
+	Entries    []models.TrafficEntry `json:"entries"`
+	NextCursor string                `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// Parse parses a query; relative times (since:15m) are relative to now
+func Parse(input string, now time.Time) (*Query, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, token := range tokens {
+		negate := strings.HasPrefix(token, "-")
+		token = strings.TrimPrefix(token, "-")
+
+		key, value, ok := strings.Cut(token, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid term %q: expected field:value", token)
+		}
+		value = unquote(value)
+
+		match, err := parseTerm(key, value, now)
+		if err != nil {
+			return nil, err
+		}
+		q.terms = append(q.terms, term{negate: negate, match: match})
+		if !negate {
+			q.bounds.narrow(key, value, now)
+		}
+	}
+
+	return q, nil
+}
+
+// Match reports whether an entry satisfies every term of the query
+func (q *Query) Match(entry *models.TrafficEntry) bool {
+	for _, t := range q.terms {
+		if t.match(entry) == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Bounds returns the conditions implied by the query's service, rule, status and time terms
+func (q *Query) Bounds() Bounds {
+	return q.bounds
+}
+
+// narrow tightens the bounds with a (valid, non-negated) term
+func (b *Bounds) narrow(key, value string, now time.Time) {
+	switch key {
+	case "service":
+		b.Service = value
+	case "rule":
+		b.RuleID = value
+	case "status":
+		low, high, _ := parseStatus(value)
+		if b.MaxStatus == 0 {
+			b.MinStatus, b.MaxStatus = low, high
+		} else {
+			b.MinStatus, b.MaxStatus = max(b.MinStatus, low), min(b.MaxStatus, high)
+		}
+	case "since":
+		if t, err := parseTime(value, now); err == nil && t.After(b.Since) {
+			b.Since = t
+		}
+	case "until":
+		if t, err := parseTime(value, now); err == nil && (b.Until.IsZero() || t.Before(b.Until)) {
+			b.Until = t
+		}
+	}
+}
+
+// parseTerm builds the matcher for one field:value term
+func parseTerm(key, value string, now time.Time) (func(*models.TrafficEntry) bool, error) {
+	switch {
+	case key == "method":
+		methods := strings.Split(value, ",")
+		return func(e *models.TrafficEntry) bool {
+			for _, method := range methods {
+				if strings.EqualFold(method, e.Method) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case key == "path":
+		return func(e *models.TrafficEntry) bool {
+			return matcher.MatchPath(value, e.Path)
+		}, nil
+
+	case key == "status":
+		low, high, err := parseStatus(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *models.TrafficEntry) bool {
+			return e.Response != nil && e.Response.StatusCode >= low && e.Response.StatusCode <= high
+		}, nil
+
+	case key == "type":
+		types := strings.Split(value, ",")
+		return func(e *models.TrafficEntry) bool {
+			for _, ruleType := range types {
+				if ruleType == e.RuleType {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case key == "rule":
+		return func(e *models.TrafficEntry) bool { return e.MatchedRuleID == value }, nil
+
+	case key == "service":
+		return func(e *models.TrafficEntry) bool { return e.Service == value }, nil
+
+	case key == "session":
+		return func(e *models.TrafficEntry) bool { return e.Session == value }, nil
+
+	case strings.HasPrefix(key, "header."):
+		name := strings.TrimPrefix(key, "header.")
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for %s: %w", key, err)
+		}
+		return func(e *models.TrafficEntry) bool {
+			for headerName, values := range e.Headers {
+				if !strings.EqualFold(headerName, name) {
+					continue
+				}
+				for _, v := range values {
+					if re.MatchString(v) {
+						return true
+					}
+				}
+			}
+			return false
+		}, nil
+
+	case key == "body":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex for body: %w", err)
+		}
+		return func(e *models.TrafficEntry) bool {
+			body, ok := bodyString(e.Body)
+			return ok && re.MatchString(body)
+		}, nil
+
+	case strings.HasPrefix(key, "$"):
+		path := strings.TrimPrefix(strings.TrimPrefix(key, "$"), ".")
+		return func(e *models.TrafficEntry) bool {
+			if _, isString := e.Body.(string); isString {
+				return false
+			}
+			found := render.BodyValue(e.Body, path)
+			if found == nil {
+				return false
+			}
+			if value == "*" {
+				return true
+			}
+			text, ok := bodyString(found)
+			return ok && text == value
+		}, nil
+
+	case key == "since" || key == "until":
+		t, err := parseTime(value, now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if key == "since" {
+			return func(e *models.TrafficEntry) bool { return !e.Timestamp.Before(t) }, nil
+		}
+		return func(e *models.TrafficEntry) bool { return e.Timestamp.Before(t) }, nil
+	}
+
+	return nil, fmt.Errorf("unknown field %q", key)
+}
+
+// parseStatus parses "404", "4xx" or "400-499" into an inclusive range
+func parseStatus(value string) (int, int, error) {
+	if len(value) == 3 && strings.HasSuffix(strings.ToLower(value), "xx") {
+		class, err := strconv.Atoi(value[:1])
+		if err == nil {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+	if low, high, ok := strings.Cut(value, "-"); ok {
+		l, errLow := strconv.Atoi(low)
+		h, errHigh := strconv.Atoi(high)
+		if errLow == nil && errHigh == nil && l <= h {
+			return l, h, nil
+		}
+	}
+	if code, err := strconv.Atoi(value); err == nil {
+		return code, code, nil
+	}
+	return 0, 0, fmt.Errorf("invalid status %q: expected 404, 4xx or 400-499", value)
+}
+
+// parseTime parses an RFC 3339 timestamp or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	ago, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected an RFC 3339 time or a duration such as 15m, got %q", value)
+	}
+	return now.Add(-ago), nil
+}
+
+// bodyString renders a body (or a value within it) as text: strings as-is, anything else as compact JSON
+func bodyString(body interface{}) (string, bool) {
+	switch v := body.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// tokenize splits a query on spaces, keeping double quoted sections together
+func tokenize(input string) ([]string, error) {
+	var tokens []string
+	var current strings.Builder
+	inQuotes := false
+
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\\' && inQuotes && i+1 < len(input):
+			current.WriteByte(c)
+			current.WriteByte(input[i+1])
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+			current.WriteByte(c)
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens, nil
+}
+
+// unquote removes the quotes around a double quoted value
+func unquote(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Search returns one page of the entries matching a query
+// Entries must be in the order they were recorded (oldest first)
+func Search(entries []models.TrafficEntry, q *Query, opts Options) (*Page, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	step := -1
+	start := len(entries) - 1
+	if opts.Ascending {
+		step = 1
+		start = 0
+	}
+
+	if opts.Cursor != "" {
+		cursorTime, cursorID, err := DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		start = resumeIndex(entries, cursorTime, cursorID, opts.Ascending)
+	}
+
+	page := &Page{Entries: []models.TrafficEntry{}}
+	for i := start; i >= 0 && i < len(entries); i += step {
+		if !q.Match(&entries[i]) {
+			continue
+		}
+		if len(page.Entries) == limit {
+			// There's at least one more match, so there's another page
+			last := page.Entries[limit-1]
+			page.NextCursor = EncodeCursor(last.Timestamp, last.ID)
+			break
+		}
+		page.Entries = append(page.Entries, entries[i])
+	}
+
+	return page, nil
+}
+
+// resumeIndex finds where to continue after the cursor's entry; if that entry has
+// since been dropped, continues from its timestamp
+func resumeIndex(entries []models.TrafficEntry, cursorTime time.Time, cursorID string, ascending bool) int {
+	for i := range entries {
+		if entries[i].ID == cursorID {
+			if ascending {
+				return i + 1
+			}
+			return i - 1
+		}
+	}
+
+	if ascending {
+		for i := range entries {
+			if entries[i].Timestamp.After(cursorTime) {
+				return i
+			}
+		}
+		return len(entries)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Timestamp.Before(cursorTime) {
+			return i
+		}
+	}
+	return -1
+}
+
+// EncodeCursor makes an opaque cursor pointing at an entry
+func EncodeCursor(timestamp time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(timestamp.UnixNano(), 10) + ":" + id))
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor
+func DecodeCursor(cursor string) (time.Time, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return time.Unix(0, unixNano), id, nil
+}
@@ -0,0 +1,144 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestParseAndMatch(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := &models.TrafficEntry{
+		ID:            "req-1",
+		Timestamp:     now.Add(-10 * time.Minute),
+		Service:       "servicex",
+		Session:       "run-1",
+		Method:        "POST",
+		Path:          "/servicex/users/42",
+		Headers:       map[string][]string{"Content-Type": {"application/json"}},
+		Body:          map[string]interface{}{"user": map[string]interface{}{"name": "Ann Lee"}, "tags": []interface{}{"a", "b"}},
+		Response:      &models.Response{StatusCode: 404},
+		RuleType:      "mock",
+		MatchedRuleID: "rule-1",
+	}
+
+	tests := []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"method:GET,POST", true},
+		{"method:get", false},
+		{"path:/servicex/**", true},
+		{"path:/servicex/users/{id}", true},
+		{"path:/servicex/users", false},
+		{"status:404", true},
+		{"status:4xx", true},
+		{"status:500-599", false},
+		{"type:proxy,mock", true},
+		{"rule:rule-1 service:servicex session:run-1", true},
+		{"header.content-type:json", true},
+		{"header.Authorization:.", false},
+		{`body:"\"name\":\"Ann"`, true},
+		{"body:^Ann", false},
+		{`$.user.name:"Ann Lee"`, true},
+		{"$.tags[1]:b", true},
+		{"$.user.email:*", false},
+		{"since:15m", true},
+		{"since:5m", false},
+		{"until:2026-01-01T11:55:00Z", true},
+		{"-type:mock", false},
+		{"-status:5xx method:POST", true},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query, now)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.query, err)
+			continue
+		}
+		if got := q.Match(entry); got != tt.match {
+			t.Errorf("Parse(%q).Match() = %v, expected %v", tt.query, got, tt.match)
+		}
+	}
+
+	for _, invalid := range []string{"users", "colour:red", "status:abc", "body:(", "since:yesterday", `path:"/x`} {
+		if _, err := Parse(invalid, now); err == nil {
+			t.Errorf("Parse(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var entries []models.TrafficEntry
+	for i := 0; i < 7; i++ {
+		method := "GET"
+		if i%2 == 1 {
+			method = "POST"
+		}
+		entries = append(entries, models.TrafficEntry{
+			ID:        fmt.Sprintf("e%d", i),
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Method:    method,
+		})
+	}
+	gets, _ := Parse("method:GET", start)
+
+	pages := func(opts Options) [][]string {
+		var ids [][]string
+		for {
+			page, err := Search(entries, gets, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pageIDs []string
+			for _, entry := range page.Entries {
+				pageIDs = append(pageIDs, entry.ID)
+			}
+			ids = append(ids, pageIDs)
+			if page.NextCursor == "" {
+				return ids
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+
+	if got := pages(Options{Limit: 3}); !reflect.DeepEqual(got, [][]string{{"e6", "e4", "e2"}, {"e0"}}) {
+		t.Errorf("newest first pages = %v", got)
+	}
+	if got := pages(Options{Limit: 2, Ascending: true}); !reflect.DeepEqual(got, [][]string{{"e0", "e2"}, {"e4", "e6"}}) {
+		t.Errorf("oldest first pages = %v", got)
+	}
+
+	// A cursor whose entry has been dropped continues from its timestamp
+	if page, _ := Search(entries, gets, Options{Cursor: EncodeCursor(start.Add(3*time.Second), "gone")}); len(page.Entries) != 2 || page.Entries[0].ID != "e2" {
+		t.Errorf("resumed page = %+v", page.Entries)
+	}
+
+	if _, err := Search(entries, gets, Options{Cursor: "not a cursor"}); err != ErrInvalidCursor {
+		t.Errorf("Search() with a bad cursor = %v", err)
+	}
+}
+
+func TestBounds(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	q, err := Parse("service:servicex status:4xx status:400-404 -rule:r1 since:1h since:30m until:2026-01-01T11:50:00Z method:GET", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Bounds{
+		Service:   "servicex",
+		MinStatus: 400,
+		MaxStatus: 404,
+		Since:     now.Add(-30 * time.Minute),
+		Until:     time.Date(2026, 1, 1, 11, 50, 0, 0, time.UTC),
+	}
+	if got := q.Bounds(); got != expected {
+		t.Errorf("Bounds() = %+v, expected %+v", got, expected)
+	}
+}
@@ -239,3 +239,18 @@ func getArrayElement(arr interface{}, index int) interface{} {
 func (r *Renderer) configValue(key string) string {
 	return r.config.Get(key)
 }
+
+// Check parses a template without rendering it, reporting syntax errors and unknown functions
+func Check(templateStr string) error {
+	r := &Renderer{}
+	if _, err := template.New("response").Funcs(r.funcMap(nil)).Parse(templateStr); err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+	return nil
+}
+
+// BodyValue gets a value from a parsed JSON body using the same notation as reqBody
+// ("user.name", "data[0].id"); returns nil if the path doesn't exist
+func BodyValue(body interface{}, path string) interface{} {
+	return navigateBody(body, path)
+}
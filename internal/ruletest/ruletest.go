@@ -0,0 +1,189 @@
+// Package ruletest runs the examples embedded in rules, checking that each
+// sample request is answered by the rule it belongs to
+package ruletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/dsl"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+)
+
+// Result is the outcome of running one example
+type Result struct {
+	Index         int                `json:"index"`                    // Position of the rule owning the example in the list that was run
+	ID            string             `json:"id,omitempty"`             // ID of the rule owning the example
+	Origin        string             `json:"origin,omitempty"`         // Where the rule came from (set by callers running resolved rules)
+	Example       int                `json:"example"`                  // Index of the example within the rule
+	Request       models.RuleExample `json:"request"`                  // The example request
+	Passed        bool               `json:"passed"`                   // The example behaved as expected
+	Skipped       bool               `json:"skipped,omitempty"`        // The rule is disabled, scheduled or expired, so it wasn't checked
+	Error         string             `json:"error,omitempty"`          // Why the example failed (or was skipped)
+	Matched       string             `json:"matched,omitempty"`        // ID of the rule that actually won ("" if none matched)
+	MatchedIndex  int                `json:"matched_index"`            // Position of the winning rule, -1 if none matched
+	MatchedOrigin string             `json:"matched_origin,omitempty"` // Where the winning rule came from (set by callers running resolved rules)
+	ProxyTo       string             `json:"proxyto,omitempty"`        // Upstream the winning rule proxies to
+	Response      *models.Response   `json:"response,omitempty"`       // Rendered response of the winning mock rule
+}
+
+// Summary counts the results of a run
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Summarize counts passed, failed and skipped results
+func Summarize(results []Result) Summary {
+	summary := Summary{Total: len(results)}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			summary.Skipped++
+		case result.Passed:
+			summary.Passed++
+		default:
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// Run checks every example of every rule against the rules in match order
+// An example passes when its rule is the one that wins (or, for noMatch, when its rule doesn't match)
+// Rules with enabled: false are treated as inactive, and their examples are skipped
+func Run(rules []models.Rule, renderer *render.Renderer) []Result {
+	results := []Result{}
+
+	for i, rule := range rules {
+		for j, example := range rule.Examples {
+			result := Result{Index: i, ID: rule.ID, Example: j, Request: example, MatchedIndex: -1}
+
+			if rule.Enabled != nil && !*rule.Enabled {
+				result.Skipped = true
+				result.Error = "rule is not active"
+				results = append(results, result)
+				continue
+			}
+
+			ctx := Context(example)
+			winner, index := matcher.Match(rules, ctx)
+			if winner != nil {
+				result.Matched = winner.ID
+				result.MatchedIndex = index
+				result.ProxyTo = winner.ProxyTo
+			}
+
+			if example.NoMatch {
+				// The rule itself must reject the request, whichever rule wins
+				if _, own := matcher.Match([]models.Rule{rule}, ctx); own == 0 {
+					result.Error = "rule matched a request it must not match"
+				} else {
+					result.Passed = true
+				}
+				results = append(results, result)
+				continue
+			}
+
+			switch {
+			case winner == nil:
+				result.Error = "no rule matched"
+			case index != i:
+				result.Error = fmt.Sprintf("rule %s answered instead", ruleName(winner, index))
+			default:
+				result.Passed = true
+			}
+
+			if winner != nil && winner.Response != "" {
+				response, err := Render(winner.Response, ctx, renderer)
+				result.Response = response
+				if err != nil && result.Passed {
+					result.Passed = false
+					result.Error = err.Error()
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// Context builds the request context the matcher sees for an example
+func Context(example models.RuleExample) *models.RequestContext {
+	method := example.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	headers := make(map[string][]string, len(example.Headers))
+	for key, value := range example.Headers {
+		headers[key] = []string{value}
+	}
+	query := make(map[string][]string, len(example.Query))
+	for key, value := range example.Query {
+		query[key] = []string{value}
+	}
+
+	// Bodies are parsed like real requests: JSON if possible, otherwise a string
+	var body interface{}
+	if example.Body != "" {
+		var jsonBody interface{}
+		if err := json.Unmarshal([]byte(example.Body), &jsonBody); err == nil {
+			body = jsonBody
+		} else {
+			body = example.Body
+		}
+	}
+
+	return &models.RequestContext{
+		Method:       strings.ToUpper(method),
+		Path:         example.Path,
+		PathSegments: strings.Split(strings.Trim(example.Path, "/"), "/"),
+		QueryParams:  query,
+		Headers:      headers,
+		Body:         body,
+	}
+}
+
+// Render renders a .mock response the way the proxy would (without the delay)
+func Render(response string, ctx *models.RequestContext, renderer *render.Renderer) (*models.Response, error) {
+	parsed, err := dsl.Parse(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mock template: %w", err)
+	}
+
+	headers := make(map[string]string, len(parsed.Headers))
+	for key, value := range parsed.Headers {
+		rendered, err := renderer.Render(value, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render header %s: %w", key, err)
+		}
+		headers[key] = rendered
+	}
+
+	body, err := renderer.Render(parsed.Body, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render body: %w", err)
+	}
+
+	return &models.Response{
+		StatusCode: parsed.StatusCode,
+		Headers:    headers,
+		Body:       body,
+		DelayMS:    parsed.Delay.Milliseconds(),
+	}, nil
+}
+
+// ruleName identifies a rule in messages
+func ruleName(rule *models.Rule, index int) string {
+	if rule.ID != "" {
+		return rule.ID
+	}
+	return fmt.Sprintf("#%d", index)
+}
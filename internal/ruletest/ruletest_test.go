@@ -0,0 +1,79 @@
+package ruletest
+
+import (
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+)
+
+func TestRun(t *testing.T) {
+	rules := []models.Rule{
+		{
+			ID:       "user",
+			Match:    models.MatchCondition{Method: []string{"GET"}, Path: "/servicex/users/{id}"},
+			Response: "[200]\nbody:\n{\"id\": \"{{reqPathParam 2}}\"}",
+			Examples: []models.RuleExample{
+				{Path: "/servicex/users/42"},
+				{Path: "/servicex/users/42/posts", NoMatch: true},
+				{Method: "DELETE", Path: "/servicex/users/42", NoMatch: true},
+			},
+		},
+		{
+			ID:      "all",
+			Match:   models.MatchCondition{Path: "/servicex/**"},
+			ProxyTo: "https://api.servicex.com",
+			Examples: []models.RuleExample{
+				{Method: "POST", Path: "/servicex/users", Body: `{"name": "Ann"}`},
+				{Path: "/servicex/users/7"}, // Answered by the earlier user rule
+			},
+		},
+		{
+			ID:       "search",
+			Match:    models.MatchCondition{Path: "/servicex/search", Query: map[string]string{"q": "x"}},
+			Response: "[200]",
+			Examples: []models.RuleExample{
+				{Path: "/servicex/search", Query: map[string]string{"q": "x"}}, // Shadowed by the catch-all
+				{Path: "/servicex/search", Query: map[string]string{"q": "y"}, NoMatch: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		rule    string
+		example int
+		passed  bool
+		matched string
+	}{
+		{"user", 0, true, "user"},
+		{"user", 1, true, "all"},
+		{"user", 2, true, "all"},
+		{"all", 0, true, "all"},
+		{"all", 1, false, "user"},
+		{"search", 0, false, "all"},
+		{"search", 1, true, "all"},
+	}
+
+	results := Run(rules, render.NewRenderer(nil))
+	if len(results) != len(tests) {
+		t.Fatalf("Run() returned %d results, expected %d", len(results), len(tests))
+	}
+	for i, tt := range tests {
+		result := results[i]
+		if result.ID != tt.rule || result.Example != tt.example {
+			t.Errorf("result %d is for %s/%d, expected %s/%d", i, result.ID, result.Example, tt.rule, tt.example)
+			continue
+		}
+		if result.Passed != tt.passed || result.Matched != tt.matched {
+			t.Errorf("%s example %d: passed=%v matched=%q (%s), expected passed=%v matched=%q",
+				tt.rule, tt.example, result.Passed, result.Matched, result.Error, tt.passed, tt.matched)
+		}
+	}
+
+	if response := results[0].Response; response == nil || response.StatusCode != 200 || response.Body != `{"id": "42"}` {
+		t.Errorf("rendered response = %+v", response)
+	}
+	if summary := Summarize(results); summary.Passed != 5 || summary.Failed != 2 {
+		t.Errorf("Summarize() = %+v", summary)
+	}
+}
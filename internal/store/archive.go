@@ -0,0 +1,287 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// disabledServiceMarker separates the service file name from its disable timestamp
+const disabledServiceMarker = ".yaml.disabled-"
+
+// RenameWorkspace renames a workspace, keeping its loaded store (and any open
+// SSE subscribers), and updates workspaces and host routes that refer to it
+func (wm *WorkspaceManager) RenameWorkspace(oldName, newName string) error {
+	if err := ValidateWorkspaceName(oldName); err != nil {
+		return err
+	}
+	if err := ValidateWorkspaceName(newName); err != nil {
+		return err
+	}
+	if oldName == "default" {
+		return fmt.Errorf("cannot rename default workspace")
+	}
+	if oldName == newName {
+		return nil
+	}
+	if !wm.workspaceExists(oldName) {
+		return fmt.Errorf("workspace %s not found", oldName)
+	}
+
+	// Neither name may be loaded, deleted or renamed again while the directory moves,
+	// but requests to an already loaded store carry on during the move
+	wm.mu.Lock()
+	for _, name := range []string{oldName, newName} {
+		if wm.deleting[name] || wm.renaming[name] {
+			wm.mu.Unlock()
+			return fmt.Errorf("workspace %s is being changed", name)
+		}
+	}
+	wm.renaming[oldName] = true
+	wm.renaming[newName] = true
+	st, loaded := wm.stores[oldName]
+	wm.mu.Unlock()
+	defer func() {
+		wm.mu.Lock()
+		delete(wm.renaming, oldName)
+		delete(wm.renaming, newName)
+		wm.mu.Unlock()
+	}()
+
+	workspacesDir := filepath.Join(wm.configDir, "workspaces")
+	newPath := filepath.Join(workspacesDir, newName)
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("workspace %s already exists", newName)
+	}
+
+	// Moving a loaded store flushes and reopens its traffic backend, so it's done unlocked
+	if loaded {
+		if err := st.relocate(newPath); err != nil {
+			return fmt.Errorf("failed to rename workspace: %w", err)
+		}
+		wm.mu.Lock()
+		delete(wm.stores, oldName)
+		wm.stores[newName] = st
+		wm.mu.Unlock()
+	} else if err := os.Rename(filepath.Join(workspacesDir, oldName), newPath); err != nil {
+		return fmt.Errorf("failed to rename workspace: %w", err)
+	}
+
+	// Children keep inheriting from the renamed workspace
+	entries, _ := os.ReadDir(workspacesDir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(workspacesDir, entry.Name())
+		metadata := loadWorkspaceMetadata(dir)
+		if metadata.Parent == oldName {
+			metadata.Parent = newName
+			if err := saveWorkspaceMetadata(dir, &metadata); err != nil {
+				fmt.Printf("Warning: Failed to update parent of workspace %s: %v\n", entry.Name(), err)
+			}
+		}
+	}
+	wm.invalidateParents()
+	wm.publish(models.ChangeEvent{Type: EventWorkspaceRenamed, Workspace: oldName, RenamedTo: newName})
+
+	// Host routes pinned to the old name follow the rename
+	routes := wm.config.GetHostRoutes()
+	renamed := false
+	for i := range routes {
+		if routes[i].Workspace == oldName {
+			routes[i].Workspace = newName
+			renamed = true
+		}
+	}
+	if renamed {
+		wm.config.SetHostRoutes(routes)
+		if err := wm.config.Save(); err != nil {
+			fmt.Printf("Warning: Failed to save host routes: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// GetDisabledWorkspaces returns all disabled (.disabled) workspaces
+func (wm *WorkspaceManager) GetDisabledWorkspaces() ([]models.Workspace, error) {
+	workspacesDir := filepath.Join(wm.configDir, "workspaces")
+	entries, err := os.ReadDir(workspacesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []models.Workspace{}, nil
+		}
+		return nil, fmt.Errorf("failed to read workspaces directory: %w", err)
+	}
+
+	workspaces := []models.Workspace{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), ".disabled") {
+			continue
+		}
+
+		dirName := entry.Name()
+		metadata := loadWorkspaceMetadata(filepath.Join(workspacesDir, dirName))
+		workspaces = append(workspaces, models.Workspace{
+			Name:         strings.TrimSuffix(dirName, ".disabled"),
+			Created:      metadata.Created,
+			RuleCount:    wm.countWorkspaceRules(dirName),
+			TrafficCount: wm.countWorkspaceTraffic(dirName),
+			BirdIcon:     metadata.BirdIcon,
+			Parent:       metadata.Parent,
+		})
+	}
+
+	return workspaces, nil
+}
+
+// PurgeDisabledWorkspace permanently removes a disabled workspace
+func (wm *WorkspaceManager) PurgeDisabledWorkspace(name string) error {
+	if err := ValidateWorkspaceName(name); err != nil {
+		return err
+	}
+
+	path := filepath.Join(wm.configDir, "workspaces", name+".disabled")
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return fmt.Errorf("disabled workspace %s not found", name)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to purge workspace: %w", err)
+	}
+	return nil
+}
+
+// GetDisabledServices returns the disabled service files of all active workspaces,
+// newest first
+func (wm *WorkspaceManager) GetDisabledServices() ([]models.DisabledService, error) {
+	workspaces, err := wm.GetWorkspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	services := []models.DisabledService{}
+	for _, ws := range workspaces {
+		rulesDir := filepath.Join(wm.configDir, "workspaces", ws.Name, "_rules")
+		files, err := filepath.Glob(filepath.Join(rulesDir, "*"+disabledServiceMarker+"*"))
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			service, disabledAt, ok := parseDisabledServiceFile(filepath.Base(file))
+			if !ok {
+				continue
+			}
+
+			ruleCount := 0
+			if data, err := os.ReadFile(file); err == nil {
+				var serviceRules models.ServiceRules
+				if yaml.Unmarshal(data, &serviceRules) == nil {
+					ruleCount = len(serviceRules.Rules)
+				}
+			}
+
+			services = append(services, models.DisabledService{
+				Workspace:  ws.Name,
+				Service:    service,
+				File:       filepath.Base(file),
+				DisabledAt: disabledAt,
+				RuleCount:  ruleCount,
+			})
+		}
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].DisabledAt.After(services[j].DisabledAt)
+	})
+	return services, nil
+}
+
+// RestoreService restores a disabled service file, returning the service name
+// Fails if the service is active again (disable it first)
+func (wm *WorkspaceManager) RestoreService(workspace, file string) (string, error) {
+	disabledPath, service, err := wm.disabledServicePath(workspace, file)
+	if err != nil {
+		return "", err
+	}
+
+	activePath := filepath.Join(filepath.Dir(disabledPath), service+".yaml")
+	if _, err := os.Stat(activePath); err == nil {
+		return "", fmt.Errorf("service %s already exists in workspace %s", service, workspace)
+	}
+
+	if err := os.Rename(disabledPath, activePath); err != nil {
+		return "", fmt.Errorf("failed to restore service: %w", err)
+	}
+
+	// Load immediately rather than waiting for the watcher
+	wm.mu.RLock()
+	st, loaded := wm.stores[workspace]
+	wm.mu.RUnlock()
+	if loaded {
+		if err := st.loadRulesFromFile(service, activePath); err != nil {
+			fmt.Printf("Warning: Failed to load restored service %s: %v\n", service, err)
+		}
+	}
+
+	return service, nil
+}
+
+// PurgeDisabledService permanently removes a disabled service file
+func (wm *WorkspaceManager) PurgeDisabledService(workspace, file string) error {
+	disabledPath, _, err := wm.disabledServicePath(workspace, file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(disabledPath); err != nil {
+		return fmt.Errorf("failed to purge service: %w", err)
+	}
+	return nil
+}
+
+// disabledServicePath validates a disabled service file name and returns its path
+func (wm *WorkspaceManager) disabledServicePath(workspace, file string) (string, string, error) {
+	if err := ValidateWorkspaceName(workspace); err != nil {
+		return "", "", err
+	}
+	if strings.ContainsAny(file, "/\\") {
+		return "", "", fmt.Errorf("invalid file name: %s", file)
+	}
+
+	service, _, ok := parseDisabledServiceFile(file)
+	if !ok {
+		return "", "", fmt.Errorf("not a disabled service file: %s", file)
+	}
+
+	path := filepath.Join(wm.configDir, "workspaces", workspace, "_rules", file)
+	if _, err := os.Stat(path); err != nil {
+		return "", "", fmt.Errorf("disabled service file %s not found in workspace %s", file, workspace)
+	}
+	return path, service, nil
+}
+
+// parseDisabledServiceFile splits "servicex.yaml.disabled-20060102-150405" into
+// the service name and the time it was disabled
+func parseDisabledServiceFile(file string) (string, time.Time, bool) {
+	idx := strings.LastIndex(file, disabledServiceMarker)
+	if idx <= 0 {
+		return "", time.Time{}, false
+	}
+
+	service := file[:idx]
+	disabledAt, err := time.ParseInLocation("20060102-150405", file[idx+len(disabledServiceMarker):], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return service, disabledAt, true
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestRenameWorkspace(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "",
+		"team":    "rules:\n  - match: {path: /servicex/users}\n    response: \"[200]\"\n",
+		"run":     "",
+	})
+	if err := wm.SetParent("run", "team"); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := wm.GetStore("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := st.SubscribeTraffic()
+	events := wm.SubscribeEvents()
+	defer wm.UnsubscribeEvents(events)
+
+	if err := wm.RenameWorkspace("team", "squad"); err != nil {
+		t.Fatalf("RenameWorkspace() error = %v", err)
+	}
+
+	// Event streams are told the new name
+	timeout := time.After(time.Second)
+	for renamed := false; !renamed; {
+		select {
+		case event := <-events:
+			renamed = event.Type == EventWorkspaceRenamed && event.Workspace == "team" && event.RenamedTo == "squad"
+		case <-timeout:
+			t.Fatalf("no %s event", EventWorkspaceRenamed)
+		}
+	}
+
+	// The loaded store moves with the workspace, keeping subscribers
+	renamed, err := wm.GetStore("squad")
+	if err != nil || renamed != st || st.Name() != "squad" {
+		t.Fatalf("GetStore(squad) = %p (%v), expected original store %p", renamed, err, st)
+	}
+	st.AddTraffic(models.TrafficEntry{ID: "1", Timestamp: time.Now()})
+	select {
+	case entry := <-sub:
+		if entry.ID != "1" {
+			t.Errorf("subscriber got %s, expected 1", entry.ID)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("subscriber did not survive rename")
+	}
+
+	// Children follow the rename
+	match := wm.MatchRule("run", "servicex", &models.RequestContext{Method: "GET", Path: "/servicex/users"})
+	if match.Workspace != "squad" {
+		t.Errorf("MatchRule() workspace = %q, expected squad", match.Workspace)
+	}
+
+	if err := wm.RenameWorkspace("default", "main"); err == nil {
+		t.Errorf("expected error renaming default")
+	}
+	if err := wm.RenameWorkspace("run", "squad"); err == nil {
+		t.Errorf("expected error renaming onto existing workspace")
+	}
+
+	// While a rename is in progress neither name is loaded, deleted or renamed again
+	wm.mu.Lock()
+	wm.renaming["run"], wm.renaming["crew"] = true, true
+	wm.mu.Unlock()
+	if _, err := wm.GetStore("crew"); err == nil {
+		t.Errorf("expected GetStore() to refuse a workspace being renamed")
+	}
+	if err := wm.DeleteWorkspace("run"); err == nil {
+		t.Errorf("expected DeleteWorkspace() to refuse a workspace being renamed")
+	}
+	if err := wm.RenameWorkspace("run", "other"); err == nil {
+		t.Errorf("expected a second rename to be refused")
+	}
+}
+
+func TestRestoreDisabledService(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - match: {path: /servicex/users}\n    response: \"[200]\"\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DisableService("servicex", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := wm.GetDisabledServices()
+	if err != nil || len(services) != 1 || services[0].Service != "servicex" || services[0].RuleCount != 1 {
+		t.Fatalf("GetDisabledServices() = %+v, %v", services, err)
+	}
+
+	if _, err := wm.RestoreService("default", "../servicex.yaml"); err == nil {
+		t.Errorf("expected error for path traversal")
+	}
+
+	service, err := wm.RestoreService("default", services[0].File)
+	if err != nil || service != "servicex" {
+		t.Fatalf("RestoreService() = %q, %v", service, err)
+	}
+	if len(st.GetRules("servicex")) != 1 {
+		t.Errorf("restored service rules not loaded")
+	}
+}
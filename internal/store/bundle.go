@@ -0,0 +1,521 @@
+package store
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// bundleFormatVersion is bumped when the bundle layout changes incompatibly
+const bundleFormatVersion = 1
+
+// ErrWorkspaceExists is returned when an import's target workspace already exists
+var ErrWorkspaceExists = errors.New("workspace already exists")
+
+// ErrBundleTooLarge is returned when a bundle's contents expand beyond the import limits
+var ErrBundleTooLarge = errors.New("bundle too large")
+
+// Limits on the uncompressed contents of an imported bundle, so a small, highly
+// compressed archive (a zip bomb) can't exhaust memory
+var (
+	maxBundleFileSize  int64 = 256 << 20 // Any one file (traffic.ndjson is usually the largest)
+	maxBundleTotalSize int64 = 512 << 20 // All files together
+)
+
+// configRefRegex finds config keys referenced from rule templates, e.g. {{ config `API_KEY` }}
+var configRefRegex = regexp.MustCompile("config\\s+[`\"]([^`\"]+)[`\"]")
+
+// BundleManifest describes a workspace bundle (stored as bundle.json)
+type BundleManifest struct {
+	FormatVersion int       `json:"format_version"`
+	Workspace     string    `json:"workspace"`
+	ExportedAt    time.Time `json:"exported_at"`
+	Services      []string  `json:"services"`
+	Libraries     []string  `json:"libraries,omitempty"` // Shared libraries the rules include
+	HasTraffic    bool      `json:"has_traffic"`
+}
+
+// ExportOptions controls what goes into a workspace bundle
+type ExportOptions struct {
+	IncludeTraffic bool
+}
+
+// ImportOptions controls how a bundle is imported
+type ImportOptions struct {
+	Name        string // Target workspace name (defaults to the exported name)
+	OnConflict  string // "fail" (default), "rename" or "overwrite"
+	SkipTraffic bool   // Don't import traffic.ndjson even if present
+}
+
+// ImportResult reports what an import did
+type ImportResult struct {
+	Name              string   `json:"name"`
+	Services          []string `json:"services"`
+	Libraries         []string `json:"libraries,omitempty"` // Shared libraries added to this config
+	TrafficImported   bool     `json:"traffic_imported"`
+	ConfigKeys        []string `json:"config_keys"`         // Config keys referenced by the rules
+	MissingConfigKeys []string `json:"missing_config_keys"` // Referenced keys with no value in this config
+	Warnings          []string `json:"warnings,omitempty"`
+}
+
+// ExportWorkspace writes a workspace as a zip bundle containing bundle.json,
+// _rules/*.yaml, the included _library/*.yaml, metadata.json, config.json
+// (referenced keys only, values blanked) and optionally traffic.ndjson
+func (wm *WorkspaceManager) ExportWorkspace(name string, w io.Writer, opts ExportOptions) error {
+	if err := ValidateWorkspaceName(name); err != nil {
+		return err
+	}
+	if !wm.workspaceExists(name) {
+		return fmt.Errorf("workspace %s not found", name)
+	}
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+
+	ruleFiles, err := filepath.Glob(filepath.Join(workspaceDir, "_rules", "*.yaml"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(ruleFiles)
+
+	zw := zip.NewWriter(w)
+
+	manifest := BundleManifest{
+		FormatVersion: bundleFormatVersion,
+		Workspace:     name,
+		ExportedAt:    time.Now(),
+		Services:      []string{},
+	}
+
+	// Rules, collecting referenced config keys and libraries as we go
+	keys := make(map[string]bool)
+	libraries := make(map[string]bool)
+	for _, file := range ruleFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			zw.Close()
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		if err := writeZipFile(zw, "_rules/"+filepath.Base(file), data); err != nil {
+			zw.Close()
+			return err
+		}
+		if isRulesFile(file) {
+			manifest.Services = append(manifest.Services, getServiceName(file))
+		}
+		for _, key := range referencedConfigKeys(data) {
+			keys[key] = true
+		}
+		for _, library := range includedLibraries(data) {
+			libraries[library] = true
+		}
+	}
+
+	// Shared libraries the rules include (missing ones are left out)
+	libraryNames := make([]string, 0, len(libraries))
+	for library := range libraries {
+		libraryNames = append(libraryNames, library)
+	}
+	sort.Strings(libraryNames)
+	for _, library := range libraryNames {
+		data, err := os.ReadFile(filepath.Join(wm.configDir, "_library", library+".yaml"))
+		if err != nil {
+			continue
+		}
+		if err := writeZipFile(zw, "_library/"+library+".yaml", data); err != nil {
+			zw.Close()
+			return err
+		}
+		manifest.Libraries = append(manifest.Libraries, library)
+		for _, key := range referencedConfigKeys(data) {
+			keys[key] = true
+		}
+	}
+
+	// Metadata (bird icon, parent, ...)
+	if data, err := os.ReadFile(filepath.Join(workspaceDir, "metadata.json")); err == nil {
+		if err := writeZipFile(zw, "metadata.json", data); err != nil {
+			zw.Close()
+			return err
+		}
+	}
+
+	// Config keys the rules reference - secrets are never exported
+	values := make(map[string]string, len(keys))
+	for key := range keys {
+		values[key] = ""
+	}
+	configData, _ := json.MarshalIndent(map[string]interface{}{"values": values}, "", "  ")
+	if err := writeZipFile(zw, "config.json", configData); err != nil {
+		zw.Close()
+		return err
+	}
+
+	// Traffic history
+	if opts.IncludeTraffic {
+		wm.flushTraffic(name)
+		if data, err := readTrafficNDJSON(workspaceDir, wm.config); err == nil {
+			if err := writeZipFile(zw, "traffic.ndjson", data); err != nil {
+				zw.Close()
+				return err
+			}
+			manifest.HasTraffic = true
+		}
+	}
+
+	manifestData, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := writeZipFile(zw, "bundle.json", manifestData); err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+// ImportWorkspace creates a workspace from a zip bundle written by ExportWorkspace
+func (wm *WorkspaceManager) ImportWorkspace(r io.ReaderAt, size int64, opts ImportOptions) (*ImportResult, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	// Read and validate bundle contents before touching the config dir
+	var manifest BundleManifest
+	var metadataData, configData, trafficData []byte
+	rules := make(map[string][]byte)
+	libraries := make(map[string][]byte)
+
+	remaining := maxBundleTotalSize
+	for _, f := range zr.File {
+		name := path.Clean(f.Name)
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		data, err := readZipFile(f, min(maxBundleFileSize, remaining))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle: %w", name, err)
+		}
+		remaining -= int64(len(data))
+
+		switch {
+		case name == "bundle.json":
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return nil, fmt.Errorf("invalid bundle.json: %w", err)
+			}
+		case name == "metadata.json":
+			metadataData = data
+		case name == "config.json":
+			configData = data
+		case name == "traffic.ndjson":
+			trafficData = data
+		case path.Dir(name) == "_rules" && path.Ext(name) == ".yaml":
+			service := strings.TrimSuffix(path.Base(name), ".yaml")
+			if err := validateServiceName(service); err != nil {
+				return nil, err
+			}
+			var serviceRules models.ServiceRules
+			if err := yaml.Unmarshal(data, &serviceRules); err != nil {
+				return nil, fmt.Errorf("invalid rules for %s: %w", service, err)
+			}
+			rules[service] = data
+		case path.Dir(name) == "_library" && path.Ext(name) == ".yaml":
+			library := strings.TrimSuffix(path.Base(name), ".yaml")
+			if err := validateServiceName(library); err != nil {
+				return nil, err
+			}
+			var libraryRules models.ServiceRules
+			if err := yaml.Unmarshal(data, &libraryRules); err != nil {
+				return nil, fmt.Errorf("invalid library %s: %w", library, err)
+			}
+			libraries[library] = data
+		default:
+			// Unknown files are ignored (never written outside the workspace)
+		}
+	}
+
+	if manifest.FormatVersion == 0 {
+		return nil, fmt.Errorf("invalid bundle: missing bundle.json")
+	}
+	if manifest.FormatVersion > bundleFormatVersion {
+		return nil, fmt.Errorf("bundle format %d is newer than supported (%d)", manifest.FormatVersion, bundleFormatVersion)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = manifest.Workspace
+	}
+	if err := ValidateWorkspaceName(name); err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Name: name, Services: []string{}}
+
+	// Conflict handling; an overwritten workspace is only replaced once the new one is ready
+	overwrite := false
+	if wm.workspaceExists(name) {
+		switch opts.OnConflict {
+		case "", "fail":
+			return nil, fmt.Errorf("%w: %s", ErrWorkspaceExists, name)
+		case "rename":
+			base := name
+			for i := 2; wm.workspaceExists(name); i++ {
+				name = fmt.Sprintf("%s-%d", base, i)
+			}
+			result.Name = name
+		case "overwrite":
+			if name == "default" {
+				return nil, fmt.Errorf("cannot overwrite the default workspace")
+			}
+			overwrite = true
+		default:
+			return nil, fmt.Errorf("invalid conflict mode %q (use fail, rename or overwrite)", opts.OnConflict)
+		}
+	}
+
+	// Build the workspace in a staging directory next to workspaces/ (so it can be
+	// renamed into place) and out of sight of the workspace watcher
+	stagingDir, err := os.MkdirTemp(wm.configDir, ".import-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	rulesDir := filepath.Join(stagingDir, "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	services := make([]string, 0, len(rules))
+	for service := range rules {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	keys := make(map[string]bool)
+	included := make(map[string]bool)
+	for _, service := range services {
+		if err := os.WriteFile(filepath.Join(rulesDir, service+".yaml"), rules[service], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write rules for %s: %w", service, err)
+		}
+		if isRulesFile(service + ".yaml") {
+			result.Services = append(result.Services, service)
+		}
+		for _, key := range referencedConfigKeys(rules[service]) {
+			keys[key] = true
+		}
+		for _, library := range includedLibraries(rules[service]) {
+			included[library] = true
+		}
+	}
+
+	// Metadata: keep icon and parent, but an import is a fresh, permanent workspace
+	metadata := WorkspaceMetadata{BirdIcon: birdIcons[0]}
+	if metadataData != nil {
+		json.Unmarshal(metadataData, &metadata)
+	}
+	metadata.Created = time.Now()
+	metadata.Ephemeral = false
+	metadata.ExpiresAt = nil
+	if metadata.Parent != "" && (metadata.Parent == name || !wm.workspaceExists(metadata.Parent)) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("parent workspace %s not found, inheriting from default", metadata.Parent))
+		metadata.Parent = ""
+	}
+	if err := saveWorkspaceMetadata(stagingDir, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to save workspace metadata: %w", err)
+	}
+
+	if trafficData != nil && !opts.SkipTraffic {
+		if err := os.WriteFile(filepath.Join(stagingDir, "traffic.ndjson"), trafficData, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write traffic: %w", err)
+		}
+		result.TrafficImported = true
+	}
+
+	// Shared libraries are added if missing; a local library of the same name wins
+	libraryDir := filepath.Join(wm.configDir, "_library")
+	includedNames := make([]string, 0, len(included))
+	for library := range included {
+		includedNames = append(includedNames, library)
+	}
+	sort.Strings(includedNames)
+	for _, library := range includedNames {
+		libraryPath := filepath.Join(libraryDir, library+".yaml")
+		existing, err := os.ReadFile(libraryPath)
+		data, bundled := libraries[library]
+
+		switch {
+		case err == nil && bundled && string(existing) != string(data):
+			result.Warnings = append(result.Warnings, fmt.Sprintf("library %s already exists and differs from the bundled one, keeping the local library", library))
+		case err == nil:
+			// Already present
+		case !bundled:
+			result.Warnings = append(result.Warnings, fmt.Sprintf("included library %s not found", library))
+		default:
+			if err := os.MkdirAll(libraryDir, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create library directory: %w", err)
+			}
+			if err := writeFileAtomic(libraryPath, data, 0644); err != nil {
+				return nil, fmt.Errorf("failed to write library %s: %w", library, err)
+			}
+			result.Libraries = append(result.Libraries, library)
+			for _, key := range referencedConfigKeys(data) {
+				keys[key] = true
+			}
+		}
+	}
+
+	// Swap the new workspace into place
+	if err := wm.installWorkspace(name, stagingDir, overwrite); err != nil {
+		return nil, err
+	}
+
+	// Report config keys the rules need, and which are missing here
+	if configData != nil {
+		var bundleConfig struct {
+			Values map[string]string `json:"values"`
+		}
+		if err := json.Unmarshal(configData, &bundleConfig); err == nil {
+			for key := range bundleConfig.Values {
+				keys[key] = true
+			}
+		}
+	}
+	result.ConfigKeys = []string{}
+	result.MissingConfigKeys = []string{}
+	for key := range keys {
+		result.ConfigKeys = append(result.ConfigKeys, key)
+		if wm.config.Get(key) == "" {
+			result.MissingConfigKeys = append(result.MissingConfigKeys, key)
+		}
+	}
+	sort.Strings(result.ConfigKeys)
+	sort.Strings(result.MissingConfigKeys)
+
+	return result, nil
+}
+
+// installWorkspace moves a workspace built in stagingDir into place under name
+// With replace, the existing workspace is unloaded and kept until the new one is in place
+func (wm *WorkspaceManager) installWorkspace(name, stagingDir string, replace bool) error {
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+	if err := os.MkdirAll(filepath.Dir(workspaceDir), 0755); err != nil {
+		return fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer wm.invalidateParents()
+
+	if !replace {
+		if err := os.Rename(stagingDir, workspaceDir); err != nil {
+			return fmt.Errorf("failed to create workspace: %w", err)
+		}
+		return nil
+	}
+
+	// Requests must not reload the old workspace while it is swapped out
+	wm.mu.Lock()
+	if wm.deleting[name] {
+		wm.mu.Unlock()
+		return fmt.Errorf("workspace %s is being deleted", name)
+	}
+	if wm.renaming[name] {
+		wm.mu.Unlock()
+		return fmt.Errorf("workspace %s is being renamed", name)
+	}
+	wm.deleting[name] = true
+	wm.mu.Unlock()
+	defer func() {
+		wm.mu.Lock()
+		delete(wm.deleting, name)
+		wm.mu.Unlock()
+	}()
+
+	if err := wm.UnloadWorkspace(name); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	oldDir := stagingDir + ".old"
+	if err := os.Rename(workspaceDir, oldDir); err != nil {
+		return fmt.Errorf("failed to replace workspace: %w", err)
+	}
+	if err := os.Rename(stagingDir, workspaceDir); err != nil {
+		// Put the original back
+		if restoreErr := os.Rename(oldDir, workspaceDir); restoreErr != nil {
+			return fmt.Errorf("failed to replace workspace: %w (the original is kept in %s)", err, oldDir)
+		}
+		return fmt.Errorf("failed to replace workspace: %w", err)
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		fmt.Printf("Warning: Failed to remove replaced workspace %s: %v\n", oldDir, err)
+	}
+	return nil
+}
+
+// referencedConfigKeys returns the config keys referenced by rule templates
+func referencedConfigKeys(data []byte) []string {
+	var keys []string
+	for _, m := range configRefRegex.FindAllSubmatch(data, -1) {
+		keys = append(keys, string(m[1]))
+	}
+	return keys
+}
+
+// includedLibraries returns the shared libraries a rules file includes
+// (names that aren't valid file names are skipped)
+func includedLibraries(data []byte) []string {
+	var serviceRules models.ServiceRules
+	if err := yaml.Unmarshal(data, &serviceRules); err != nil {
+		return nil
+	}
+
+	libraries := make([]string, 0, len(serviceRules.Include))
+	for _, inc := range serviceRules.Include {
+		if validateServiceName(inc.Library) == nil {
+			libraries = append(libraries, inc.Library)
+		}
+	}
+	return libraries
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to bundle: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s to bundle: %w", name, err)
+	}
+	return nil
+}
+
+// readZipFile reads a file from a bundle, failing with ErrBundleTooLarge if it's over
+// limit bytes once uncompressed (whatever its header claims)
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(limit) {
+		return nil, fmt.Errorf("%w: %s expands to more than %d bytes", ErrBundleTooLarge, f.Name, limit)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s expands to more than %d bytes", ErrBundleTooLarge, f.Name, limit)
+	}
+	return data, nil
+}
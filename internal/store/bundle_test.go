@@ -0,0 +1,150 @@
+package store
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportImportWorkspace(t *testing.T) {
+	rules := "rules:\n  - match: {path: /servicex/users}\n    response: \"[200]\\n{\\\"key\\\": \\\"{{ config `API_KEY` }}\\\"}\"\n"
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": rules})
+	wm.config.Values["API_KEY"] = "secret-value"
+
+	var buf bytes.Buffer
+	if err := wm.ExportWorkspace("team", &buf, ExportOptions{}); err != nil {
+		t.Fatalf("ExportWorkspace() error = %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret-value")) {
+		t.Fatalf("bundle must not contain config values")
+	}
+	bundle := bytes.NewReader(buf.Bytes())
+
+	// Same name conflicts unless a conflict mode is given
+	if _, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{}); err == nil {
+		t.Errorf("expected conflict error importing over existing workspace")
+	}
+
+	result, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{OnConflict: "rename"})
+	if err != nil {
+		t.Fatalf("ImportWorkspace(rename) error = %v", err)
+	}
+	if result.Name != "team-2" || !reflect.DeepEqual(result.Services, []string{"servicex"}) {
+		t.Errorf("ImportWorkspace(rename) = %+v", result)
+	}
+	if !reflect.DeepEqual(result.ConfigKeys, []string{"API_KEY"}) || len(result.MissingConfigKeys) != 0 {
+		t.Errorf("config keys = %v, missing = %v", result.ConfigKeys, result.MissingConfigKeys)
+	}
+
+	imported, err := os.ReadFile(filepath.Join(wm.configDir, "workspaces", "team-2", "_rules", "servicex.yaml"))
+	if err != nil || string(imported) != rules {
+		t.Errorf("imported rules = %q, %v", imported, err)
+	}
+
+	// Missing config keys are reported on import
+	delete(wm.config.Values, "API_KEY")
+	result, err = wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{Name: "copy"})
+	if err != nil {
+		t.Fatalf("ImportWorkspace(copy) error = %v", err)
+	}
+	if !reflect.DeepEqual(result.MissingConfigKeys, []string{"API_KEY"}) {
+		t.Errorf("missing config keys = %v", result.MissingConfigKeys)
+	}
+
+	if _, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{Name: "copy", OnConflict: "overwrite"}); err != nil {
+		t.Errorf("ImportWorkspace(overwrite) error = %v", err)
+	}
+}
+
+func TestImportOverwriteKeepsOriginalOnFailure(t *testing.T) {
+	rules := "include: [shared]\nrules:\n  - match: {path: /servicex/users}\n    response: \"[200]\"\n"
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": rules})
+	libraryDir := filepath.Join(wm.configDir, "_library")
+	if err := os.MkdirAll(libraryDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(libraryDir, "shared.yaml"), []byte("rules: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := wm.ExportWorkspace("team", &buf, ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	bundle := bytes.NewReader(buf.Bytes())
+
+	if _, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{}); !errors.Is(err, ErrWorkspaceExists) {
+		t.Errorf("ImportWorkspace() error = %v, expected ErrWorkspaceExists", err)
+	}
+
+	// Make writing the bundled library fail part way through the import
+	if err := os.RemoveAll(libraryDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(libraryDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{OnConflict: "overwrite"}); err == nil {
+		t.Fatalf("expected the import to fail")
+	}
+	if data, err := os.ReadFile(filepath.Join(wm.configDir, "workspaces", "team", "_rules", "servicex.yaml")); err != nil || string(data) != rules {
+		t.Errorf("original workspace was not kept: %q, %v", data, err)
+	}
+
+	// No staging directories are left behind
+	if leftovers, _ := filepath.Glob(filepath.Join(wm.configDir, ".import-*")); len(leftovers) != 0 {
+		t.Errorf("leftover staging directories: %v", leftovers)
+	}
+}
+
+func TestImportRejectsOversizedBundles(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": ""})
+	defer func(file, total int64) { maxBundleFileSize, maxBundleTotalSize = file, total }(maxBundleFileSize, maxBundleTotalSize)
+	maxBundleFileSize, maxBundleTotalSize = 1<<20, 3<<19
+
+	zeros := make([]byte, 2<<20)
+	tests := []struct {
+		name  string
+		write func(zw *zip.Writer) error
+	}{
+		{"oversized file", func(zw *zip.Writer) error {
+			return writeZipFile(zw, "traffic.ndjson", zeros)
+		}},
+		{"oversized total", func(zw *zip.Writer) error {
+			if err := writeZipFile(zw, "traffic.ndjson", zeros[:1<<20]); err != nil {
+				return err
+			}
+			return writeZipFile(zw, "config.json", zeros[:1<<20])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			if err := writeZipFile(zw, "bundle.json", []byte(`{"format_version": 1, "workspace": "big"}`)); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.write(zw); err != nil {
+				t.Fatal(err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.Len() > 64<<10 {
+				t.Fatalf("bundle is %d bytes, expected a small compressed archive", buf.Len())
+			}
+
+			bundle := bytes.NewReader(buf.Bytes())
+			if _, err := wm.ImportWorkspace(bundle, bundle.Size(), ImportOptions{}); !errors.Is(err, ErrBundleTooLarge) {
+				t.Errorf("ImportWorkspace() error = %v, expected ErrBundleTooLarge", err)
+			}
+			if _, err := os.Stat(filepath.Join(wm.configDir, "workspaces", "big")); !os.IsNotExist(err) {
+				t.Errorf("workspace was created from an oversized bundle")
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// janitorInterval is how often expired ephemeral workspaces and traffic are purged
+const janitorInterval = 30 * time.Second
+
+// EphemeralOptions configures a throwaway workspace (e.g. one per CI test run)
+type EphemeralOptions struct {
+	Name   string                   // Generated if empty
+	TTL    time.Duration            // Purged after this long (0 = only on explicit teardown)
+	Parent string                   // Workspace to inherit from (defaults to "default")
+	Rules  map[string][]models.Rule // Inline rule set: service name -> rules
+}
+
+// CreateEphemeralWorkspace creates a workspace in one call for a test run
+// Unlike CreateWorkspace it starts with only the given rules (no copy of default),
+// relying on the inheritance chain for anything else
+func (wm *WorkspaceManager) CreateEphemeralWorkspace(opts EphemeralOptions) (*WorkspaceMetadata, string, error) {
+	name := opts.Name
+	if name == "" {
+		name = "test-" + strings.Split(uuid.New().String(), "-")[0]
+	}
+	if err := ValidateWorkspaceName(name); err != nil {
+		return nil, "", err
+	}
+	for service := range opts.Rules {
+		if err := validateServiceName(service); err != nil {
+			return nil, "", err
+		}
+	}
+
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+	if _, err := os.Stat(workspaceDir); err == nil {
+		return nil, "", fmt.Errorf("workspace %s already exists", name)
+	}
+
+	// Create workspace directory structure
+	rulesDir := filepath.Join(workspaceDir, "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		return nil, "", fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	// From here on, remove the half-created workspace on failure
+	fail := func(err error) (*WorkspaceMetadata, string, error) {
+		os.RemoveAll(workspaceDir)
+		wm.invalidateParents()
+		return nil, "", err
+	}
+
+	for service, rules := range opts.Rules {
+		data, err := yaml.Marshal(models.ServiceRules{Rules: rules})
+		if err != nil {
+			return fail(fmt.Errorf("failed to marshal rules for %s: %w", service, err))
+		}
+		if err := os.WriteFile(filepath.Join(rulesDir, service+".yaml"), data, 0644); err != nil {
+			return fail(fmt.Errorf("failed to write rules for %s: %w", service, err))
+		}
+	}
+
+	metadata := WorkspaceMetadata{
+		BirdIcon:  birdIcons[rand.Intn(len(birdIcons))],
+		Created:   time.Now(),
+		Ephemeral: true,
+	}
+	if opts.TTL > 0 {
+		expiresAt := metadata.Created.Add(opts.TTL)
+		metadata.ExpiresAt = &expiresAt
+	}
+	if err := saveWorkspaceMetadata(workspaceDir, &metadata); err != nil {
+		return fail(fmt.Errorf("failed to save workspace metadata: %w", err))
+	}
+
+	// SetParent validates the parent exists and that there is no cycle
+	if opts.Parent != "" {
+		if err := wm.SetParent(name, opts.Parent); err != nil {
+			return fail(err)
+		}
+		metadata.Parent = opts.Parent
+	}
+
+	return &metadata, name, nil
+}
+
+// DeleteWorkspace permanently removes a workspace (rules, traffic and metadata)
+// and unloads it from memory
+func (wm *WorkspaceManager) DeleteWorkspace(name string) error {
+	if err := ValidateWorkspaceName(name); err != nil {
+		return err
+	}
+	if name == "default" {
+		return fmt.Errorf("cannot delete default workspace")
+	}
+
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+	if _, err := os.Stat(workspaceDir); os.IsNotExist(err) {
+		return fmt.Errorf("workspace %s not found", name)
+	}
+
+	// Requests still in flight must not reload (and so recreate) the workspace
+	wm.mu.Lock()
+	if wm.deleting[name] {
+		wm.mu.Unlock()
+		return fmt.Errorf("workspace %s is already being deleted", name)
+	}
+	if wm.renaming[name] {
+		wm.mu.Unlock()
+		return fmt.Errorf("workspace %s is being renamed", name)
+	}
+	wm.deleting[name] = true
+	wm.mu.Unlock()
+	defer func() {
+		wm.mu.Lock()
+		delete(wm.deleting, name)
+		wm.mu.Unlock()
+	}()
+
+	if err := wm.UnloadWorkspace(name); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	if err := os.RemoveAll(workspaceDir); err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+
+	wm.invalidateParents()
+	return nil
+}
+
+// IsEphemeral reports whether a workspace was created as an ephemeral workspace
+func (wm *WorkspaceManager) IsEphemeral(name string) bool {
+	if !wm.workspaceExists(name) {
+		return false
+	}
+	return loadWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", name)).Ephemeral
+}
+
+// runJanitor periodically purges expired ephemeral workspaces, traffic outside retention
+// policies and old rule versions, saves rule match counts (and, if configured, removes
+// expired rules) until Close
+func (wm *WorkspaceManager) runJanitor() {
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			wm.expireWorkspaces()
+			wm.applyRetention()
+			wm.trimHistories()
+			wm.flushRuleHits()
+			if wm.config != nil && wm.config.CleanupExpiredRules {
+				wm.cleanupExpiredRules()
+			}
+		case <-wm.done:
+			return
+		}
+	}
+}
+
+// expireWorkspaces purges every ephemeral workspace whose TTL has passed
+func (wm *WorkspaceManager) expireWorkspaces() {
+	workspacesDir := filepath.Join(wm.configDir, "workspaces")
+	entries, err := os.ReadDir(workspacesDir)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasSuffix(entry.Name(), ".disabled") {
+			continue
+		}
+
+		metadata := loadWorkspaceMetadata(filepath.Join(workspacesDir, entry.Name()))
+		if !metadata.Ephemeral || metadata.ExpiresAt == nil || metadata.ExpiresAt.After(now) {
+			continue
+		}
+
+		if err := wm.DeleteWorkspace(entry.Name()); err != nil {
+			fmt.Printf("Warning: Failed to purge expired workspace %s: %v\n", entry.Name(), err)
+			continue
+		}
+		fmt.Printf("Purged expired workspace '%s'\n", entry.Name())
+	}
+}
+
+// validateServiceName checks that a service name is safe to use as a file name
+func validateServiceName(service string) error {
+	if service == "" {
+		return fmt.Errorf("service name cannot be empty")
+	}
+	if strings.ContainsAny(service, "/\\") || service == "." || service == ".." {
+		return fmt.Errorf("invalid service name: %s", service)
+	}
+	return nil
+}
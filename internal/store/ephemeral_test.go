@@ -0,0 +1,134 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestCreateEphemeralWorkspace(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": ""})
+
+	rules := map[string][]models.Rule{
+		"servicex": {{Match: models.MatchCondition{Method: []string{"GET"}, Path: "/servicex/users"}, Response: "[200]"}},
+	}
+	metadata, name, err := wm.CreateEphemeralWorkspace(EphemeralOptions{TTL: time.Hour, Parent: "team", Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metadata.Ephemeral || metadata.ExpiresAt == nil || metadata.Parent != "team" || !wm.IsEphemeral(name) {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if chain, _ := wm.Chain(name); len(chain) != 3 || chain[1] != "team" {
+		t.Errorf("chain = %v", chain)
+	}
+	st, err := wm.GetStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.GetRules("servicex")) != 1 {
+		t.Errorf("rules = %+v", st.GetAllRules())
+	}
+
+	tests := []struct {
+		name string
+		opts EphemeralOptions
+	}{
+		{"existing name", EphemeralOptions{Name: name}},
+		{"missing parent", EphemeralOptions{Parent: "missing"}},
+		{"invalid service", EphemeralOptions{Rules: map[string][]models.Rule{"../x": nil}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := wm.CreateEphemeralWorkspace(tt.opts); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+
+	// A failed create leaves nothing behind
+	workspaces, _ := wm.GetWorkspaces()
+	if len(workspaces) != 3 {
+		t.Errorf("workspaces = %+v", workspaces)
+	}
+}
+
+func TestExpireWorkspaces(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": ""})
+
+	_, expired, err := wm.CreateEphemeralWorkspace(EphemeralOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, live, err := wm.CreateEphemeralWorkspace(EphemeralOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, kept, err := wm.CreateEphemeralWorkspace(EphemeralOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wm.GetStore(expired); err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	expiredDir := filepath.Join(wm.configDir, "workspaces", expired)
+	metadata := loadWorkspaceMetadata(expiredDir)
+	metadata.ExpiresAt = &past
+	if err := saveWorkspaceMetadata(expiredDir, &metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	wm.expireWorkspaces()
+	if wm.workspaceExists(expired) {
+		t.Errorf("expired workspace %s was not purged", expired)
+	}
+	if !wm.workspaceExists(live) || !wm.workspaceExists(kept) {
+		t.Errorf("unexpired workspaces were purged")
+	}
+
+	// The janitor also purges at startup
+	metadata = loadWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", live))
+	metadata.ExpiresAt = &past
+	if err := saveWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", live), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := NewWorkspaceManager(wm.configDir, &config.Config{ConfigDir: wm.configDir, MaxTrafficEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	if restarted.workspaceExists(live) {
+		t.Errorf("expired workspace %s was not purged at startup", live)
+	}
+}
+
+func TestGetStoreRefusesDeletingWorkspace(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": ""})
+
+	wm.mu.Lock()
+	wm.deleting["team"] = true
+	wm.mu.Unlock()
+
+	if _, err := wm.GetStore("team"); err == nil {
+		t.Errorf("expected GetStore() to refuse a workspace being deleted")
+	}
+	if err := wm.DeleteWorkspace("team"); err == nil {
+		t.Errorf("expected a second delete to be refused")
+	}
+
+	wm.mu.Lock()
+	delete(wm.deleting, "team")
+	wm.mu.Unlock()
+
+	if err := wm.DeleteWorkspace("team"); err != nil {
+		t.Fatal(err)
+	}
+	if wm.workspaceExists("team") {
+		t.Errorf("workspace was not deleted")
+	}
+}
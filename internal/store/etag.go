@@ -0,0 +1,52 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPreconditionFailed is returned when an If-Match ETag no longer matches a service's rules
+var ErrPreconditionFailed = errors.New("rules were changed by someone else, reload and try again")
+
+// ServiceETag returns an ETag for the current rules, settings and includes of a service
+func (s *Store) ServiceETag(service string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.serviceETag(service)
+}
+
+// serviceETag hashes the in-memory rules, settings and includes of a service
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) serviceETag(service string) string {
+	data, _ := yaml.Marshal(s.serviceRules(service))
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// checkETag verifies an If-Match header value against a service's current ETag
+// An empty ifMatch always passes; "*" passes if the service exists
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) checkETag(service, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+
+	current := s.serviceETag(service)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			if _, ok := s.rules[service]; ok {
+				return nil
+			}
+			continue
+		}
+		if strings.TrimPrefix(tag, "W/") == current {
+			return nil
+		}
+	}
+	return ErrPreconditionFailed
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestIfMatch(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - id: a\n    match: {path: /servicex/a}\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	etag := st.ServiceETag("servicex")
+	rule := models.Rule{Match: models.MatchCondition{Path: "/servicex/b"}}
+
+	// First editor wins, second editor's stale ETag is rejected
+	if _, err := st.AddRule("servicex", rule, etag); err != nil {
+		t.Fatalf("AddRule() with current ETag error = %v", err)
+	}
+	if err := st.DeleteRuleByID("servicex", "a", etag); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("DeleteRuleByID() with stale ETag error = %v, expected ErrPreconditionFailed", err)
+	}
+	if err := st.DeleteRuleByID("servicex", "a", "*"); err != nil {
+		t.Errorf("DeleteRuleByID() with If-Match * error = %v", err)
+	}
+	if _, err := st.AddRule("newservice", rule, "*"); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("AddRule() with If-Match * on missing service error = %v", err)
+	}
+}
+
+func TestParseErrorKeepsLastGoodRules(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - id: a\n    match: {path: /servicex/a}\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(wm.configDir, "workspaces", "default", "_rules", "servicex.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - match: [unclosed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.loadRulesFromFile("servicex", file); err == nil {
+		t.Fatalf("expected parse error")
+	}
+
+	if rules := st.GetRules("servicex"); len(rules) != 1 || rules[0].ID != "a" {
+		t.Errorf("rules after parse error = %+v, expected last good rules", rules)
+	}
+	if _, ok := st.GetLoadErrors()["servicex"]; !ok {
+		t.Errorf("parse error not reported")
+	}
+
+	if err := os.WriteFile(file, []byte("rules:\n  - id: b\n    match: {path: /servicex/b}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.loadRulesFromFile("servicex", file); err != nil {
+		t.Fatalf("loadRulesFromFile() error = %v", err)
+	}
+	if len(st.GetLoadErrors()) != 0 {
+		t.Errorf("load error not cleared after a good load")
+	}
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// Change event types
+const (
+	EventRulesChanged     = "rules.changed"     // A service's rules were changed (API, file or rollback)
+	EventRulesRemoved     = "rules.removed"     // A service's rules file was removed, renamed or disabled
+	EventRulesError       = "rules.error"       // A service's rules file failed to load (last good rules kept)
+	EventWorkspaceCreated = "workspace.created" // A workspace directory appeared
+	EventWorkspaceRemoved = "workspace.removed" // A workspace directory was removed, renamed or disabled
+	EventWorkspaceRenamed = "workspace.renamed" // A workspace was renamed through the API (RenamedTo is the new name)
+)
+
+// SubscribeEvents creates a new channel for rule and workspace change events
+func (wm *WorkspaceManager) SubscribeEvents() <-chan models.ChangeEvent {
+	wm.eventsMu.Lock()
+	defer wm.eventsMu.Unlock()
+
+	ch := make(chan models.ChangeEvent, 32)
+	wm.eventSubscribers[ch] = struct{}{}
+	return ch
+}
+
+// UnsubscribeEvents removes an event subscriber channel
+func (wm *WorkspaceManager) UnsubscribeEvents(ch <-chan models.ChangeEvent) {
+	wm.eventsMu.Lock()
+	defer wm.eventsMu.Unlock()
+
+	for writeCh := range wm.eventSubscribers {
+		if (<-chan models.ChangeEvent)(writeCh) == ch {
+			delete(wm.eventSubscribers, writeCh)
+			close(writeCh)
+			return
+		}
+	}
+}
+
+// publish broadcasts a change event to all subscribers (non-blocking)
+func (wm *WorkspaceManager) publish(event models.ChangeEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	wm.eventsMu.Lock()
+	defer wm.eventsMu.Unlock()
+
+	for ch := range wm.eventSubscribers {
+		select {
+		case ch <- event:
+		default:
+			// Channel full, skip this subscriber
+		}
+	}
+}
+
+// closeEventSubscribers closes all event subscriber channels (on shutdown)
+func (wm *WorkspaceManager) closeEventSubscribers() {
+	wm.eventsMu.Lock()
+	defer wm.eventsMu.Unlock()
+
+	for ch := range wm.eventSubscribers {
+		close(ch)
+	}
+	wm.eventSubscribers = make(map[chan models.ChangeEvent]struct{})
+}
+
+// watchWorkspaces reports workspace directories created or removed on disk
+// (by hand, by another process, or by this one) until Close
+func (wm *WorkspaceManager) watchWorkspaces() {
+	workspacesDir := filepath.Join(wm.configDir, "workspaces")
+	if err := os.MkdirAll(workspacesDir, 0755); err != nil {
+		fmt.Printf("Warning: Failed to create workspaces directory: %v\n", err)
+		return
+	}
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Printf("Warning: Failed to watch workspaces: %v\n", err)
+		return
+	}
+	defer fsWatcher.Close()
+
+	if err := fsWatcher.Add(workspacesDir); err != nil {
+		fmt.Printf("Warning: Failed to watch workspaces: %v\n", err)
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+
+			name := filepath.Base(event.Name)
+			if strings.HasSuffix(name, ".disabled") || strings.HasPrefix(name, ".") {
+				continue
+			}
+
+			switch {
+			case event.Op&fsnotify.Create == fsnotify.Create:
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					wm.invalidateParents()
+					wm.publish(models.ChangeEvent{Type: EventWorkspaceCreated, Workspace: name})
+				}
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				wm.invalidateParents()
+				wm.unloadMissingWorkspace(name)
+				wm.publish(models.ChangeEvent{Type: EventWorkspaceRemoved, Workspace: name})
+			}
+
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("Watcher error: %v\n", err)
+
+		case <-wm.done:
+			return
+		}
+	}
+}
+
+// unloadMissingWorkspace unloads a workspace whose directory is gone
+// A workspace renamed through RenameWorkspace is already re-keyed, so it is left alone
+func (wm *WorkspaceManager) unloadMissingWorkspace(name string) {
+	if wm.workspaceExists(name) {
+		return
+	}
+
+	wm.mu.RLock()
+	st, loaded := wm.stores[name]
+	renaming := wm.renaming[name]
+	wm.mu.RUnlock()
+	if !loaded || renaming || st.Name() != name {
+		return
+	}
+
+	if err := wm.UnloadWorkspace(name); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// emit reports a change to the workspace manager, if the store belongs to one
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) emit(eventType, service, source, errMsg string) {
+	if s.onChange == nil {
+		return
+	}
+	s.onChange(models.ChangeEvent{
+		Type:      eventType,
+		Workspace: filepath.Base(s.configDir),
+		Service:   service,
+		Source:    source,
+		Error:     errMsg,
+		Timestamp: time.Now(),
+	})
+}
+
+// reconcileRules drops services whose rules file no longer exists
+// (deleted or renamed on disk), so the in-memory rules match the directory
+func (s *Store) reconcileRules() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rulesDir := filepath.Join(s.configDir, "_rules")
+	for service := range s.rules {
+		if _, err := os.Stat(filepath.Join(rulesDir, service+".yaml")); os.IsNotExist(err) {
+			s.forgetService(service)
+			fmt.Printf("Removed rules for service '%s' (file no longer exists)\n", service)
+			s.emit(EventRulesRemoved, service, HistorySourceFile, "")
+		}
+	}
+	for service := range s.loadErrors {
+		if _, err := os.Stat(filepath.Join(rulesDir, service+".yaml")); os.IsNotExist(err) {
+			delete(s.loadErrors, service)
+		}
+	}
+}
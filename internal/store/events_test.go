@@ -0,0 +1,68 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// waitForEvent returns the first event of the given type, or fails after a timeout
+func waitForEvent(t *testing.T, ch <-chan models.ChangeEvent, eventType string) models.ChangeEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-ch:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s event", eventType)
+			return models.ChangeEvent{}
+		}
+	}
+}
+
+func TestWatcherRemovesDeletedRules(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - id: a\n    match: {path: /servicex/a}\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := wm.SubscribeEvents()
+	defer wm.UnsubscribeEvents(events)
+
+	file := filepath.Join(wm.configDir, "workspaces", "default", "_rules", "servicex.yaml")
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+
+	event := waitForEvent(t, events, EventRulesRemoved)
+	if event.Workspace != "default" || event.Service != "servicex" || event.Source != HistorySourceFile {
+		t.Errorf("event = %+v", event)
+	}
+	if rules := st.GetRules("servicex"); len(rules) != 0 {
+		t.Errorf("rules still live after file removed: %+v", rules)
+	}
+}
+
+func TestWatcherReportsNewWorkspaces(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": ""})
+	events := wm.SubscribeEvents()
+	defer wm.UnsubscribeEvents(events)
+
+	// Give the workspace watcher time to start
+	time.Sleep(50 * time.Millisecond)
+	if err := os.MkdirAll(filepath.Join(wm.configDir, "workspaces", "handmade"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := waitForEvent(t, events, EventWorkspaceCreated); event.Workspace != "handmade" {
+		t.Errorf("event = %+v", event)
+	}
+}
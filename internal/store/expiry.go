@@ -0,0 +1,279 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// ExpiredRule describes a rule that is no longer active
+type ExpiredRule struct {
+	Service string    `json:"service"`
+	ID      string    `json:"id"`
+	Index   int       `json:"index"`
+	Expired time.Time `json:"expired,omitempty"` // When activeUntil passed (or the match limit was used up)
+}
+
+// ruleHits is a rule's match count as persisted in hits.json
+type ruleHits struct {
+	Service string `json:"service"`
+	Origin  string `json:"origin"`
+	ID      string `json:"id"`
+	Hits    int    `json:"hits"`
+}
+
+// usedUpRule is a service rule that used up its match limit but hasn't been given
+// activeUntil yet (the janitor writes it, keeping file writes off the request path)
+type usedUpRule struct {
+	service string
+	id      string
+	at      time.Time
+}
+
+// hitKey identifies a rule's match counter (library rules are counted per including service)
+func hitKey(service, origin, id string) string {
+	return service + "\x00" + origin + "\x00" + id
+}
+
+// hitsPath returns the file match counts are persisted to, so limits survive a restart
+func (s *Store) hitsPath() string {
+	return filepath.Join(s.configDir, "hits.json")
+}
+
+// loadHits restores the match counts saved by flushHits
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) loadHits() {
+	data, err := os.ReadFile(s.hitsPath())
+	if err != nil {
+		return
+	}
+	var saved []ruleHits
+	if err := json.Unmarshal(data, &saved); err != nil {
+		fmt.Printf("Warning: Ignoring invalid %s: %v\n", s.hitsPath(), err)
+		return
+	}
+	for _, h := range saved {
+		s.hits[hitKey(h.Service, h.Origin, h.ID)] = h.Hits
+	}
+}
+
+// flushHits gives service rules that used up their match limit activeUntil and saves
+// the match counts (run by the janitor and on Close)
+func (s *Store) flushHits() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, used := range s.usedUp {
+		// The count can only go once the file keeps the rule expired by itself
+		// (a later activeUntil is brought forward, or dropping the count would re-arm the rule)
+		index := s.ruleIndex(used.service, used.id)
+		if index >= 0 && !expiredBy(s.rules[used.service][index], used.at) {
+			rules := make([]models.Rule, len(s.rules[used.service]))
+			copy(rules, s.rules[used.service])
+			at := used.at
+			rules[index].ActiveUntil = &at
+			if err := s.saveRulesToFile(used.service, rules); err != nil {
+				// Retried on the next run; the count still keeps the rule expired
+				fmt.Printf("Warning: Failed to record expiry of rule %s: %v\n", used.id, err)
+				continue
+			}
+			s.rules[used.service] = rules
+		}
+		delete(s.usedUp, key)
+		delete(s.hits, key)
+		s.hitsDirty = true
+	}
+
+	if !s.hitsDirty {
+		return
+	}
+	saved := make([]ruleHits, 0, len(s.hits))
+	for key, hits := range s.hits {
+		parts := strings.SplitN(key, "\x00", 3)
+		saved = append(saved, ruleHits{Service: parts[0], Origin: parts[1], ID: parts[2], Hits: hits})
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		return hitKey(saved[i].Service, saved[i].Origin, saved[i].ID) < hitKey(saved[j].Service, saved[j].Origin, saved[j].ID)
+	})
+	data, err := json.Marshal(saved)
+	if err == nil {
+		err = writeFileAtomic(s.hitsPath(), data, 0644)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to save rule match counts: %v\n", err)
+		return
+	}
+	s.hitsDirty = false
+}
+
+// expiredBy reports whether a rule's activeUntil has passed by the given time
+func expiredBy(rule models.Rule, at time.Time) bool {
+	return rule.ActiveUntil != nil && !rule.ActiveUntil.After(at)
+}
+
+// flushRuleHits flushes the match counts of every loaded workspace
+func (wm *WorkspaceManager) flushRuleHits() {
+	wm.mu.RLock()
+	stores := make([]*Store, 0, len(wm.stores))
+	for _, st := range wm.stores {
+		stores = append(stores, st)
+	}
+	wm.mu.RUnlock()
+
+	for _, st := range stores {
+		st.flushHits()
+	}
+}
+
+// ruleStatus reports whether a resolved rule is scheduled or expired ("" if active)
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) ruleStatus(service string, rule models.ResolvedRule, now time.Time) string {
+	if status := rule.TimeStatus(now); status != "" {
+		return status
+	}
+	if limit := rule.MatchLimit(); limit > 0 && s.hits[hitKey(service, rule.Origin, rule.ID)] >= limit {
+		return models.RuleStatusExpired
+	}
+	return ""
+}
+
+// claimMatch counts a match against a rule's limit (once / expiresAfter)
+// Returns false if the limit was already used up, so the caller should look for another rule
+// Counts are saved to hits.json and a service rule that uses up its limit is given activeUntil
+// by the janitor (see flushHits), so neither is written while handling the request
+func (s *Store) claimMatch(service string, rule models.ResolvedRule) bool {
+	limit := rule.MatchLimit()
+	if limit == 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	key := hitKey(service, rule.Origin, rule.ID)
+	if s.hits[key] >= limit {
+		return false
+	}
+
+	index := -1
+	if rule.Origin == OriginService {
+		// A concurrent request may have just used up the limit and expired the rule
+		index = s.ruleIndex(service, rule.ID)
+		if index < 0 || s.rules[service][index].TimeStatus(now) != "" {
+			return false
+		}
+	}
+
+	s.hits[key]++
+	s.hitsDirty = true
+	if s.hits[key] >= limit && index >= 0 {
+		s.usedUp[key] = usedUpRule{service: service, id: rule.ID, at: now}
+	}
+	return true
+}
+
+// GetExpiredRules lists the service rules (not library rules) that have expired
+func (s *Store) GetExpiredRules() []ExpiredRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	expired := []ExpiredRule{}
+	for service, rules := range s.rules {
+		for i, rule := range rules {
+			status := s.ruleStatus(service, models.ResolvedRule{Rule: rule, Origin: OriginService}, now)
+			if status != models.RuleStatusExpired {
+				continue
+			}
+			entry := ExpiredRule{Service: service, ID: rule.ID, Index: i}
+			if rule.ActiveUntil != nil {
+				entry.Expired = *rule.ActiveUntil
+			}
+			expired = append(expired, entry)
+		}
+	}
+
+	sort.Slice(expired, func(i, j int) bool {
+		if expired[i].Service != expired[j].Service {
+			return expired[i].Service < expired[j].Service
+		}
+		return expired[i].Index < expired[j].Index
+	})
+	return expired
+}
+
+// CleanupExpiredRules removes expired rules from the services' YAML files
+// Returns the rules removed
+func (s *Store) CleanupExpiredRules() ([]ExpiredRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	removed := []ExpiredRule{}
+	services := make([]string, 0, len(s.rules))
+	for service := range s.rules {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	for _, service := range services {
+		var kept []models.Rule
+		var expired []ExpiredRule
+		for i, rule := range s.rules[service] {
+			if s.ruleStatus(service, models.ResolvedRule{Rule: rule, Origin: OriginService}, now) == models.RuleStatusExpired {
+				entry := ExpiredRule{Service: service, ID: rule.ID, Index: i}
+				if rule.ActiveUntil != nil {
+					entry.Expired = *rule.ActiveUntil
+				}
+				expired = append(expired, entry)
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		if len(expired) == 0 {
+			continue
+		}
+
+		if err := s.saveRulesToFile(service, kept); err != nil {
+			return removed, fmt.Errorf("failed to remove expired rules from %s: %w", service, err)
+		}
+		s.rules[service] = kept
+		for _, entry := range expired {
+			key := hitKey(service, OriginService, entry.ID)
+			delete(s.hits, key)
+			delete(s.usedUp, key)
+		}
+		s.hitsDirty = true
+		removed = append(removed, expired...)
+	}
+
+	return removed, nil
+}
+
+// cleanupExpiredRules removes expired rules from every loaded workspace
+// (run by the janitor when cleanup_expired_rules is set in config.json)
+func (wm *WorkspaceManager) cleanupExpiredRules() {
+	wm.mu.RLock()
+	stores := make(map[string]*Store, len(wm.stores))
+	for name, st := range wm.stores {
+		stores[name] = st
+	}
+	wm.mu.RUnlock()
+
+	for name, st := range stores {
+		removed, err := st.CleanupExpiredRules()
+		if err != nil {
+			fmt.Printf("Warning: Failed to clean up expired rules in %s: %v\n", name, err)
+		}
+		for _, rule := range removed {
+			fmt.Printf("Removed expired rule %s from %s/%s\n", rule.ID, name, rule.Service)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestTimeBoundedAndExpiringRules(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": `rules:
+  - id: later
+    activeFrom: 2999-01-01T00:00:00Z
+    match: {path: /servicex/users}
+    response: "[503]"
+  - id: past
+    activeUntil: 2000-01-01T00:00:00Z
+    match: {path: /servicex/users}
+    response: "[410]"
+  - id: twice
+    expiresAfter: 2
+    match: {path: /servicex/users}
+    response: "[500]"
+  - id: always
+    match: {path: /servicex/users}
+    response: "[200]"
+`,
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &models.RequestContext{Method: "GET", Path: "/servicex/users"}
+	for i, expected := range []string{"twice", "twice", "always", "always"} {
+		match := wm.MatchRequest("default", "servicex", ctx)
+		if !match.Matched() || match.Rule.ID != expected {
+			t.Fatalf("request %d matched %+v, expected %s", i+1, match.Rule, expected)
+		}
+	}
+
+	// Previewing a match doesn't use up a limit
+	if match := wm.MatchRule("default", "servicex", ctx); match.Rule.ID != "always" {
+		t.Errorf("MatchRule() matched %s, expected always", match.Rule.ID)
+	}
+
+	statuses := map[string]string{}
+	resolved, _ := st.GetResolvedRules("servicex")
+	for _, rr := range resolved {
+		statuses[rr.ID] = rr.Status
+	}
+	expected := map[string]string{
+		"later":  models.RuleStatusScheduled,
+		"past":   models.RuleStatusExpired,
+		"twice":  models.RuleStatusExpired,
+		"always": "",
+	}
+	for id, status := range expected {
+		if statuses[id] != status {
+			t.Errorf("rule %s status = %q, expected %q", id, statuses[id], status)
+		}
+	}
+
+	// Using up the limit is persisted as activeUntil by the janitor
+	wm.flushRuleHits()
+	rule, _, err := st.GetRuleByID("servicex", "twice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.ActiveUntil == nil {
+		t.Error("expired rule has no activeUntil")
+	}
+
+	removed, err := st.CleanupExpiredRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("CleanupExpiredRules() removed %d rules, expected 2", len(removed))
+	}
+	if rules := st.GetRules("servicex"); len(rules) != 2 || rules[0].ID != "later" || rules[1].ID != "always" {
+		t.Errorf("rules after cleanup = %+v", rules)
+	}
+}
+
+func TestMatchCountsSurviveRestart(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": `rules:
+  - id: twice
+    expiresAfter: 2
+    match: {path: /servicex/users}
+    response: "[500]"
+  - id: always
+    match: {path: /servicex/users}
+    response: "[200]"
+`,
+	})
+	ctx := &models.RequestContext{Method: "GET", Path: "/servicex/users"}
+	if match := wm.MatchRequest("default", "servicex", ctx); match.Rule.ID != "twice" {
+		t.Fatalf("matched %s, expected twice", match.Rule.ID)
+	}
+	if err := wm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewWorkspaceManager(wm.configDir, &config.Config{ConfigDir: wm.configDir, MaxTrafficEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+	for i, expected := range []string{"twice", "always"} {
+		if match := restarted.MatchRequest("default", "servicex", ctx); match.Rule.ID != expected {
+			t.Errorf("request %d after restart matched %s, expected %s", i+1, match.Rule.ID, expected)
+		}
+	}
+}
+
+func TestUsedUpRuleWithLaterActiveUntilStaysExpired(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": `rules:
+  - id: first
+    once: true
+    activeUntil: 2099-01-01T00:00:00Z
+    match: {path: /servicex/users}
+    response: "[500]"
+  - id: always
+    match: {path: /servicex/users}
+    response: "[200]"
+`,
+	})
+	ctx := &models.RequestContext{Method: "GET", Path: "/servicex/users"}
+	if match := wm.MatchRequest("default", "servicex", ctx); match.Rule.ID != "first" {
+		t.Fatalf("matched %s, expected first", match.Rule.ID)
+	}
+
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.flushHits()
+
+	// The count is only dropped once activeUntil is brought forward to when the rule was used up
+	if match := wm.MatchRequest("default", "servicex", ctx); match.Rule.ID != "always" {
+		t.Errorf("after flushHits matched %s, expected always", match.Rule.ID)
+	}
+	if until := st.GetRules("servicex")[0].ActiveUntil; until == nil || until.Year() == 2099 {
+		t.Errorf("activeUntil = %v, expected the time the rule was used up", until)
+	}
+}
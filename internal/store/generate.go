@@ -0,0 +1,32 @@
+package store
+
+import (
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/dsl"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// GenerateRule creates a rule template from a traffic entry: its method and path, and a
+// .mock response replaying the recorded one
+func GenerateRule(entry *models.TrafficEntry) models.Rule {
+	rule := models.Rule{
+		Match: models.MatchCondition{
+			Method: []string{entry.Method},
+			Path:   entry.Path,
+		},
+	}
+
+	if entry.Response != nil {
+		// Create .mock template from response
+		parsed := &models.ParsedTemplate{
+			StatusCode: entry.Response.StatusCode,
+			Headers:    entry.Response.Headers,
+			Body:       entry.Response.Body,
+			Delay:      time.Duration(entry.Response.DelayMS) * time.Millisecond,
+		}
+		rule.Response = dsl.Format(parsed)
+	}
+
+	return rule
+}
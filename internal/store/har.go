@@ -0,0 +1,336 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/har"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+)
+
+// HAR import modes
+const (
+	HARImportRules   = "rules"   // Generate a mock rule per distinct request
+	HARImportTraffic = "traffic" // Load the entries as traffic history
+)
+
+// HARExportOptions selects the traffic exported as HAR
+type HARExportOptions struct {
+	Service string       // Only this service's traffic ("" for every service)
+	Query   *query.Query // Only traffic matching this query (nil for all)
+	Limit   int          // Only the newest N matching entries (0 for all)
+}
+
+// FilterTraffic returns the traffic of a service ("" for all) matching a query, oldest first,
+// keeping the newest limit entries (0 for all); the backend's whole history is searched if it keeps one
+func (s *Store) FilterTraffic(service string, q *query.Query, limit int) []models.TrafficEntry {
+	if s.keepsHistory() {
+		s.FlushTraffic()
+		var bounds query.Bounds
+		var match func(*models.TrafficEntry) bool
+		if q != nil {
+			bounds, match = q.Bounds(), q.Match
+		}
+		if service != "" {
+			bounds.Service = service
+		}
+		var result []models.TrafficEntry
+		if ok, err := s.withHistory(func(history *sqliteBackend) (err error) {
+			result, err = history.filter(bounds, match, limit)
+			return err
+		}); ok && err == nil {
+			return result
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []models.TrafficEntry
+	for i := len(s.traffic) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		entry := &s.traffic[i]
+		if service != "" && entry.Service != service {
+			continue
+		}
+		if q != nil && !q.Match(entry) {
+			continue
+		}
+		result = append(result, *entry)
+	}
+
+	// Oldest first
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// ExportHAR writes a workspace's traffic as a HAR 1.2 log and returns the number of entries
+func (wm *WorkspaceManager) ExportHAR(name string, w io.Writer, opts HARExportOptions) (int, error) {
+	if err := ValidateWorkspaceName(name); err != nil {
+		return 0, err
+	}
+	if !wm.workspaceExists(name) {
+		return 0, fmt.Errorf("workspace %s not found", name)
+	}
+	st, err := wm.GetStore(name)
+	if err != nil {
+		return 0, err
+	}
+
+	// URLs point back at the proxy, with the workspace prefix for non-default workspaces
+	baseURL := fmt.Sprintf("http://localhost:%d", wm.config.ProxyPort)
+	if name != "default" {
+		baseURL += "/w/" + name
+	}
+
+	entries := st.FilterTraffic(opts.Service, opts.Query, opts.Limit)
+	log := har.FromTraffic(entries, har.Options{
+		BaseURL:        baseURL,
+		CreatorVersion: wm.config.Version,
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return 0, fmt.Errorf("failed to write HAR: %w", err)
+	}
+	return len(entries), nil
+}
+
+// HARImportOptions controls how a HAR file is imported
+type HARImportOptions struct {
+	Mode    string // HARImportRules (default) or HARImportTraffic
+	GroupBy string // har.GroupByHost (default) or har.GroupByPath
+}
+
+// HARImportResult reports what a HAR import added
+type HARImportResult struct {
+	Workspace    string        `json:"workspace"`
+	Mode         string        `json:"mode"`
+	Services     []string      `json:"services"`          // Services that were added to
+	RulesAdded   int           `json:"rules_added"`       // Rules generated (rules mode)
+	Duplicates   int           `json:"duplicates"`        // Requests already covered by a rule (rules mode)
+	TrafficAdded int           `json:"traffic_added"`     // Entries added to history (traffic mode)
+	Skipped      []har.Skipped `json:"skipped,omitempty"` // Entries that couldn't be imported
+}
+
+// ImportHAR imports a HAR file into a workspace, either as mock rules (one per distinct
+// method and path, appended after existing rules) or as traffic history
+func (wm *WorkspaceManager) ImportHAR(name string, data []byte, opts HARImportOptions) (*HARImportResult, error) {
+	if opts.Mode == "" {
+		opts.Mode = HARImportRules
+	}
+	if opts.Mode != HARImportRules && opts.Mode != HARImportTraffic {
+		return nil, fmt.Errorf("mode must be %s or %s", HARImportRules, HARImportTraffic)
+	}
+	if opts.GroupBy == "" {
+		opts.GroupBy = har.GroupByHost
+	}
+	if opts.GroupBy != har.GroupByHost && opts.GroupBy != har.GroupByPath {
+		return nil, fmt.Errorf("group_by must be %s or %s", har.GroupByHost, har.GroupByPath)
+	}
+	if err := ValidateWorkspaceName(name); err != nil {
+		return nil, err
+	}
+	if !wm.workspaceExists(name) {
+		return nil, fmt.Errorf("workspace %s not found", name)
+	}
+
+	log, err := har.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	st, err := wm.GetStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &HARImportResult{Workspace: name, Mode: opts.Mode, Services: []string{}}
+	skip := func(i int, reason string) {
+		result.Skipped = append(result.Skipped, har.Skipped{Index: i, URL: log.Log.Entries[i].Request.URL, Reason: reason})
+	}
+
+	var entries []models.TrafficEntry
+	for i := range log.Log.Entries {
+		entry, err := har.ToEntry(&log.Log.Entries[i], opts.GroupBy)
+		if err != nil {
+			skip(i, err.Error())
+			continue
+		}
+		if opts.Mode == HARImportRules && entry.Response == nil {
+			skip(i, "no response recorded")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if opts.Mode == HARImportTraffic {
+		result.TrafficAdded = st.ImportTraffic(entries)
+		result.Services = trafficServices(entries)
+		return result, nil
+	}
+
+	// One rule per method and path, skipping requests existing rules already cover
+	// (the first recorded response wins, as the first matching rule would)
+	existing := st.GetAllRules()
+	seen := make(map[string]bool)
+	for service, rules := range existing {
+		for _, rule := range rules {
+			for _, method := range rule.Match.Method {
+				seen[ruleKey(service, method, rule.Match.Path)] = true
+			}
+		}
+	}
+	generated := make(map[string][]models.Rule)
+	for i := range entries {
+		entry := &entries[i]
+		key := ruleKey(entry.Service, entry.Method, entry.Path)
+		if seen[key] {
+			result.Duplicates++
+			continue
+		}
+		seen[key] = true
+		generated[entry.Service] = append(generated[entry.Service], GenerateRule(entry))
+	}
+
+	for _, service := range sortedServices(generated) {
+		if err := st.AppendRules(service, generated[service]); err != nil {
+			return result, fmt.Errorf("failed to add rules for %s: %w", service, err)
+		}
+		result.Services = append(result.Services, service)
+		result.RulesAdded += len(generated[service])
+	}
+	return result, nil
+}
+
+// AppendRules adds rules after a service's existing rules (so existing rules keep
+// priority), giving each an ID
+func (s *Store) AppendRules(service string, rules []models.Rule) error {
+	if err := validateServiceName(service); err != nil {
+		return err
+	}
+	// _rules files starting with _ hold service settings and profiles, not rules
+	if strings.HasPrefix(service, "_") {
+		return fmt.Errorf("reserved service name: %s", service)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := ruleIDs(s.rules[service])
+	for i := range rules {
+		if rules[i].ID == "" || taken[rules[i].ID] {
+			rules[i].ID = newRuleID(taken)
+		}
+		taken[rules[i].ID] = true
+	}
+
+	updated := append(append([]models.Rule{}, s.rules[service]...), rules...)
+	if err := s.saveRulesToFile(service, updated); err != nil {
+		return err
+	}
+	s.rules[service] = updated
+	return nil
+}
+
+// ImportTraffic adds entries recorded elsewhere (e.g. a HAR file) to the traffic history
+// and storage, in timestamp order; entries whose ID is already recorded are skipped
+// Returns the number of entries added
+func (s *Store) ImportTraffic(entries []models.TrafficEntry) int {
+	s.mu.Lock()
+
+	known := make(map[string]bool, len(s.traffic))
+	for _, entry := range s.traffic {
+		known[entry.ID] = true
+	}
+	var added []models.TrafficEntry
+	for _, entry := range entries {
+		if entry.ID == "" {
+			entry.ID = uuid.New().String()
+		}
+		if known[entry.ID] {
+			continue
+		}
+		known[entry.ID] = true
+		added = append(added, entry)
+	}
+
+	// Imported traffic may be older than what's already recorded
+	s.traffic = append(s.traffic, added...)
+	sort.SliceStable(s.traffic, func(i, j int) bool {
+		return s.traffic[i].Timestamp.Before(s.traffic[j].Timestamp)
+	})
+
+	// Keep only the newest entries in memory; the ndjson backend drops the rest at the
+	// next flush, while sqlite keeps them (and stores every imported entry)
+	kept := make(map[string]bool, len(added))
+	for _, entry := range added {
+		kept[entry.ID] = true
+	}
+	if maxEntries := s.config.MaxTrafficEntries; len(s.traffic) > maxEntries {
+		for _, dropped := range s.traffic[:len(s.traffic)-maxEntries] {
+			if s.keepsHistory() {
+				delete(s.sizes, dropped.ID)
+				continue
+			}
+			if kept[dropped.ID] {
+				// Never written, so nothing to delete
+				delete(kept, dropped.ID)
+				continue
+			}
+			s.pendingDeletes = append(s.pendingDeletes, dropped.ID)
+			delete(s.sizes, dropped.ID)
+		}
+		s.traffic = s.traffic[len(s.traffic)-maxEntries:]
+	}
+	s.recountTraffic()
+	for id := range kept {
+		s.unwritten[id] = true
+	}
+	s.mu.Unlock()
+
+	count := 0
+	for _, entry := range added {
+		if kept[entry.ID] {
+			s.persist(entry)
+			count++
+		}
+	}
+	return count
+}
+
+// ruleKey identifies the requests a generated rule answers
+func ruleKey(service, method, path string) string {
+	return service + " " + strings.ToUpper(method) + " " + path
+}
+
+// trafficServices returns the distinct services of some entries, sorted
+func trafficServices(entries []models.TrafficEntry) []string {
+	seen := make(map[string]bool)
+	services := []string{}
+	for _, entry := range entries {
+		if !seen[entry.Service] {
+			seen[entry.Service] = true
+			services = append(services, entry.Service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// sortedServices returns the keys of a service map, sorted
+func sortedServices(rules map[string][]models.Rule) []string {
+	services := make([]string, 0, len(rules))
+	for service := range rules {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// testHAR is a browser recording of a third-party API, with entries that can't become rules
+const testHAR = `{"log": {"version": "1.2", "creator": {"name": "devtools", "version": "1"}, "entries": [
+  {"startedDateTime": "2026-01-01T12:00:00Z", "time": 80, "timings": {"send": 1, "wait": 60, "receive": 19},
+   "request": {"method": "GET", "url": "https://api.stripe.com/v1/customers?limit=3", "headers": [{"name": "accept", "value": "application/json"}]},
+   "response": {"status": 200, "headers": [{"name": "content-type", "value": "application/json"}], "content": {"mimeType": "application/json", "text": "{\"data\":[]}"}}},
+  {"startedDateTime": "2026-01-01T12:00:05Z", "time": 70,
+   "request": {"method": "GET", "url": "https://api.stripe.com/v1/customers"},
+   "response": {"status": 200, "content": {"text": "{\"data\":[{\"id\":\"cus_1\"}]}"}}},
+  {"startedDateTime": "2026-01-01T12:00:02Z", "time": 90,
+   "request": {"method": "POST", "url": "https://api.stripe.com/v1/customers", "postData": {"mimeType": "application/json", "text": "{\"name\":\"Ada\"}"}},
+   "response": {"status": 201, "content": {"text": "{\"id\":\"cus_1\"}"}}},
+  {"startedDateTime": "2026-01-01T12:00:03Z", "time": 0,
+   "request": {"method": "GET", "url": "https://api.stripe.com/v1/charges"},
+   "response": {"status": 0, "content": {}}},
+  {"startedDateTime": "2026-01-01T12:00:04Z", "time": 5,
+   "request": {"method": "GET", "url": "data:image/png;base64,AAAA"},
+   "response": {"status": 200, "content": {}}}
+]}}`
+
+func TestImportHAR(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": ""})
+	st, err := wm.GetStore("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AppendRules("api-stripe-com", []models.Rule{{Match: models.MatchCondition{Method: []string{"POST"}, Path: "/api-stripe-com/v1/customers"}, Response: "[409]"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       HARImportOptions
+		rules      int
+		duplicates int
+		traffic    int
+		skipped    int
+	}{
+		// The second GET is a duplicate, the POST is already mocked, and the failed
+		// request has nothing to mock
+		{"rules", HARImportOptions{}, 1, 2, 0, 2},
+		{"rules again", HARImportOptions{Mode: HARImportRules}, 0, 3, 0, 2},
+		{"traffic", HARImportOptions{Mode: HARImportTraffic}, 0, 0, 4, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := wm.ImportHAR("team", []byte(testHAR), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.RulesAdded != tt.rules || result.Duplicates != tt.duplicates || result.TrafficAdded != tt.traffic || len(result.Skipped) != tt.skipped {
+				t.Errorf("result = %+v", result)
+			}
+			if tt.rules+tt.traffic > 0 && (len(result.Services) != 1 || result.Services[0] != "api-stripe-com") {
+				t.Errorf("services = %v", result.Services)
+			}
+		})
+	}
+
+	// Existing rules keep priority; the generated rule replays the first response
+	serviceRules := st.GetRules("api-stripe-com")
+	if len(serviceRules) != 2 || serviceRules[0].Response != "[409]" || serviceRules[1].ID == "" {
+		t.Fatalf("rules = %+v", serviceRules)
+	}
+	if generated := serviceRules[1]; generated.Match.Path != "/api-stripe-com/v1/customers" || !bytes.Contains([]byte(generated.Response), []byte(`{"data":[]}`)) {
+		t.Errorf("generated rule = %+v", generated)
+	}
+
+	// Traffic is in timestamp order (newest first here), with the server's wait time as the delay
+	traffic := st.GetTraffic(10, "api-stripe-com")
+	if len(traffic) != 4 || traffic[3].Method != "GET" || traffic[3].Response.DelayMS != 60 || traffic[1].Response != nil {
+		t.Fatalf("traffic = %+v", traffic)
+	}
+	if body, ok := traffic[2].Body.(map[string]interface{}); !ok || body["name"] != "Ada" {
+		t.Errorf("request body = %#v", traffic[2].Body)
+	}
+
+	// A HAR exported by Mockingbird imports back with the same services and IDs
+	var buf bytes.Buffer
+	if _, err := wm.ExportHAR("team", &buf, HARExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	result, err := wm.ImportHAR("default", buf.Bytes(), HARImportOptions{Mode: HARImportTraffic, GroupBy: "path"})
+	if err != nil || result.TrafficAdded != 4 {
+		t.Fatalf("ImportHAR() = %+v, %v", result, err)
+	}
+	defaultStore, _ := wm.GetStore("default")
+	if imported := defaultStore.GetTrafficByID(traffic[0].ID); imported == nil || imported.Service != "api-stripe-com" || imported.Path != traffic[0].Path {
+		t.Errorf("round-tripped entry = %+v", imported)
+	}
+
+	if _, err := wm.ImportHAR("team", []byte(testHAR), HARImportOptions{Mode: "replay"}); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+}
+
+func TestImportHARReservedServices(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": ""})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SaveProfile("ci", models.Profile{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paths whose first segment starts with _ would write over _rules/_profiles.yaml
+	// and _rules/_service.yaml, so those entries are skipped
+	reserved := `{"log": {"version": "1.2", "creator": {"name": "devtools", "version": "1"}, "entries": [
+  {"startedDateTime": "2026-01-01T12:00:00Z", "request": {"method": "GET", "url": "http://localhost:8080/_profiles/x"}, "response": {"status": 200, "content": {"text": "{}"}}},
+  {"startedDateTime": "2026-01-01T12:00:01Z", "request": {"method": "GET", "url": "http://localhost:8080/_service/x"}, "response": {"status": 200, "content": {"text": "{}"}}},
+  {"startedDateTime": "2026-01-01T12:00:02Z", "request": {"method": "GET", "url": "http://localhost:8080/billing/invoices"}, "response": {"status": 200, "content": {"text": "[]"}}}
+]}}`
+	result, err := wm.ImportHAR("default", []byte(reserved), HARImportOptions{GroupBy: "path"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RulesAdded != 1 || len(result.Skipped) != 2 || len(result.Services) != 1 || result.Services[0] != "billing" {
+		t.Errorf("result = %+v", result)
+	}
+	if _, ok := st.GetProfiles().Profiles["ci"]; !ok {
+		t.Errorf("profiles were overwritten")
+	}
+	if err := st.AppendRules("_service", []models.Rule{{Response: "[200]"}}); err == nil {
+		t.Errorf("AppendRules() should reject reserved service names")
+	}
+}
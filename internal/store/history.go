@@ -0,0 +1,327 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// maxHistoryVersions is how many versions of a service's rules are kept
+const maxHistoryVersions = 100
+
+// History sources
+const (
+	HistorySourceAPI      = "api"      // Changed through the admin API
+	HistorySourceFile     = "file"     // Changed on disk (editor, git checkout, ...)
+	HistorySourceRollback = "rollback" // Restored from an earlier version
+)
+
+// historyHead is the latest recorded version of a service's rules
+type historyHead struct {
+	version int
+	content string
+	count   int // Versions in the file (trimmed back to maxHistoryVersions by the janitor)
+}
+
+// queuedVersion is a version of a service's rules waiting to be written to its history
+type queuedVersion struct {
+	service string
+	version models.RuleVersion // Numbered when written
+}
+
+// historyPath returns the history file for a service
+// Note: This method assumes historyMu (or mu, which relocate holds with it) is already held by the caller
+func (s *Store) historyPath(service string) string {
+	return filepath.Join(s.configDir, "_history", service+".ndjson")
+}
+
+// recordHistory queues a version of a service's rules to be appended to its history
+// The history files are written in the background (callers usually hold mu, which must
+// not wait on disk), in the order versions were queued; readers flush the queue first
+func (s *Store) recordHistory(service, content, source string) {
+	s.historyQueueMu.Lock()
+	defer s.historyQueueMu.Unlock()
+
+	s.historyQueue = append(s.historyQueue, queuedVersion{service, models.RuleVersion{
+		Timestamp: time.Now(),
+		Source:    source,
+		Content:   content,
+	}})
+	if len(s.historyQueue) == 1 {
+		go s.flushHistory()
+	}
+}
+
+// flushHistory writes the queued versions to the history files
+func (s *Store) flushHistory() {
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	s.historyQueueMu.Lock()
+	queue := s.historyQueue
+	s.historyQueue = nil
+	s.historyQueueMu.Unlock()
+
+	for _, queued := range queue {
+		s.appendVersion(queued.service, queued.version)
+	}
+}
+
+// appendVersion appends a version to its service's history, numbering it after the
+// latest version, unless the content is unchanged from the latest version
+// Note: This method assumes historyMu is already held by the caller
+func (s *Store) appendVersion(service string, version models.RuleVersion) {
+	head, err := s.historyHead(service)
+	if err != nil {
+		fmt.Printf("Warning: Failed to read rule history for %s: %v\n", service, err)
+		return
+	}
+	if head.count > 0 && head.content == version.Content {
+		return
+	}
+	version.Version = head.version + 1
+
+	if err := os.MkdirAll(filepath.Dir(s.historyPath(service)), 0755); err != nil {
+		fmt.Printf("Warning: Failed to create history directory: %v\n", err)
+		return
+	}
+	if err := s.appendHistory(service, version); err != nil {
+		fmt.Printf("Warning: Failed to record rule history for %s: %v\n", service, err)
+		return
+	}
+	head.version = version.Version
+	head.content = version.Content
+	head.count++
+}
+
+// historyHead returns the cached latest version of a service's history, reading the
+// history file on first use
+// Note: This method assumes historyMu is already held by the caller
+func (s *Store) historyHead(service string) (*historyHead, error) {
+	if head, ok := s.historyHeads[service]; ok {
+		return head, nil
+	}
+
+	versions, err := s.readHistory(service)
+	if err != nil {
+		return nil, err
+	}
+	head := &historyHead{count: len(versions)}
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		head.version = latest.Version
+		head.content = latest.Content
+	}
+	s.historyHeads[service] = head
+	return head, nil
+}
+
+// trimHistory rewrites history files holding more than maxHistoryVersions versions
+// (run by the janitor, so saving rules never has to read a whole history file)
+func (s *Store) trimHistory() {
+	s.flushHistory()
+
+	s.historyMu.Lock()
+	defer s.historyMu.Unlock()
+
+	for service, head := range s.historyHeads {
+		if head.count <= maxHistoryVersions {
+			continue
+		}
+		versions, err := s.readHistory(service)
+		if err == nil {
+			versions = newestVersions(versions)
+			err = s.writeHistory(service, versions)
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to trim rule history for %s: %v\n", service, err)
+			continue
+		}
+		head.count = len(versions)
+	}
+}
+
+// trimHistories trims the rule history of every loaded workspace
+func (wm *WorkspaceManager) trimHistories() {
+	wm.mu.RLock()
+	stores := make([]*Store, 0, len(wm.stores))
+	for _, st := range wm.stores {
+		stores = append(stores, st)
+	}
+	wm.mu.RUnlock()
+
+	for _, st := range stores {
+		st.trimHistory()
+	}
+}
+
+// newestVersions returns the versions that are kept (the newest maxHistoryVersions)
+func newestVersions(versions []models.RuleVersion) []models.RuleVersion {
+	if len(versions) > maxHistoryVersions {
+		return versions[len(versions)-maxHistoryVersions:]
+	}
+	return versions
+}
+
+// readHistory reads all versions of a service's rules, oldest first
+// Note: This method assumes historyMu is already held by the caller
+func (s *Store) readHistory(service string) ([]models.RuleVersion, error) {
+	return readHistoryFile(s.historyPath(service))
+}
+
+// readHistoryFile reads a history file
+// Versions are appended whole and the file is only ever replaced atomically, so it can
+// be read without historyMu (a version still being appended is skipped like a corrupted line)
+func readHistoryFile(path string) ([]models.RuleVersion, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var versions []models.RuleVersion
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var version models.RuleVersion
+		if err := json.Unmarshal(scanner.Bytes(), &version); err != nil {
+			continue // Skip corrupted lines
+		}
+		versions = append(versions, version)
+	}
+	return versions, scanner.Err()
+}
+
+// appendHistory appends one version to the history file
+// Note: This method assumes historyMu is already held by the caller
+func (s *Store) appendHistory(service string, version models.RuleVersion) error {
+	data, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.historyPath(service), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// writeHistory replaces the history file with the given versions
+// Note: This method assumes historyMu is already held by the caller
+func (s *Store) writeHistory(service string, versions []models.RuleVersion) error {
+	var buf bytes.Buffer
+	for _, version := range versions {
+		data, err := json.Marshal(version)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return writeFileAtomic(s.historyPath(service), buf.Bytes(), 0644)
+}
+
+// readServiceHistory reads a service's history once every queued version is written
+func (s *Store) readServiceHistory(service string) ([]models.RuleVersion, error) {
+	s.flushHistory()
+
+	s.historyMu.Lock()
+	path := s.historyPath(service)
+	s.historyMu.Unlock()
+	return readHistoryFile(path)
+}
+
+// GetHistory returns the versions of a service's rules, newest first, without content
+func (s *Store) GetHistory(service string) ([]models.RuleVersion, error) {
+	versions, err := s.readServiceHistory(service)
+	if err != nil {
+		return nil, err
+	}
+	versions = newestVersions(versions)
+
+	result := make([]models.RuleVersion, len(versions))
+	for i, version := range versions {
+		version.Size = len(version.Content)
+		version.Content = ""
+		result[len(versions)-1-i] = version
+	}
+	return result, nil
+}
+
+// GetHistoryVersion returns one version of a service's rules, including its content
+// Version 0 means the latest
+func (s *Store) GetHistoryVersion(service string, version int) (*models.RuleVersion, error) {
+	versions, err := s.readServiceHistory(service)
+	if err != nil {
+		return nil, err
+	}
+	versions = newestVersions(versions)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no history for service %s", service)
+	}
+
+	if version == 0 {
+		v := versions[len(versions)-1]
+		v.Size = len(v.Content)
+		return &v, nil
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			v.Size = len(v.Content)
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("version %d not found for service %s", version, service)
+}
+
+// RollbackRules restores a service's rules to an earlier version
+// The rollback is itself recorded as a new version
+func (s *Store) RollbackRules(service string, version int, ifMatch string) error {
+	target, err := s.GetHistoryVersion(service, version)
+	if err != nil {
+		return err
+	}
+
+	var serviceRules models.ServiceRules
+	if err := yaml.Unmarshal([]byte(target.Content), &serviceRules); err != nil {
+		return fmt.Errorf("version %d is not valid YAML: %w", version, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+
+	rulesDir := filepath.Join(s.configDir, "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create rules directory: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(rulesDir, service+".yaml"), []byte(target.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	s.setServiceRules(service, serviceRules)
+	delete(s.loadErrors, service)
+
+	source := fmt.Sprintf("%s:%d", HistorySourceRollback, target.Version)
+	s.recordHistory(service, target.Content, source)
+	s.emit(EventRulesChanged, service, source, "")
+	return nil
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestRuleHistoryAndRollback(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - id: a\n    match: {path: /servicex/a}\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.AddRule("servicex", models.Rule{Match: models.MatchCondition{Path: "/servicex/b"}}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := st.GetHistory("servicex")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("GetHistory() = %+v, %v", versions, err)
+	}
+	if versions[0].Version != 2 || versions[0].Source != HistorySourceAPI || versions[1].Source != HistorySourceFile {
+		t.Errorf("GetHistory() = %+v, expected newest (api) first", versions)
+	}
+	if versions[0].Content != "" || versions[0].Size == 0 {
+		t.Errorf("listing should omit content but report size: %+v", versions[0])
+	}
+
+	if err := st.RollbackRules("servicex", 1, ""); err != nil {
+		t.Fatalf("RollbackRules() error = %v", err)
+	}
+	if rules := st.GetRules("servicex"); len(rules) != 1 || rules[0].ID != "a" {
+		t.Errorf("rules after rollback = %+v", rules)
+	}
+
+	latest, err := st.GetHistoryVersion("servicex", 0)
+	if err != nil || latest.Version != 3 || latest.Source != "rollback:1" {
+		t.Errorf("latest version = %+v, %v", latest, err)
+	}
+
+	if err := st.RollbackRules("servicex", 99, ""); err == nil {
+		t.Errorf("expected error rolling back to a missing version")
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "rules: []\n"})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxHistoryVersions+5; i++ {
+		st.recordHistory("servicex", fmt.Sprintf("rules: [] # %d\n", i), HistorySourceAPI)
+	}
+
+	// Saving only appends, so older versions are hidden until the janitor trims the file
+	versions, err := st.GetHistory("servicex")
+	if err != nil || len(versions) != maxHistoryVersions {
+		t.Fatalf("GetHistory() returned %d versions, %v", len(versions), err)
+	}
+
+	wm.trimHistories()
+	st.historyMu.Lock()
+	all, err := st.readHistory("servicex")
+	st.historyMu.Unlock()
+	if err != nil || len(all) != maxHistoryVersions || all[len(all)-1].Version != maxHistoryVersions+6 {
+		t.Errorf("history after trim has %d versions, %v", len(all), err)
+	}
+
+	// Numbering continues from the cached head after a trim
+	st.recordHistory("servicex", "rules: []\n# new\n", HistorySourceAPI)
+	if latest, err := st.GetHistoryVersion("servicex", 0); err != nil || latest.Version != maxHistoryVersions+7 {
+		t.Errorf("latest version = %+v, %v", latest, err)
+	}
+}
+
+func TestSavingRulesDoesNotWaitOnHistory(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "rules: []\n"})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While history is busy (a slow disk, a big file being read), saves still complete
+	st.historyMu.Lock()
+	saved := make(chan error, 1)
+	go func() {
+		_, err := st.AddRule("servicex", models.Rule{Match: models.MatchCondition{Path: "/servicex/a"}}, "")
+		saved <- err
+	}()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Errorf("AddRule() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("AddRule() waited on the history lock")
+	}
+	st.historyMu.Unlock()
+
+	// ... and the version is there once history is read
+	if latest, err := st.GetHistoryVersion("servicex", 0); err != nil || latest.Version != 2 || latest.Source != HistorySourceAPI {
+		t.Errorf("latest version = %+v, %v", latest, err)
+	}
+}
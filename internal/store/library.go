@@ -0,0 +1,281 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// Rule origins reported for resolved rules
+const (
+	OriginService       = "service"  // The service's own rules file
+	originLibraryPrefix = "library:" // A shared library, e.g. "library:cors-preflight"
+)
+
+// EventLibraryChanged is sent when a shared library file is changed, removed or fails to load
+const EventLibraryChanged = "library.changed"
+
+// Library holds the shared rule sets that services pull in with include:
+// Library files live in {ConfigDir}/_library/{name}.yaml and are shared by all workspaces
+type Library struct {
+	dir        string
+	sets       map[string][]models.Rule        // library name -> rules
+	loadErrors map[string]models.RuleLoadError // library name -> last failed load (last good rules kept)
+	onChange   func(models.ChangeEvent)        // Change event hook (set by the workspace manager)
+	mu         sync.RWMutex
+	watcher    *Watcher
+}
+
+// NewLibrary loads the library directory and watches it for changes
+func NewLibrary(dir string, onChange func(models.ChangeEvent)) (*Library, error) {
+	return newLibrary(dir, onChange, true)
+}
+
+// newLibrary loads the library directory, watching it for changes if watch is set
+func newLibrary(dir string, onChange func(models.ChangeEvent), watch bool) (*Library, error) {
+	l := &Library{
+		dir:        dir,
+		sets:       make(map[string][]models.Rule),
+		loadErrors: make(map[string]models.RuleLoadError),
+		onChange:   onChange,
+	}
+
+	// The watcher needs the directory; without one (a CLI command) a missing library is just empty
+	if watch {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create library directory: %w", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if err := l.load(file); err != nil {
+			fmt.Printf("Warning: Failed to load library %s: %v\n", file, err)
+		}
+	}
+
+	if !watch {
+		return l, nil
+	}
+	watcher, err := NewWatcher(dir, l.onFileChange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start library watcher: %w", err)
+	}
+	l.watcher = watcher
+
+	return l, nil
+}
+
+// load reads one library file, keeping the last good rules on a parse error
+func (l *Library) load(filePath string) error {
+	name := getServiceName(filePath)
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var set models.ServiceRules
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		l.mu.Lock()
+		l.loadErrors[name] = models.RuleLoadError{
+			Service: name,
+			File:    filepath.Base(filePath),
+			Error:   err.Error(),
+			Time:    time.Now(),
+		}
+		l.mu.Unlock()
+		l.emit(name, err.Error())
+		return fmt.Errorf("failed to parse YAML (keeping last good rules): %w", err)
+	}
+	if len(set.Include) > 0 {
+		fmt.Printf("Warning: Library %s has includes, which are ignored (libraries cannot include other libraries)\n", name)
+	}
+
+	// Library rules get persistent IDs too, so traffic can point at them
+	if withIDs, changed, err := assignRuleIDs(data); err == nil && changed {
+		if err := yaml.Unmarshal(withIDs, &set); err != nil {
+			return fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		if err := writeFileAtomic(filePath, withIDs, 0644); err != nil {
+			fmt.Printf("Warning: Failed to save rule IDs for library %s: %v\n", name, err)
+		}
+	}
+
+	l.mu.Lock()
+	l.sets[name] = set.Rules
+	delete(l.loadErrors, name)
+	l.mu.Unlock()
+
+	l.emit(name, "")
+	fmt.Printf("Loaded %d rule(s) for library '%s'\n", len(set.Rules), name)
+	return nil
+}
+
+// onFileChange reloads a library file, or drops it if it was removed or renamed
+func (l *Library) onFileChange(filePath string) {
+	name := getServiceName(filePath)
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		l.mu.Lock()
+		delete(l.sets, name)
+		delete(l.loadErrors, name)
+		l.mu.Unlock()
+
+		l.emit(name, "")
+		fmt.Printf("Removed library '%s' (file no longer exists)\n", name)
+		return
+	}
+
+	if err := l.load(filePath); err != nil {
+		fmt.Printf("Error reloading library %s: %v\n", name, err)
+	}
+}
+
+// emit reports a library change
+func (l *Library) emit(name, errMsg string) {
+	if l.onChange == nil {
+		return
+	}
+	l.onChange(models.ChangeEvent{
+		Type:      EventLibraryChanged,
+		Library:   name,
+		Error:     errMsg,
+		Timestamp: time.Now(),
+	})
+}
+
+// Get returns a copy of a library's rules
+func (l *Library) Get(name string) ([]models.Rule, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	rules, ok := l.sets[name]
+	if !ok {
+		return nil, false
+	}
+	result := make([]models.Rule, len(rules))
+	copy(result, rules)
+	return result, true
+}
+
+// Names returns the loaded library names, sorted
+func (l *Library) Names() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	names := make([]string, 0, len(l.sets))
+	for name := range l.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetLoadErrors returns the libraries whose file failed to load
+func (l *Library) GetLoadErrors() map[string]models.RuleLoadError {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := make(map[string]models.RuleLoadError, len(l.loadErrors))
+	for name, loadErr := range l.loadErrors {
+		result[name] = loadErr
+	}
+	return result
+}
+
+// Close stops watching the library directory
+func (l *Library) Close() error {
+	if l.watcher != nil {
+		return l.watcher.Close()
+	}
+	return nil
+}
+
+// libraryOrigin returns the origin reported for rules from a library
+func libraryOrigin(name string) string {
+	return originLibraryPrefix + name
+}
+
+// GetResolvedRules returns a service's effective rules with includes expanded, in match order:
+// "before" includes (in listed order), the service's own rules, then "after" includes
+// Each rule's enabled state reflects the active profile, and its status its time window and match limit
+// Includes naming a missing library are skipped and reported as warnings
+func (s *Store) GetResolvedRules(service string) ([]models.ResolvedRule, []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resolveRules(service)
+}
+
+// resolveRules expands a service's includes
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) resolveRules(service string) ([]models.ResolvedRule, []string) {
+	var resolved []models.ResolvedRule
+	var warnings []string
+
+	addIncludes := func(position string) {
+		for _, inc := range s.includes[service] {
+			incPosition := inc.Position
+			if incPosition == "" {
+				incPosition = models.IncludeBefore
+			}
+			if incPosition != position {
+				continue
+			}
+
+			var rules []models.Rule
+			ok := false
+			if s.library != nil {
+				rules, ok = s.library.Get(inc.Library)
+			}
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("included library %s not found", inc.Library))
+				continue
+			}
+			for i, rule := range rules {
+				resolved = append(resolved, models.ResolvedRule{Rule: rule, Origin: libraryOrigin(inc.Library), Index: i})
+			}
+		}
+	}
+
+	addIncludes(models.IncludeBefore)
+	for i, rule := range s.rules[service] {
+		resolved = append(resolved, models.ResolvedRule{Rule: rule, Origin: OriginService, Index: i})
+	}
+	addIncludes(models.IncludeAfter)
+
+	// The active profile switches rules on or off by tag
+	if profile := s.activeProfile(); profile != nil {
+		for i := range resolved {
+			if enabled := profileOverride(profile, resolved[i].Tags); enabled != nil {
+				resolved[i].Enabled = enabled
+				resolved[i].Profile = s.profiles.Active
+			}
+		}
+	}
+
+	// Report rules outside their time window or past their match limit
+	now := time.Now()
+	for i := range resolved {
+		resolved[i].Status = s.ruleStatus(service, resolved[i], now)
+		resolved[i].Hits = s.hits[hitKey(service, resolved[i].Origin, resolved[i].ID)]
+	}
+
+	for _, inc := range s.includes[service] {
+		if inc.Position != "" && inc.Position != models.IncludeBefore && inc.Position != models.IncludeAfter {
+			warnings = append(warnings, fmt.Sprintf("include %s has unknown position %q (use before or after)", inc.Library, inc.Position))
+		}
+	}
+
+	return resolved, warnings
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestIncludesResolveInPriorityOrder(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": `include:
+  - cors
+  - {library: health, position: after}
+  - missing
+rules:
+  - id: own
+    match: {path: /servicex/**}
+`,
+	})
+
+	libraryDir := filepath.Join(wm.configDir, "_library")
+	libraries := map[string]string{
+		"cors":   "rules:\n  - id: preflight\n    match: {method: [OPTIONS]}\n    response: \"[204]\"\n",
+		"health": "rules:\n  - id: health\n    match: {path: \"/{service}/health\"}\n    response: \"[200]\"\n",
+	}
+	for name, content := range libraries {
+		file := filepath.Join(libraryDir, name+".yaml")
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := wm.Library().load(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, warnings := st.GetResolvedRules("servicex")
+	var got []string
+	for _, rule := range resolved {
+		got = append(got, rule.Origin+"/"+rule.ID)
+	}
+	expected := "library:cors/preflight service/own library:health/health"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("resolved = %v, expected %s", got, expected)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing") {
+		t.Errorf("warnings = %v", warnings)
+	}
+
+	// Included rules take part in matching, reported with their origin
+	match := wm.MatchRule("default", "servicex", &models.RequestContext{Method: "OPTIONS", Path: "/servicex/users"})
+	if !match.Matched() || match.Origin != "library:cors" || match.Index != 0 {
+		t.Errorf("match = %+v, expected the cors library rule", match)
+	}
+
+	// Saving through the API keeps the includes
+	if _, err := st.AddRule("servicex", models.Rule{Match: models.MatchCondition{Path: "/servicex/a"}}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if include := st.GetServiceRules("servicex").Include; len(include) != 3 || include[1].Position != models.IncludeAfter {
+		t.Errorf("includes after save = %+v", include)
+	}
+}
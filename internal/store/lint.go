@@ -0,0 +1,52 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/lint"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// LintService checks a service's effective rules (includes expanded, in match order)
+// Each issue's index and origin point at the rule within the file it came from
+func (s *Store) LintService(service string) []lint.Issue {
+	resolved, _ := s.GetResolvedRules(service)
+	settings := s.GetServiceSettings(service)
+
+	disabled := false
+	rules := make([]models.Rule, len(resolved))
+	for i, rr := range resolved {
+		rules[i] = rr.Rule
+		// Scheduled and expired rules don't take part in matching right now
+		if rr.Status != "" {
+			rules[i].Enabled = &disabled
+		}
+	}
+
+	issues := lint.Rules(rules, lint.Options{DefaultUpstream: settings != nil && settings.ProxyTo != ""})
+	for i := range issues {
+		rr := resolved[issues[i].Index]
+		issues[i].Origin = rr.Origin
+		issues[i].Index = rr.Index
+	}
+	return issues
+}
+
+// LintAll checks every service in the workspace, returning only services with issues
+func (s *Store) LintAll() map[string][]lint.Issue {
+	s.mu.RLock()
+	services := make([]string, 0, len(s.rules))
+	for service := range s.rules {
+		services = append(services, service)
+	}
+	s.mu.RUnlock()
+	sort.Strings(services)
+
+	result := make(map[string][]lint.Issue)
+	for _, service := range services {
+		if issues := s.LintService(service); len(issues) > 0 {
+			result[service] = issues
+		}
+	}
+	return result
+}
@@ -0,0 +1,195 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// profilesFile holds a workspace's named profiles and the active one
+const profilesFile = "_profiles.yaml"
+
+// EventProfileChanged is sent when profiles are edited or the active profile switches
+const EventProfileChanged = "profile.changed"
+
+// loadProfilesFile (re)loads _rules/_profiles.yaml
+// On a parse error the last good profiles are kept
+func (s *Store) loadProfilesFile() error {
+	filePath := filepath.Join(s.configDir, "_rules", profilesFile)
+
+	var profiles models.Profiles
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if err := yaml.Unmarshal(data, &profiles); err != nil {
+			s.loadErrors[profilesFile] = models.RuleLoadError{
+				Service: profilesFile,
+				File:    profilesFile,
+				Error:   err.Error(),
+				Time:    time.Now(),
+			}
+			s.emit(EventRulesError, "", HistorySourceFile, err.Error())
+			return fmt.Errorf("failed to parse YAML (keeping last good profiles): %w", err)
+		}
+	}
+	delete(s.loadErrors, profilesFile)
+
+	if profiles.Profiles == nil {
+		profiles.Profiles = make(map[string]models.Profile)
+	}
+	if profiles.Active != "" {
+		if _, ok := profiles.Profiles[profiles.Active]; !ok {
+			fmt.Printf("Warning: Active profile %s is not defined, no profile applied\n", profiles.Active)
+		}
+	}
+
+	changed := !sameProfiles(s.profiles, profiles)
+	s.profiles = profiles
+	if changed {
+		s.emit(EventProfileChanged, "", HistorySourceFile, "")
+	}
+	return nil
+}
+
+// sameProfiles compares two sets of profiles
+func sameProfiles(a, b models.Profiles) bool {
+	dataA, _ := yaml.Marshal(a)
+	dataB, _ := yaml.Marshal(b)
+	return string(dataA) == string(dataB)
+}
+
+// saveProfiles writes profiles to _rules/_profiles.yaml and makes them current
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) saveProfiles(profiles models.Profiles) error {
+	data, err := yaml.Marshal(profiles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+
+	rulesDir := filepath.Join(s.configDir, "_rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create rules directory: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(rulesDir, profilesFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	s.profiles = profiles
+	delete(s.loadErrors, profilesFile)
+	s.emit(EventProfileChanged, "", HistorySourceAPI, "")
+	return nil
+}
+
+// copyProfiles returns a deep copy of the current profiles
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) copyProfiles() models.Profiles {
+	profiles := models.Profiles{
+		Active:   s.profiles.Active,
+		Profiles: make(map[string]models.Profile, len(s.profiles.Profiles)),
+	}
+	for name, profile := range s.profiles.Profiles {
+		profiles.Profiles[name] = profile
+	}
+	return profiles
+}
+
+// GetProfiles returns the workspace's profiles and the active one
+func (s *Store) GetProfiles() models.Profiles {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.copyProfiles()
+}
+
+// SaveProfile creates or replaces a named profile
+func (s *Store) SaveProfile(name string, profile models.Profile) error {
+	if err := validateServiceName(name); err != nil || name == "active" {
+		return fmt.Errorf("invalid profile name: %s", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := s.copyProfiles()
+	profiles.Profiles[name] = profile
+	return s.saveProfiles(profiles)
+}
+
+// DeleteProfile removes a named profile (deactivating it if it is active)
+func (s *Store) DeleteProfile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := s.copyProfiles()
+	if _, ok := profiles.Profiles[name]; !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+	delete(profiles.Profiles, name)
+	if profiles.Active == name {
+		profiles.Active = ""
+	}
+	return s.saveProfiles(profiles)
+}
+
+// SetActiveProfile switches the active profile ("" for none)
+func (s *Store) SetActiveProfile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := s.copyProfiles()
+	if name != "" {
+		if _, ok := profiles.Profiles[name]; !ok {
+			return fmt.Errorf("profile %s not found", name)
+		}
+	}
+	profiles.Active = name
+	return s.saveProfiles(profiles)
+}
+
+// activeProfile returns the active profile, or nil if none is active
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) activeProfile() *models.Profile {
+	if s.profiles.Active == "" {
+		return nil
+	}
+	profile, ok := s.profiles.Profiles[s.profiles.Active]
+	if !ok {
+		return nil
+	}
+	return &profile
+}
+
+// profileOverride returns the enabled state a profile forces on a rule with the given tags,
+// or nil if the profile doesn't mention any of them (disable wins over enable)
+func profileOverride(profile *models.Profile, tags []string) *bool {
+	if profile == nil || len(tags) == 0 {
+		return nil
+	}
+
+	var override *bool
+	for _, tag := range tags {
+		for _, disabled := range profile.Disable {
+			if tag == disabled {
+				off := false
+				return &off
+			}
+		}
+		for _, enabled := range profile.Enable {
+			if tag == enabled {
+				on := true
+				override = &on
+			}
+		}
+	}
+	return override
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestProfilesSwitchRulesByTag(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": `rules:
+  - id: error
+    tags: [errors]
+    enabled: false
+    match: {path: /servicex/users}
+    response: "[500]"
+  - id: happy
+    tags: [happy-path]
+    match: {path: /servicex/users}
+    response: "[200]"
+`,
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matchID := func() string {
+		match := wm.MatchRule("default", "servicex", &models.RequestContext{Method: "GET", Path: "/servicex/users"})
+		if !match.Matched() {
+			return ""
+		}
+		return match.Rule.ID
+	}
+
+	if id := matchID(); id != "happy" {
+		t.Fatalf("without a profile matched %q, expected happy", id)
+	}
+
+	if err := st.SaveProfile("errors", models.Profile{Enable: []string{"errors"}, Disable: []string{"happy-path"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetActiveProfile("errors"); err != nil {
+		t.Fatal(err)
+	}
+	if id := matchID(); id != "error" {
+		t.Errorf("with errors profile matched %q, expected error", id)
+	}
+
+	resolved, _ := st.GetResolvedRules("servicex")
+	if resolved[0].Profile != "errors" || resolved[0].Enabled == nil || !*resolved[0].Enabled {
+		t.Errorf("resolved rule not marked as switched by the profile: %+v", resolved[0])
+	}
+
+	// The active profile survives a reload from disk
+	if err := st.loadProfilesFile(); err != nil {
+		t.Fatal(err)
+	}
+	if active := st.GetProfiles().Active; active != "errors" {
+		t.Errorf("active profile after reload = %q", active)
+	}
+
+	if err := st.SetActiveProfile("missing"); err == nil {
+		t.Errorf("expected error activating a missing profile")
+	}
+	if err := st.DeleteProfile("errors"); err != nil {
+		t.Fatal(err)
+	}
+	if id := matchID(); id != "happy" || st.GetProfiles().Active != "" {
+		t.Errorf("after deleting the active profile matched %q", id)
+	}
+}
+
+func TestProfileOverride(t *testing.T) {
+	profile := &models.Profile{Enable: []string{"slow", "errors"}, Disable: []string{"happy-path"}}
+
+	tests := []struct {
+		name     string
+		tags     []string
+		expected string
+	}{
+		{"untagged", nil, "unchanged"},
+		{"unmentioned tag", []string{"other"}, "unchanged"},
+		{"enabled tag", []string{"slow"}, "on"},
+		{"disable wins", []string{"errors", "happy-path"}, "off"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := "unchanged"
+			if enabled := profileOverride(profile, tt.tags); enabled != nil {
+				result = map[bool]string{true: "on", false: "off"}[*enabled]
+			}
+			if result != tt.expected {
+				t.Errorf("profileOverride(%v) = %s, expected %s", tt.tags, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// RecorderStats reports on a store's background traffic writer
+type RecorderStats struct {
+	Backpressure string `json:"backpressure"`         // Policy when the queue is full
+	Fsync        string `json:"fsync"`                // fsync policy
+	Queued       int    `json:"queued"`               // Entries waiting to be written
+	QueueSize    int    `json:"queue_size"`           // Capacity of the queue
+	Written      int64  `json:"written"`              // Entries written to storage
+	Dropped      int64  `json:"dropped"`              // Entries not written because the queue was full
+	Sampled      int64  `json:"sampled"`              // Entries skipped by sampling (backpressure: sample)
+	Blocked      int64  `json:"blocked"`              // Requests that waited for room (backpressure: block)
+	Batches      int64  `json:"batches"`              // Batches written
+	Errors       int64  `json:"errors"`               // Failed batch writes (their entries are lost)
+	LastError    string `json:"last_error,omitempty"` // Most recent write error
+	LastBatchMS  int64  `json:"last_batch_ms"`        // Time the last batch took to write
+}
+
+// recorder persists traffic entries on a background goroutine, in batches, so disk
+// latency never adds to request latency; entries are always in memory immediately
+type recorder struct {
+	store         *Store
+	opts          config.TrafficRecording
+	flushInterval time.Duration
+	fsyncInterval time.Duration
+	queue         chan models.TrafficEntry
+	flushes       chan chan struct{} // Requests to write everything queued so far
+	quit          chan struct{}
+	done          chan struct{}
+	stopOnce      sync.Once
+
+	// Metrics (atomic)
+	written     int64
+	dropped     int64
+	sampled     int64
+	blocked     int64
+	batches     int64
+	errors      int64
+	sampleCount int64
+	lastBatchNS int64
+	lastError   atomic.Value // string
+}
+
+// FlushTraffic waits until all recorded traffic has been written to storage
+func (s *Store) FlushTraffic() {
+	s.recorder.flush()
+}
+
+// RecorderStats returns the background traffic writer's metrics
+func (s *Store) RecorderStats() RecorderStats {
+	return s.recorder.stats()
+}
+
+// newRecorder starts a background writer for a store's traffic
+func newRecorder(s *Store, opts config.TrafficRecording) *recorder {
+	opts = opts.WithDefaults()
+	flushInterval, _ := time.ParseDuration(opts.FlushInterval)
+	fsyncInterval, _ := time.ParseDuration(opts.FsyncInterval)
+
+	r := &recorder{
+		store:         s,
+		opts:          opts,
+		flushInterval: flushInterval,
+		fsyncInterval: fsyncInterval,
+		queue:         make(chan models.TrafficEntry, opts.QueueSize),
+		flushes:       make(chan chan struct{}),
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// enqueue hands an entry to the writer, applying the backpressure policy when the queue is full
+// Returns false if the entry won't be written
+func (r *recorder) enqueue(entry models.TrafficEntry) bool {
+	select {
+	case <-r.quit:
+		atomic.AddInt64(&r.dropped, 1)
+		return false
+	default:
+	}
+
+	switch r.opts.Backpressure {
+	case config.BackpressureBlock:
+		select {
+		case r.queue <- entry:
+			return true
+		default:
+		}
+		atomic.AddInt64(&r.blocked, 1)
+		select {
+		case r.queue <- entry:
+			return true
+		case <-r.quit:
+			atomic.AddInt64(&r.dropped, 1)
+			return false
+		}
+
+	case config.BackpressureSample:
+		if len(r.queue) >= cap(r.queue)/2 {
+			if atomic.AddInt64(&r.sampleCount, 1)%int64(r.opts.SampleEvery) != 0 {
+				atomic.AddInt64(&r.sampled, 1)
+				return false
+			}
+		}
+	}
+
+	select {
+	case r.queue <- entry:
+		return true
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+		return false
+	}
+}
+
+// flush waits until every entry queued so far has been written
+func (r *recorder) flush() {
+	reply := make(chan struct{})
+	select {
+	case r.flushes <- reply:
+		<-reply
+	case <-r.done:
+	}
+}
+
+// stop writes the remaining entries and stops the writer
+func (r *recorder) stop() {
+	r.stopOnce.Do(func() {
+		close(r.quit)
+	})
+	<-r.done
+}
+
+// run collects entries into batches, writing when a batch is full or the flush interval passes
+func (r *recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.TrafficEntry, 0, r.opts.BatchSize)
+	lastSync := time.Now()
+	unsynced := false
+
+	write := func() {
+		if len(batch) > 0 {
+			r.write(batch)
+			batch = batch[:0]
+			unsynced = true
+		}
+		if unsynced && (r.opts.Fsync == config.FsyncBatch ||
+			(r.opts.Fsync == config.FsyncInterval && time.Since(lastSync) >= r.fsyncInterval)) {
+			r.sync()
+			lastSync = time.Now()
+			unsynced = false
+		}
+	}
+	// drain moves everything already queued into batches
+	drain := func() {
+		for {
+			select {
+			case entry := <-r.queue:
+				batch = append(batch, entry)
+				if len(batch) >= r.opts.BatchSize {
+					write()
+				}
+			default:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case entry := <-r.queue:
+			batch = append(batch, entry)
+			if len(batch) >= r.opts.BatchSize {
+				write()
+			}
+
+		case <-ticker.C:
+			write()
+
+		case reply := <-r.flushes:
+			drain()
+			write()
+			close(reply)
+
+		case <-r.quit:
+			drain()
+			write()
+			if unsynced && r.opts.Fsync != config.FsyncNone {
+				r.sync()
+			}
+			return
+		}
+	}
+}
+
+// write appends a batch to the backend, then drops entries that fell out of memory
+// every truncateInterval appends
+func (r *recorder) write(batch []models.TrafficEntry) {
+	s := r.store
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	batch = s.writable(batch)
+	if len(batch) == 0 {
+		return
+	}
+	if s.backend == nil {
+		atomic.AddInt64(&r.dropped, int64(len(batch)))
+		return
+	}
+
+	start := time.Now()
+	if err := s.backend.Append(batch); err != nil {
+		atomic.AddInt64(&r.errors, 1)
+		r.lastError.Store(err.Error())
+		fmt.Printf("Warning: Failed to append traffic entries to disk: %v\n", err)
+	} else {
+		atomic.AddInt64(&r.written, int64(len(batch)))
+	}
+	atomic.AddInt64(&r.batches, 1)
+	atomic.StoreInt64(&r.lastBatchNS, int64(time.Since(start)))
+
+	// Check if we need to drop old entries (every N appends)
+	before := atomic.LoadInt64(&s.appendCounter)
+	after := atomic.AddInt64(&s.appendCounter, int64(len(batch)))
+	if after/int64(s.truncateInterval) != before/int64(s.truncateInterval) {
+		s.deletePending()
+	}
+}
+
+// flushPendingDeletes deletes entries dropped from memory from the backend straight away
+func (s *Store) flushPendingDeletes() {
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	if s.backend != nil {
+		s.deletePending()
+	}
+}
+
+// writable marks a batch as written, leaving out entries dropped from memory while they
+// waited in the queue (deletePending held their deletes back, and they're now settled)
+// Note: This method assumes backendMu is already held by the caller
+func (s *Store) writable(batch []models.TrafficEntry) []models.TrafficEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped := make(map[string]bool, len(s.pendingDeletes))
+	for _, id := range s.pendingDeletes {
+		dropped[id] = true
+	}
+	settled := make(map[string]bool)
+	kept := batch[:0]
+	for _, entry := range batch {
+		delete(s.unwritten, entry.ID)
+		if dropped[entry.ID] {
+			settled[entry.ID] = true
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	if len(settled) > 0 {
+		s.pendingDeletes = slices.DeleteFunc(s.pendingDeletes, func(id string) bool { return settled[id] })
+	}
+	return kept
+}
+
+// deletePending deletes entries dropped from memory from the backend
+// Entries still waiting to be written are left pending: deleting them now would be
+// undone by the append, so writable leaves them out of their batch instead
+// Note: This method assumes backendMu is already held by the caller
+func (s *Store) deletePending() {
+	s.mu.Lock()
+	var ids, waiting []string
+	for _, id := range s.pendingDeletes {
+		if s.unwritten[id] {
+			waiting = append(waiting, id)
+		} else {
+			ids = append(ids, id)
+		}
+	}
+	s.pendingDeletes = waiting
+	s.mu.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.backend.Delete(ids); err != nil {
+		fmt.Printf("Warning: Failed to truncate traffic storage: %v\n", err)
+	}
+}
+
+// sync fsyncs the backend
+func (r *recorder) sync() {
+	s := r.store
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	if s.backend == nil {
+		return
+	}
+	if err := s.backend.Sync(); err != nil {
+		atomic.AddInt64(&r.errors, 1)
+		r.lastError.Store(err.Error())
+		fmt.Printf("Warning: Failed to sync traffic storage: %v\n", err)
+	}
+}
+
+// stats returns the writer's metrics
+func (r *recorder) stats() RecorderStats {
+	lastError, _ := r.lastError.Load().(string)
+	return RecorderStats{
+		Backpressure: r.opts.Backpressure,
+		Fsync:        r.opts.Fsync,
+		Queued:       len(r.queue),
+		QueueSize:    cap(r.queue),
+		Written:      atomic.LoadInt64(&r.written),
+		Dropped:      atomic.LoadInt64(&r.dropped),
+		Sampled:      atomic.LoadInt64(&r.sampled),
+		Blocked:      atomic.LoadInt64(&r.blocked),
+		Batches:      atomic.LoadInt64(&r.batches),
+		Errors:       atomic.LoadInt64(&r.errors),
+		LastError:    lastError,
+		LastBatchMS:  time.Duration(atomic.LoadInt64(&r.lastBatchNS)).Milliseconds(),
+	}
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// gatedBackend holds every Append until the gate is opened
+type gatedBackend struct {
+	gate     chan struct{}
+	mu       sync.Mutex
+	appended []string
+	syncs    int
+}
+
+func (b *gatedBackend) Load(limit int) ([]models.TrafficEntry, error) { return nil, nil }
+func (b *gatedBackend) Delete(ids []string) error                     { return nil }
+func (b *gatedBackend) Close() error                                  { return nil }
+
+func (b *gatedBackend) Append(entries []models.TrafficEntry) error {
+	<-b.gate
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, entry := range entries {
+		b.appended = append(b.appended, entry.ID)
+	}
+	return nil
+}
+
+func (b *gatedBackend) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.syncs++
+	return nil
+}
+
+func TestRecorderBackpressure(t *testing.T) {
+	tests := []struct {
+		backpressure string
+		sent         int
+		written      int
+		dropped      int64
+		sampled      int64
+		blocked      int64
+	}{
+		// One entry is held by the writer, four fill the queue
+		{config.BackpressureDrop, 8, 5, 3, 0, 0},
+		// Once the queue is half full, 1 in 2 entries is kept
+		{config.BackpressureSample, 8, 5, 0, 3, 0},
+		// The sender waits for room instead
+		{config.BackpressureBlock, 8, 8, 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backpressure, func(t *testing.T) {
+			backend := &gatedBackend{gate: make(chan struct{})}
+			s := &Store{backend: backend, truncateInterval: 5000}
+			r := newRecorder(s, config.TrafficRecording{
+				QueueSize:    4,
+				BatchSize:    1,
+				Backpressure: tt.backpressure,
+				SampleEvery:  2,
+				Fsync:        config.FsyncBatch,
+			})
+
+			// The first entry is picked up and held in Append
+			r.enqueue(models.TrafficEntry{ID: "req-0"})
+			for deadline := time.Now().Add(time.Second); len(r.queue) > 0 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 1; i < tt.sent; i++ {
+					r.enqueue(models.TrafficEntry{ID: fmt.Sprintf("req-%d", i)})
+				}
+			}()
+			if tt.backpressure != config.BackpressureBlock {
+				wg.Wait()
+			} else {
+				for deadline := time.Now().Add(time.Second); r.stats().Blocked == 0 && time.Now().Before(deadline); {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			close(backend.gate)
+			wg.Wait()
+			r.flush()
+			r.stop()
+
+			stats := r.stats()
+			if len(backend.appended) != tt.written || stats.Written != int64(tt.written) {
+				t.Errorf("wrote %v (stats %d), expected %d entries", backend.appended, stats.Written, tt.written)
+			}
+			if stats.Dropped != tt.dropped || stats.Sampled != tt.sampled || stats.Blocked < tt.blocked {
+				t.Errorf("stats = %+v", stats)
+			}
+			if backend.syncs != len(backend.appended) {
+				t.Errorf("fsync: batch synced %d times for %d batches", backend.syncs, len(backend.appended))
+			}
+		})
+	}
+}
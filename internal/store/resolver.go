@@ -0,0 +1,258 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// maxChainDepth guards against pathological inheritance chains
+const maxChainDepth = 32
+
+// RuleMatch is the result of matching a request across a workspace inheritance chain
+type RuleMatch struct {
+	Rule      *models.Rule // nil if nothing matched
+	Index     int          // Index of the rule in the file it came from, -1 if nothing matched
+	Origin    string       // Where the rule came from ("service" or "library:<name>")
+	Workspace string       // Workspace (the request's or an ancestor) whose rules answered
+	Store     *Store       // Store of the workspace that answered
+}
+
+// Matched reports whether a rule matched
+func (m RuleMatch) Matched() bool {
+	return m.Rule != nil
+}
+
+// MatchRule matches a request against a workspace's rules, walking up the
+// inheritance chain (workspace -> parent -> ... -> default) until a rule matches
+// Scheduled and expired rules are skipped; matches are not counted (see MatchRequest)
+func (wm *WorkspaceManager) MatchRule(workspace, service string, ctx *models.RequestContext) RuleMatch {
+	return wm.matchRule(workspace, service, ctx, false)
+}
+
+// MatchRequest matches a request like MatchRule and counts the match against the
+// rule's limit (once / expiresAfter), so it is used for requests that are answered
+func (wm *WorkspaceManager) MatchRequest(workspace, service string, ctx *models.RequestContext) RuleMatch {
+	return wm.matchRule(workspace, service, ctx, true)
+}
+
+// matchRule walks the inheritance chain, optionally claiming the match
+func (wm *WorkspaceManager) matchRule(workspace, service string, ctx *models.RequestContext, claim bool) RuleMatch {
+	chain, err := wm.Chain(workspace)
+	if err != nil {
+		wm.warnChain(workspace, err)
+	}
+
+	disabled := false
+	for _, name := range chain {
+		st, err := wm.GetStore(name)
+		if err != nil {
+			continue
+		}
+
+		// Match against the effective rules (the service's own plus its includes)
+		resolved, _ := st.GetResolvedRules(service)
+		rules := make([]models.Rule, len(resolved))
+		for i := range resolved {
+			rules[i] = resolved[i].Rule
+			if resolved[i].Status != "" {
+				rules[i].Enabled = &disabled
+			}
+		}
+
+		for {
+			rule, index := matcher.Match(rules, ctx)
+			if rule == nil {
+				break
+			}
+			// Another request used up the rule's limit first; look for the next match
+			if claim && !st.claimMatch(service, resolved[index]) {
+				rules[index].Enabled = &disabled
+				continue
+			}
+			return RuleMatch{Rule: rule, Index: resolved[index].Index, Origin: resolved[index].Origin, Workspace: name, Store: st}
+		}
+	}
+
+	return RuleMatch{Index: -1}
+}
+
+// ServiceSettings returns a service's settings from the closest workspace in the
+// inheritance chain that defines any (nil if none does)
+func (wm *WorkspaceManager) ServiceSettings(workspace, service string) *models.ServiceSettings {
+	chain, _ := wm.Chain(workspace)
+	for _, name := range chain {
+		st, err := wm.GetStore(name)
+		if err != nil {
+			continue
+		}
+		if settings := st.GetServiceSettings(service); settings != nil {
+			return settings
+		}
+	}
+	return nil
+}
+
+// Chain returns the inheritance chain for a workspace, starting with the workspace itself
+// Workspaces without a declared parent inherit from "default"
+// On a cycle or missing parent, the chain up to that point is returned along with an error,
+// ending with "default" so unmatched requests still fall back to the default rules
+func (wm *WorkspaceManager) Chain(workspace string) ([]string, error) {
+	chain := []string{workspace}
+	seen := map[string]bool{workspace: true}
+
+	current := workspace
+	for len(chain) < maxChainDepth {
+		parent := wm.parentOf(current)
+		if parent == "" {
+			return chain, nil
+		}
+		if seen[parent] {
+			return withDefault(chain), fmt.Errorf("inheritance cycle: %s -> %s", strings.Join(chain, " -> "), parent)
+		}
+		if !wm.workspaceExists(parent) {
+			return withDefault(chain), fmt.Errorf("parent workspace %s of %s not found", parent, current)
+		}
+
+		chain = append(chain, parent)
+		seen[parent] = true
+		current = parent
+	}
+
+	return withDefault(chain), fmt.Errorf("inheritance chain for %s is deeper than %d", workspace, maxChainDepth)
+}
+
+// withDefault ends a broken chain with "default", unless it's already in it
+func withDefault(chain []string) []string {
+	if slices.Contains(chain, "default") {
+		return chain
+	}
+	return append(chain, "default")
+}
+
+// SetParent sets the workspace a workspace inherits from
+// An empty parent restores the default (inherit from "default")
+func (wm *WorkspaceManager) SetParent(name, parent string) error {
+	if name == "default" && parent != "" {
+		return fmt.Errorf("the default workspace cannot have a parent")
+	}
+	if !wm.workspaceExists(name) {
+		return fmt.Errorf("workspace %s not found", name)
+	}
+
+	if parent != "" {
+		if parent == name {
+			return fmt.Errorf("workspace cannot inherit from itself")
+		}
+		if !wm.workspaceExists(parent) {
+			return fmt.Errorf("parent workspace %s not found", parent)
+		}
+
+		// Reject cycles: the new parent's chain must not lead back here
+		parentChain, err := wm.Chain(parent)
+		if err != nil {
+			return fmt.Errorf("invalid parent: %w", err)
+		}
+		for _, ancestor := range parentChain {
+			if ancestor == name {
+				return fmt.Errorf("inheritance cycle: %s -> %s", name, strings.Join(parentChain, " -> "))
+			}
+		}
+	}
+
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+	metadata := loadWorkspaceMetadata(workspaceDir)
+	metadata.Parent = parent
+	if err := saveWorkspaceMetadata(workspaceDir, &metadata); err != nil {
+		return fmt.Errorf("failed to save workspace metadata: %w", err)
+	}
+
+	wm.invalidateParents()
+	return nil
+}
+
+// parentOf returns the effective parent of a workspace ("" for the root)
+func (wm *WorkspaceManager) parentOf(workspace string) string {
+	wm.parentsMu.RLock()
+	parent, ok := wm.parents[workspace]
+	wm.parentsMu.RUnlock()
+	if ok {
+		return parent
+	}
+
+	metadata := loadWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", workspace))
+	parent = effectiveParent(workspace, metadata.Parent)
+
+	wm.parentsMu.Lock()
+	wm.parents[workspace] = parent
+	wm.parentsMu.Unlock()
+
+	return parent
+}
+
+// invalidateParents drops the cached parents (call after metadata or workspace changes)
+// Broken chains are reported again the next time they are used
+func (wm *WorkspaceManager) invalidateParents() {
+	wm.parentsMu.Lock()
+	wm.parents = make(map[string]string)
+	wm.existing = make(map[string]bool)
+	wm.generation++
+	wm.warned = nil
+	wm.parentsMu.Unlock()
+}
+
+// warnChain reports a broken inheritance chain once per load of the parents, rather
+// than on every request (the workspace listing shows it as chain_error)
+func (wm *WorkspaceManager) warnChain(workspace string, err error) {
+	wm.parentsMu.Lock()
+	defer wm.parentsMu.Unlock()
+
+	if wm.warned[workspace] {
+		return
+	}
+	if wm.warned == nil {
+		wm.warned = make(map[string]bool)
+	}
+	wm.warned[workspace] = true
+	fmt.Printf("Warning: workspace chain for %s: %v\n", workspace, err)
+}
+
+// workspaceExists checks if an active workspace directory exists
+// Answers are cached until the workspaces change (see invalidateParents), as the
+// resolver asks for every step of every request's inheritance chain
+func (wm *WorkspaceManager) workspaceExists(name string) bool {
+	wm.parentsMu.RLock()
+	exists, ok := wm.existing[name]
+	generation := wm.generation
+	wm.parentsMu.RUnlock()
+	if ok {
+		return exists
+	}
+
+	info, err := os.Stat(filepath.Join(wm.configDir, "workspaces", name))
+	exists = err == nil && info.IsDir()
+
+	// Don't cache an answer that a change since the check may have made stale
+	wm.parentsMu.Lock()
+	if wm.generation == generation {
+		wm.existing[name] = exists
+	}
+	wm.parentsMu.Unlock()
+	return exists
+}
+
+// effectiveParent applies the default inheritance rule to a declared parent
+func effectiveParent(workspace, declared string) string {
+	if workspace == "default" {
+		return ""
+	}
+	if declared == "" {
+		return "default"
+	}
+	return declared
+}
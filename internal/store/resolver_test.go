@@ -0,0 +1,122 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// newTestWorkspaceManager creates a workspace manager over a temp config dir
+// with the given workspaces, each holding a servicex.yaml with the given rules YAML
+func newTestWorkspaceManager(t *testing.T, workspaces map[string]string) *WorkspaceManager {
+	t.Helper()
+
+	configDir := t.TempDir()
+	for name, rulesYAML := range workspaces {
+		rulesDir := filepath.Join(configDir, "workspaces", name, "_rules")
+		if err := os.MkdirAll(rulesDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if rulesYAML != "" {
+			if err := os.WriteFile(filepath.Join(rulesDir, "servicex.yaml"), []byte(rulesYAML), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 100, Values: map[string]string{}}
+	wm, err := NewWorkspaceManager(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { wm.Close() })
+	return wm
+}
+
+func TestChainAndMatchRule(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - match: {path: /servicex/health}\n    response: \"[200]\"\n",
+		"team":    "rules:\n  - match: {path: /servicex/users}\n    response: \"[201]\"\n",
+		"run":     "",
+	})
+
+	if err := wm.SetParent("run", "team"); err != nil {
+		t.Fatalf("SetParent() error = %v", err)
+	}
+
+	chain, err := wm.Chain("run")
+	if err != nil || !reflect.DeepEqual(chain, []string{"run", "team", "default"}) {
+		t.Fatalf("Chain() = %v, %v", chain, err)
+	}
+
+	tests := []struct {
+		path      string
+		workspace string
+		index     int
+	}{
+		{"/servicex/users", "team", 0},
+		{"/servicex/health", "default", 0},
+		{"/servicex/other", "", -1},
+	}
+	for _, tt := range tests {
+		match := wm.MatchRule("run", "servicex", &models.RequestContext{Method: "GET", Path: tt.path})
+		if match.Workspace != tt.workspace || match.Index != tt.index {
+			t.Errorf("MatchRule(%s) = %s/%d, expected %s/%d", tt.path, match.Workspace, match.Index, tt.workspace, tt.index)
+		}
+	}
+}
+
+func TestSetParentRejectsCycles(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{"default": "", "a": "", "b": ""})
+
+	if err := wm.SetParent("a", "b"); err != nil {
+		t.Fatalf("SetParent(a, b) error = %v", err)
+	}
+	if err := wm.SetParent("b", "a"); err == nil {
+		t.Errorf("expected cycle error for b -> a -> b")
+	}
+	if err := wm.SetParent("a", "a"); err == nil {
+		t.Errorf("expected error for self parent")
+	}
+	if err := wm.SetParent("default", "a"); err == nil {
+		t.Errorf("expected error for parent on default")
+	}
+	if err := wm.SetParent("a", "missing"); err == nil {
+		t.Errorf("expected error for missing parent")
+	}
+
+	// A cycle created by hand-editing metadata is detected when walking the chain
+	saveWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", "b"), &WorkspaceMetadata{Parent: "a"})
+	wm.invalidateParents()
+	if chain, err := wm.Chain("a"); err == nil {
+		t.Errorf("expected Chain() to report the cycle")
+	} else if fmt.Sprint(chain) != "[a b default]" {
+		// Broken chains still fall back to the default rules
+		t.Errorf("Chain() = %v, expected [a b default]", chain)
+	}
+
+	// A parent removed behind the manager's back is noticed once the caches are dropped
+	saveWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", "b"), &WorkspaceMetadata{Parent: "gone"})
+	wm.invalidateParents()
+	if chain, err := wm.Chain("a"); err == nil || fmt.Sprint(chain) != "[a b default]" {
+		t.Errorf("Chain() with a missing parent = %v, %v", chain, err)
+	}
+	saveWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", "b"), &WorkspaceMetadata{Parent: "a"})
+	wm.invalidateParents()
+
+	// ... and shown in the workspace listing
+	workspaces, err := wm.GetWorkspaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ws := range workspaces {
+		if broken := ws.Name == "a" || ws.Name == "b"; broken != (ws.ChainError != "") {
+			t.Errorf("%s chain_error = %q", ws.Name, ws.ChainError)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// retentionLimits is a parsed retention policy (zero values are unlimited)
+type retentionLimits struct {
+	maxEntries int
+	maxAge     time.Duration
+	maxBytes   int64
+}
+
+// retentionUsage is what a policy has kept so far while walking newest-first
+type retentionUsage struct {
+	entries int
+	bytes   int64
+}
+
+// serviceTraffic is how much of a service's traffic is held in memory, kept up to date as
+// entries come and go so retention at record time doesn't walk the whole history
+type serviceTraffic struct {
+	entries int
+	bytes   int64 // Total entry size (only tracked once sized)
+	sized   bool  // Sized when a max_bytes policy first needs it
+}
+
+// ValidateRetention checks a retention policy's values
+func ValidateRetention(r *models.Retention) error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxEntries < 0 {
+		return fmt.Errorf("max_entries must not be negative")
+	}
+	if r.MaxBytes < 0 {
+		return fmt.Errorf("max_bytes must not be negative")
+	}
+	if r.MaxAge != "" {
+		age, err := time.ParseDuration(r.MaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid max_age %q: %w", r.MaxAge, err)
+		}
+		if age <= 0 {
+			return fmt.Errorf("max_age must be positive")
+		}
+	}
+	return nil
+}
+
+// parseRetention converts a policy into limits, or nil if it has none
+// An invalid max_age is ignored (policies from YAML aren't validated on load)
+func parseRetention(r *models.Retention) *retentionLimits {
+	if r == nil {
+		return nil
+	}
+	limits := retentionLimits{maxEntries: r.MaxEntries, maxBytes: r.MaxBytes}
+	if r.MaxAge != "" {
+		if age, err := time.ParseDuration(r.MaxAge); err == nil && age > 0 {
+			limits.maxAge = age
+		}
+	}
+	if limits == (retentionLimits{}) {
+		return nil
+	}
+	return &limits
+}
+
+// keeps reports whether an entry fits the limits, counting it if it does
+func (l *retentionLimits) keeps(usage *retentionUsage, entry *models.TrafficEntry, size func() int64, now time.Time) bool {
+	if l.maxAge > 0 && now.Sub(entry.Timestamp) > l.maxAge {
+		return false
+	}
+	if l.maxEntries > 0 && usage.entries >= l.maxEntries {
+		return false
+	}
+	var bytes int64
+	if l.maxBytes > 0 {
+		bytes = size()
+		if usage.bytes+bytes > l.maxBytes {
+			return false
+		}
+	}
+	usage.entries++
+	usage.bytes += bytes
+	return true
+}
+
+// applyRecordingPolicy applies a service's recording policy to an entry about to be recorded,
+// reporting false if it shouldn't be recorded at all (disabled, or not picked by sampling)
+func applyRecordingPolicy(entry *models.TrafficEntry, policy *models.RecordingPolicy) bool {
+	if policy == nil {
+		return true
+	}
+	if policy.Disabled {
+		return false
+	}
+	if policy.SampleRate > 0 && policy.SampleRate < 1 && rand.Float64() >= policy.SampleRate {
+		return false
+	}
+	if policy.SkipBodies {
+		entry.Body = nil
+		if entry.Response != nil {
+			response := *entry.Response
+			response.Body = ""
+			entry.Response = &response
+		}
+	}
+	return true
+}
+
+// GetRetention returns the workspace's retention policy (nil if unlimited)
+func (s *Store) GetRetention() *models.Retention {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.retention
+}
+
+// SetRetention replaces the workspace's retention policy (the caller persists it)
+func (s *Store) SetRetention(r *models.Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = r
+}
+
+// TrafficServices returns the services with recorded traffic
+func (s *Store) TrafficServices() []string {
+	var services []string
+	if ok, err := s.withHistory(func(history *sqliteBackend) (err error) {
+		services, err = history.services()
+		return err
+	}); ok && err == nil {
+		return services
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, entry := range s.traffic {
+		if !seen[entry.Service] {
+			seen[entry.Service] = true
+			services = append(services, entry.Service)
+		}
+	}
+	return services
+}
+
+// ApplyRetention drops traffic outside the workspace's retention policy and the given
+// per-service policies, oldest first, and deletes it from storage; it returns how many
+// entries were dropped
+func (s *Store) ApplyRetention(services map[string]*models.Retention, now time.Time) int {
+	serviceLimits := make(map[string]*retentionLimits)
+	for service, r := range services {
+		if limits := parseRetention(r); limits != nil {
+			serviceLimits[service] = limits
+		}
+	}
+
+	s.mu.Lock()
+	workspaceLimits := parseRetention(s.retention)
+	if s.keepsHistory() {
+		s.mu.Unlock()
+		return s.retainHistory(serviceLimits, workspaceLimits, now)
+	}
+	dropped := s.applyRetention(serviceLimits, workspaceLimits, now)
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		s.flushPendingDeletes()
+	}
+	return dropped
+}
+
+// retainHistory applies retention to the backend's whole history with SQL, then drops the
+// deleted entries from memory
+func (s *Store) retainHistory(services map[string]*retentionLimits, workspace *retentionLimits, now time.Time) int {
+	if len(services) == 0 && workspace == nil {
+		return 0
+	}
+
+	var deleted []string
+	s.withHistory(func(history *sqliteBackend) (err error) {
+		deleted, err = history.retain(services, workspace, now)
+		return err
+	})
+	if len(deleted) == 0 {
+		return 0
+	}
+
+	gone := make(map[string]bool, len(deleted))
+	for _, id := range deleted {
+		gone[id] = true
+	}
+	s.mu.Lock()
+	kept := s.traffic[:0]
+	for _, entry := range s.traffic {
+		if !gone[entry.ID] {
+			kept = append(kept, entry)
+			continue
+		}
+		delete(s.sizes, entry.ID)
+	}
+	clear(s.traffic[len(kept):])
+	s.traffic = kept
+	s.recountTraffic()
+	s.mu.Unlock()
+	return len(deleted)
+}
+
+// trimService enforces a service's retention policy as its traffic is recorded, so a noisy
+// service can't push other services' traffic out of the history; the service's oldest
+// entries are dropped until its running totals fit
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) trimService(service string, r *models.Retention, newest string) bool {
+	limits := parseRetention(r)
+	usage := s.serviceTraffic[service]
+	if limits == nil || usage == nil {
+		return true
+	}
+	if limits.maxBytes > 0 && !usage.sized {
+		for i := range s.traffic {
+			if s.traffic[i].Service == service {
+				usage.bytes += s.entrySize(&s.traffic[i])
+			}
+		}
+		usage.sized = true
+	}
+
+	now := time.Now()
+	for usage.entries > 0 {
+		i := slices.IndexFunc(s.traffic, func(entry models.TrafficEntry) bool { return entry.Service == service })
+		tooOld := limits.maxAge > 0 && now.Sub(s.traffic[i].Timestamp) > limits.maxAge
+		tooMany := limits.maxEntries > 0 && usage.entries > limits.maxEntries
+		tooBig := limits.maxBytes > 0 && usage.bytes > limits.maxBytes
+		if !tooOld && !tooMany && !tooBig {
+			return true
+		}
+
+		s.countEntry(&s.traffic[i], -1)
+		if s.traffic[i].ID == newest {
+			// Never written, so nothing to delete; it's the service's last entry
+			delete(s.sizes, newest)
+			s.traffic = slices.Delete(s.traffic, i, i+1)
+			return false
+		}
+		s.pendingDeletes = append(s.pendingDeletes, s.traffic[i].ID)
+		delete(s.sizes, s.traffic[i].ID)
+		s.traffic = slices.Delete(s.traffic, i, i+1)
+	}
+	return true
+}
+
+// countEntry adds an entry to (delta 1) or removes it from (delta -1) its service's totals,
+// before its cached size is forgotten
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) countEntry(entry *models.TrafficEntry, delta int) {
+	usage := s.serviceTraffic[entry.Service]
+	if usage == nil {
+		if delta < 0 {
+			return
+		}
+		usage = &serviceTraffic{}
+		s.serviceTraffic[entry.Service] = usage
+	}
+	usage.entries += delta
+	if usage.sized {
+		usage.bytes += int64(delta) * s.entrySize(entry)
+	}
+	if usage.entries <= 0 {
+		delete(s.serviceTraffic, entry.Service)
+	}
+}
+
+// recountTraffic rebuilds the per-service totals after the traffic is replaced or filtered
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) recountTraffic() {
+	s.serviceTraffic = make(map[string]*serviceTraffic)
+	for i := range s.traffic {
+		s.countEntry(&s.traffic[i], 1)
+	}
+}
+
+// applyRetention walks the traffic newest-first, keeping entries within their service's
+// limits and the workspace limits; dropped entries are queued for deletion from storage
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) applyRetention(services map[string]*retentionLimits, workspace *retentionLimits, now time.Time) int {
+	if len(services) == 0 && workspace == nil {
+		return 0
+	}
+
+	serviceUsage := make(map[string]*retentionUsage)
+	var workspaceUsage retentionUsage
+	keep := make([]bool, len(s.traffic))
+	dropped := 0
+
+	for i := len(s.traffic) - 1; i >= 0; i-- {
+		entry := &s.traffic[i]
+		size := func() int64 { return s.entrySize(entry) }
+
+		if limits := services[entry.Service]; limits != nil {
+			usage := serviceUsage[entry.Service]
+			if usage == nil {
+				usage = &retentionUsage{}
+				serviceUsage[entry.Service] = usage
+			}
+			if !limits.keeps(usage, entry, size, now) {
+				dropped++
+				continue
+			}
+		}
+		if workspace != nil && !workspace.keeps(&workspaceUsage, entry, size, now) {
+			dropped++
+			continue
+		}
+		keep[i] = true
+	}
+	if dropped == 0 {
+		return 0
+	}
+
+	kept := s.traffic[:0]
+	for i, entry := range s.traffic {
+		if keep[i] {
+			kept = append(kept, entry)
+			continue
+		}
+		s.pendingDeletes = append(s.pendingDeletes, entry.ID)
+		delete(s.sizes, entry.ID)
+	}
+	// Clear the tail so dropped entries can be garbage collected
+	clear(s.traffic[len(kept):])
+	s.traffic = kept
+	s.recountTraffic()
+	return dropped
+}
+
+// entrySize returns an entry's size as stored JSON, cached by ID
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) entrySize(entry *models.TrafficEntry) int64 {
+	if size, ok := s.sizes[entry.ID]; ok {
+		return size
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0
+	}
+	if s.sizes == nil {
+		s.sizes = make(map[string]int64)
+	}
+	s.sizes[entry.ID] = int64(len(data))
+	return int64(len(data))
+}
+
+// SetRetention sets a workspace's retention policy (nil removes it) and applies it straight away
+func (wm *WorkspaceManager) SetRetention(name string, r *models.Retention) (int, error) {
+	if !wm.workspaceExists(name) {
+		return 0, fmt.Errorf("workspace %s not found", name)
+	}
+	if err := ValidateRetention(r); err != nil {
+		return 0, err
+	}
+	if r != nil && *r == (models.Retention{}) {
+		r = nil
+	}
+
+	workspaceDir := filepath.Join(wm.configDir, "workspaces", name)
+	metadata := loadWorkspaceMetadata(workspaceDir)
+	metadata.Retention = r
+	if err := saveWorkspaceMetadata(workspaceDir, &metadata); err != nil {
+		return 0, fmt.Errorf("failed to save workspace metadata: %w", err)
+	}
+
+	st, err := wm.GetStore(name)
+	if err != nil {
+		return 0, err
+	}
+	st.SetRetention(r)
+	return wm.applyStoreRetention(name, st), nil
+}
+
+// GetRetention returns a workspace's retention policy (nil if unlimited)
+func (wm *WorkspaceManager) GetRetention(name string) (*models.Retention, error) {
+	if !wm.workspaceExists(name) {
+		return nil, fmt.Errorf("workspace %s not found", name)
+	}
+	return loadWorkspaceMetadata(filepath.Join(wm.configDir, "workspaces", name)).Retention, nil
+}
+
+// applyRetention enforces retention policies (mainly max_age) in every loaded workspace
+func (wm *WorkspaceManager) applyRetention() {
+	wm.mu.RLock()
+	stores := make(map[string]*Store, len(wm.stores))
+	for name, st := range wm.stores {
+		stores[name] = st
+	}
+	wm.mu.RUnlock()
+
+	for name, st := range stores {
+		if dropped := wm.applyStoreRetention(name, st); dropped > 0 {
+			fmt.Printf("Retention dropped %d traffic entries from %s\n", dropped, name)
+		}
+	}
+}
+
+// applyStoreRetention applies a workspace's retention policies, with each service's
+// policy resolved through the inheritance chain
+func (wm *WorkspaceManager) applyStoreRetention(name string, st *Store) int {
+	services := make(map[string]*models.Retention)
+	for _, service := range st.TrafficServices() {
+		if settings := wm.ServiceSettings(name, service); settings != nil && settings.Recording != nil {
+			services[service] = settings.Recording.Retention
+		}
+	}
+	return st.ApplyRetention(services, time.Now())
+}
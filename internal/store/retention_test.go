@@ -0,0 +1,206 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Alternating health and api entries, one minute apart, oldest first
+	traffic := make([]models.TrafficEntry, 8)
+	for i := range traffic {
+		service := "health"
+		if i%2 == 1 {
+			service = "api"
+		}
+		traffic[i] = models.TrafficEntry{
+			ID:        fmt.Sprintf("%s-%d", service, i),
+			Timestamp: now.Add(time.Duration(i-len(traffic)) * time.Minute),
+			Service:   service,
+			Body:      "0123456789",
+		}
+	}
+	size := (&Store{}).entrySize(&traffic[0])
+
+	tests := []struct {
+		name      string
+		services  map[string]*models.Retention
+		workspace *models.Retention
+		kept      string
+	}{
+		{"no policies", nil, nil, "[health-0 api-1 health-2 api-3 health-4 api-5 health-6 api-7]"},
+		{"service max entries", map[string]*models.Retention{"health": {MaxEntries: 1}}, nil, "[api-1 api-3 api-5 health-6 api-7]"},
+		{"service max age", map[string]*models.Retention{"api": {MaxAge: "4m"}}, nil, "[health-0 health-2 health-4 api-5 health-6 api-7]"},
+		{"workspace max age", nil, &models.Retention{MaxAge: "150s"}, "[health-6 api-7]"},
+		{"workspace max bytes", nil, &models.Retention{MaxBytes: 2*size + size/2}, "[health-6 api-7]"},
+		{"service and workspace", map[string]*models.Retention{"health": {MaxEntries: 1}}, &models.Retention{MaxEntries: 3}, "[api-5 health-6 api-7]"},
+		{"invalid max age ignored", map[string]*models.Retention{"api": {MaxAge: "soon"}}, nil, "[health-0 api-1 health-2 api-3 health-4 api-5 health-6 api-7]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := New(t.TempDir(), &config.Config{MaxTrafficEntries: 100})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.Close()
+			st.traffic = append(st.traffic, traffic...)
+			st.SetRetention(tt.workspace)
+
+			dropped := st.ApplyRetention(tt.services, now)
+			var kept []string
+			for _, entry := range st.traffic {
+				kept = append(kept, entry.ID)
+			}
+			if got := fmt.Sprint(kept); got != tt.kept {
+				t.Errorf("kept %s, expected %s", got, tt.kept)
+			}
+			if dropped != len(traffic)-len(kept) {
+				t.Errorf("ApplyRetention() = %d, dropped %d", dropped, len(traffic)-len(kept))
+			}
+		})
+	}
+}
+
+func TestRecordTrafficPolicy(t *testing.T) {
+	st, err := New(t.TempDir(), &config.Config{MaxTrafficEntries: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	record := func(service string, n int, policy *models.RecordingPolicy) {
+		for i := 0; i < n; i++ {
+			st.RecordTraffic(models.TrafficEntry{
+				ID:       fmt.Sprintf("%s-%d", service, i),
+				Service:  service,
+				Body:     "request",
+				Response: &models.Response{StatusCode: 200, Body: "response"},
+			}, policy)
+		}
+	}
+	record("health", 10, &models.RecordingPolicy{Disabled: true})
+	record("uploads", 3, &models.RecordingPolicy{SkipBodies: true})
+	record("chatty", 1000, &models.RecordingPolicy{SampleRate: 0.5})
+	record("polling", 10, &models.RecordingPolicy{Retention: &models.Retention{MaxEntries: 2}})
+	record("api", 3, nil)
+
+	tests := []struct {
+		service  string
+		min, max int
+		bodies   bool
+	}{
+		{"health", 0, 0, false},
+		{"uploads", 3, 3, false},
+		{"chatty", 350, 650, true},
+		{"polling", 2, 2, true},
+		{"api", 3, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			entries := st.GetTraffic(1000, tt.service)
+			if len(entries) < tt.min || len(entries) > tt.max {
+				t.Fatalf("recorded %d entries, expected %d-%d", len(entries), tt.min, tt.max)
+			}
+			for _, entry := range entries {
+				if hasBodies := entry.Body != nil && entry.Response.Body != ""; hasBodies != tt.bodies {
+					t.Errorf("entry %s bodies = %v/%q, expected bodies: %v", entry.ID, entry.Body, entry.Response.Body, tt.bodies)
+				}
+			}
+		})
+	}
+	if entries := st.GetTraffic(2, "polling"); entries[0].ID != "polling-9" || entries[1].ID != "polling-8" {
+		t.Errorf("polling kept %s and %s, expected the newest entries", entries[0].ID, entries[1].ID)
+	}
+}
+
+func TestTrimServiceRunningTotals(t *testing.T) {
+	st, err := New(t.TempDir(), &config.Config{MaxTrafficEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	now := time.Now().Truncate(time.Second)
+	entry := func(service string, i int) models.TrafficEntry {
+		return models.TrafficEntry{ID: fmt.Sprintf("%s-%d", service, i), Timestamp: now, Service: service, Body: "0123456789"}
+	}
+	sample := entry("big", 0)
+	size := (&Store{}).entrySize(&sample)
+
+	policy := &models.RecordingPolicy{Retention: &models.Retention{MaxBytes: 2*size + size/2}}
+	for i := 0; i < 5; i++ {
+		st.RecordTraffic(entry("big", i), policy)
+		st.RecordTraffic(entry("api", i), nil)
+	}
+
+	var kept []string
+	for _, entry := range st.GetTraffic(100, "") {
+		kept = append(kept, entry.ID)
+	}
+	if got := fmt.Sprint(kept); got != "[api-4 big-4 api-3 big-3 api-2 api-1 api-0]" {
+		t.Errorf("kept %s", got)
+	}
+	if usage := st.serviceTraffic["big"]; usage == nil || usage.entries != 2 || usage.bytes != 2*size {
+		t.Errorf("big totals = %+v, expected 2 entries of %d bytes", usage, 2*size)
+	}
+	if usage := st.serviceTraffic["api"]; usage == nil || usage.entries != 5 || usage.sized {
+		t.Errorf("api totals = %+v, expected 5 unsized entries", usage)
+	}
+}
+
+func TestEvictedTrafficIsNotStored(t *testing.T) {
+	dir := t.TempDir()
+	st, err := New(dir, &config.Config{MaxTrafficEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	entry := func(id string) models.TrafficEntry {
+		return models.TrafficEntry{ID: id, Timestamp: time.Now(), Service: "servicex", Body: "0123456789"}
+	}
+	stored := func() string {
+		st.FlushTraffic()
+		st.flushPendingDeletes()
+		entries, err := (&ndjsonBackend{path: filepath.Join(dir, trafficNDJSONFile)}).Load(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	// An entry over the service's max_bytes on its own is neither streamed nor stored
+	sub := st.SubscribeTraffic()
+	defer st.UnsubscribeTraffic(sub)
+	huge := entry("huge")
+	st.RecordTraffic(huge, &models.RecordingPolicy{Retention: &models.Retention{MaxBytes: (&Store{}).entrySize(&huge) / 2}})
+	if len(sub) != 0 || len(st.GetTraffic(100, "")) != 0 {
+		t.Errorf("oversized entry was kept: %d streamed, %d in memory", len(sub), len(st.GetTraffic(100, "")))
+	}
+	if got := stored(); got != "[]" {
+		t.Errorf("stored %s, expected nothing", got)
+	}
+
+	// An entry dropped while still queued isn't written after its delete has run
+	policy := &models.RecordingPolicy{Retention: &models.Retention{MaxEntries: 1}}
+	st.backendMu.Lock()
+	st.RecordTraffic(entry("old"), policy)
+	st.RecordTraffic(entry("new"), policy)
+	st.deletePending()
+	st.backendMu.Unlock()
+	if got := stored(); got != "[new]" {
+		t.Errorf("stored %s, expected [new]", got)
+	}
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// Rule errors the admin API maps to status codes
+var (
+	ErrRuleNotFound = errors.New("rule not found")
+	ErrRuleIDExists = errors.New("rule id already exists")
+)
+
+// newRuleID generates a short rule ID that is unique among the given IDs
+func newRuleID(taken map[string]bool) string {
+	for {
+		id := strings.Split(uuid.New().String(), "-")[0]
+		if !taken[id] {
+			taken[id] = true
+			return id
+		}
+	}
+}
+
+// assignRuleIDs gives every rule in a service YAML file a unique ID, editing the
+// YAML node tree so comments and formatting are kept
+// Returns the updated content and whether anything changed
+func assignRuleIDs(data []byte) ([]byte, bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, false, nil
+	}
+
+	rules := mappingValue(doc.Content[0], "rules")
+	if rules == nil || rules.Kind != yaml.SequenceNode {
+		return data, false, nil
+	}
+
+	// Collect existing IDs first so generated ones never collide
+	taken := make(map[string]bool)
+	for _, item := range rules.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if id := mappingValue(item, "id"); id != nil && id.Value != "" {
+			taken[id.Value] = true
+		}
+	}
+
+	changed := false
+	seen := make(map[string]bool)
+	for _, item := range rules.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+
+		id := mappingValue(item, "id")
+		switch {
+		case id == nil:
+			// Missing: insert "id" as the first key
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "id"}
+			value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: newRuleID(taken)}
+			item.Content = append([]*yaml.Node{key, value}, item.Content...)
+			seen[value.Value] = true
+			changed = true
+		case id.Value == "" || seen[id.Value]:
+			// Empty or duplicated (e.g. a copy-pasted rule): replace
+			id.Value = newRuleID(taken)
+			id.Tag = "!!str"
+			id.Style = 0
+			seen[id.Value] = true
+			changed = true
+		default:
+			seen[id.Value] = true
+		}
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, false, err
+	}
+	enc.Close()
+	return buf.Bytes(), true, nil
+}
+
+// mappingValue returns the value node for a key in a YAML mapping node
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ruleIDs returns the set of IDs used by a list of rules
+func ruleIDs(rules []models.Rule) map[string]bool {
+	ids := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.ID != "" {
+			ids[rule.ID] = true
+		}
+	}
+	return ids
+}
+
+// ruleIndex returns the index of the rule with the given ID, or -1
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) ruleIndex(service, id string) int {
+	for i, rule := range s.rules[service] {
+		if rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetRuleByID returns a rule and its current index by ID
+func (s *Store) GetRuleByID(service, id string) (*models.Rule, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.ruleIndex(service, id)
+	if index < 0 {
+		return nil, -1, fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+	}
+	rule := s.rules[service][index]
+	return &rule, index, nil
+}
+
+// UpdateRuleByID updates the rule with the given ID
+func (s *Store) UpdateRuleByID(service, id string, rule models.Rule, ifMatch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+
+	index := s.ruleIndex(service, id)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+	}
+	return s.updateRule(service, index, rule)
+}
+
+// DeleteRuleByID deletes the rule with the given ID
+func (s *Store) DeleteRuleByID(service, id, ifMatch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+
+	index := s.ruleIndex(service, id)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+	}
+	return s.deleteRule(service, index)
+}
+
+// MoveRuleByID moves the rule with the given ID up or down
+func (s *Store) MoveRuleByID(service, id, direction, ifMatch string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+
+	index := s.ruleIndex(service, id)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, id)
+	}
+	return s.moveRule(service, index, direction)
+}
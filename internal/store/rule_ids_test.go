@@ -0,0 +1,86 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestAssignRuleIDs(t *testing.T) {
+	input := `rules:
+  # Health check
+  - match:
+      path: /servicex/health
+    response: "[200]"
+  - id: keep
+    match:
+      path: /servicex/a
+  - id: keep # copy-pasted
+    match:
+      path: /servicex/b
+`
+	output, changed, err := assignRuleIDs([]byte(input))
+	if err != nil || !changed {
+		t.Fatalf("assignRuleIDs() changed = %v, err = %v", changed, err)
+	}
+	if !strings.Contains(string(output), "# Health check") {
+		t.Errorf("comments not preserved:\n%s", output)
+	}
+
+	// Second pass finds nothing to do
+	if _, changed, _ := assignRuleIDs(output); changed {
+		t.Errorf("assignRuleIDs() not idempotent:\n%s", output)
+	}
+}
+
+func TestRuleIDsSurviveReordering(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - match: {path: /servicex/a}\n  - match: {path: /servicex/b}\n",
+	})
+	st, err := wm.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs were assigned on load and written back
+	rules := st.GetRules("servicex")
+	if rules[0].ID == "" || rules[1].ID == "" || rules[0].ID == rules[1].ID {
+		t.Fatalf("rules not given unique IDs: %+v", rules)
+	}
+	data, _ := os.ReadFile(filepath.Join(wm.configDir, "workspaces", "default", "_rules", "servicex.yaml"))
+	if !strings.Contains(string(data), "id: "+rules[0].ID) {
+		t.Errorf("IDs not persisted:\n%s", data)
+	}
+
+	idB := rules[1].ID
+	newID, err := st.AddRule("servicex", models.Rule{Match: models.MatchCondition{Path: "/servicex/c"}}, "")
+	if err != nil || newID == "" {
+		t.Fatalf("AddRule() = %q, %v", newID, err)
+	}
+	if err := st.MoveRuleByID("servicex", idB, "up", ""); err != nil {
+		t.Fatalf("MoveRuleByID() error = %v", err)
+	}
+
+	rule, index, err := st.GetRuleByID("servicex", idB)
+	if err != nil || index != 1 || rule.Match.Path != "/servicex/b" {
+		t.Errorf("GetRuleByID() = %+v at %d, %v", rule, index, err)
+	}
+
+	// Updating without an ID keeps the existing one
+	if err := st.UpdateRuleByID("servicex", idB, models.Rule{Match: models.MatchCondition{Path: "/servicex/b2"}}, ""); err != nil {
+		t.Fatalf("UpdateRuleByID() error = %v", err)
+	}
+	if err := st.DeleteRuleByID("servicex", idB, ""); err != nil {
+		t.Errorf("DeleteRuleByID() error = %v", err)
+	}
+	if _, err := st.AddRule("servicex", models.Rule{ID: newID}, ""); !errors.Is(err, ErrRuleIDExists) {
+		t.Errorf("AddRule() with a duplicate ID error = %v, expected ErrRuleIDExists", err)
+	}
+	if err := st.UpdateRuleByID("servicex", idB, models.Rule{}, ""); !errors.Is(err, ErrRuleNotFound) {
+		t.Errorf("UpdateRuleByID() of a deleted rule error = %v, expected ErrRuleNotFound", err)
+	}
+}
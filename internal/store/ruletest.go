@@ -0,0 +1,57 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/render"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/ruletest"
+)
+
+// TestService runs the examples of a service's effective rules (includes expanded, in match order)
+// Each result's index and origin point at the rule within the file it came from
+func (s *Store) TestService(service string) []ruletest.Result {
+	resolved, _ := s.GetResolvedRules(service)
+
+	disabled := false
+	rules := make([]models.Rule, len(resolved))
+	for i, rr := range resolved {
+		rules[i] = rr.Rule
+		// Scheduled and expired rules don't take part in matching right now
+		if rr.Status != "" {
+			rules[i].Enabled = &disabled
+		}
+	}
+
+	results := ruletest.Run(rules, render.NewRenderer(s.config))
+	for i := range results {
+		rr := resolved[results[i].Index]
+		results[i].Origin = rr.Origin
+		results[i].Index = rr.Index
+		if results[i].MatchedIndex >= 0 {
+			winner := resolved[results[i].MatchedIndex]
+			results[i].MatchedOrigin = winner.Origin
+			results[i].MatchedIndex = winner.Index
+		}
+	}
+	return results
+}
+
+// TestAll runs the examples of every service in the workspace, returning only services with examples
+func (s *Store) TestAll() map[string][]ruletest.Result {
+	s.mu.RLock()
+	services := make([]string, 0, len(s.rules))
+	for service := range s.rules {
+		services = append(services, service)
+	}
+	s.mu.RUnlock()
+	sort.Strings(services)
+
+	result := make(map[string][]ruletest.Result)
+	for _, service := range services {
+		if results := s.TestService(service); len(results) > 0 {
+			result[service] = results
+		}
+	}
+	return result
+}
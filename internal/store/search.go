@@ -0,0 +1,26 @@
+package store
+
+import (
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+)
+
+// SearchTraffic returns one page of the traffic matching a query, searching the backend's
+// whole history if it keeps one
+func (s *Store) SearchTraffic(q *query.Query, opts query.Options) (*query.Page, error) {
+	if s.keepsHistory() {
+		// Include traffic still queued for writing
+		s.FlushTraffic()
+		var page *query.Page
+		if ok, err := s.withHistory(func(history *sqliteBackend) (err error) {
+			page, err = history.search(q, opts)
+			return err
+		}); ok {
+			return page, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return query.Search(s.traffic, q, opts)
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// serviceSettingsFile holds settings for the workspace's services, keyed by service name
+// (_rules/_service.yaml); a service's own settings: block wins field by field
+const serviceSettingsFile = "_service.yaml"
+
+// isRulesFile reports whether a file in _rules holds a service's rules
+// (files starting with an underscore, like _service.yaml, are reserved)
+func isRulesFile(filePath string) bool {
+	base := filepath.Base(filePath)
+	return filepath.Ext(base) == ".yaml" && !strings.HasPrefix(base, "_")
+}
+
+// loadServiceSettingsFile (re)loads _rules/_service.yaml and reports the services it affects
+// On a parse error the last good settings are kept
+func (s *Store) loadServiceSettingsFile() error {
+	filePath := filepath.Join(s.configDir, "_rules", serviceSettingsFile)
+
+	fileSettings := make(map[string]*models.ServiceSettings)
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		if err := yaml.Unmarshal(data, &fileSettings); err != nil {
+			s.loadErrors[serviceSettingsFile] = models.RuleLoadError{
+				Service: serviceSettingsFile,
+				File:    serviceSettingsFile,
+				Error:   err.Error(),
+				Time:    time.Now(),
+			}
+			s.emit(EventRulesError, "", HistorySourceFile, err.Error())
+			return fmt.Errorf("failed to parse YAML (keeping last good settings): %w", err)
+		}
+	}
+	delete(s.loadErrors, serviceSettingsFile)
+
+	// Report every service whose settings were added, changed or removed
+	changed := make(map[string]bool)
+	for service, settings := range fileSettings {
+		if old, ok := s.fileSettings[service]; !ok || !sameSettings(old, settings) {
+			changed[service] = true
+		}
+	}
+	for service := range s.fileSettings {
+		if _, ok := fileSettings[service]; !ok {
+			changed[service] = true
+		}
+	}
+
+	s.fileSettings = fileSettings
+	for service := range changed {
+		s.emit(EventRulesChanged, service, HistorySourceFile, "")
+	}
+	return nil
+}
+
+// sameSettings compares two settings blocks
+func sameSettings(a, b *models.ServiceSettings) bool {
+	dataA, _ := yaml.Marshal(a)
+	dataB, _ := yaml.Marshal(b)
+	return string(dataA) == string(dataB)
+}
+
+// mergeServiceSettings overlays a service's own settings on the workspace's _service.yaml entry
+// Each field set in override wins; header maps are merged key by key
+func mergeServiceSettings(base, override *models.ServiceSettings) *models.ServiceSettings {
+	if base == nil && override == nil {
+		return nil
+	}
+	if base == nil {
+		copied := *override
+		return &copied
+	}
+	merged := *base
+	if override == nil {
+		return &merged
+	}
+
+	if override.ProxyTo != "" {
+		merged.ProxyTo = override.ProxyTo
+	}
+	if len(override.Headers) > 0 {
+		headers := make(map[string]string, len(base.Headers)+len(override.Headers))
+		for key, value := range base.Headers {
+			headers[key] = value
+		}
+		for key, value := range override.Headers {
+			headers[key] = value
+		}
+		merged.Headers = headers
+	}
+	if override.Delay != "" {
+		merged.Delay = override.Delay
+	}
+	if override.Unmatched != "" {
+		merged.Unmatched = override.Unmatched
+	}
+	if override.UnmatchedResponse != "" {
+		merged.UnmatchedResponse = override.UnmatchedResponse
+	}
+	if override.CORS != nil {
+		merged.CORS = override.CORS
+	}
+	if override.TLS != nil {
+		merged.TLS = override.TLS
+	}
+	if override.Recording != nil {
+		merged.Recording = override.Recording
+	}
+	return &merged
+}
@@ -1,14 +1,13 @@
 package store
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -27,41 +26,97 @@ type Store struct {
 	configDir        string
 	config           *config.Config
 	rules            map[string][]models.Rule // service name -> rules
+	settings         map[string]*models.ServiceSettings // service name -> settings block (optional)
+	includes         map[string][]models.Include        // service name -> shared library includes (optional)
+	fileSettings     map[string]*models.ServiceSettings // service name -> settings from _rules/_service.yaml
+	profiles         models.Profiles                    // Named profiles and the active one (_rules/_profiles.yaml)
+	loadErrors       map[string]models.RuleLoadError    // service name -> last failed load (last good rules kept)
+	hits             map[string]int                     // Match counts for rules with once/expiresAfter (see hitKey)
+	hitsDirty        bool                               // hits changed since hits.json was written
+	usedUp           map[string]usedUpRule              // Service rules awaiting activeUntil (see flushHits)
+	historyHeads     map[string]*historyHead            // service name -> latest rule version (guarded by historyMu)
+	historyMu        sync.Mutex                         // Guards the _history files; taken after mu, never before
+	historyQueue     []queuedVersion                    // Versions waiting to be written (see recordHistory)
+	historyQueueMu   sync.Mutex                         // Guards historyQueue; taken after mu and historyMu
+	onChange         func(models.ChangeEvent)           // Change event hook (set by the workspace manager)
+	library          *Library                           // Shared rule library for includes (set by the workspace manager)
 	traffic          []models.TrafficEntry
+	backend          TrafficBackend                        // Persists traffic (traffic.ndjson or traffic.db)
+	backendMu        sync.Mutex                            // Serialises backend I/O, so disk writes don't hold mu
+	recorder         *recorder                             // Writes traffic to the backend in the background
+	pendingDeletes   []string                              // IDs dropped from memory but not yet deleted from the backend
+	unwritten        map[string]bool                       // IDs queued for the recorder but not yet written (see deletePending)
+	retention        *models.Retention                     // Workspace retention policy (metadata.json)
+	sizes            map[string]int64                      // Cached entry sizes for max_bytes retention
+	serviceTraffic   map[string]*serviceTraffic            // service name -> traffic held in memory (see trimService)
 	subscribers      map[chan models.TrafficEntry]struct{} // Multiple SSE subscribers
 	mu               sync.RWMutex
 	watcher          *Watcher
 	closed           bool
-	appendCounter    int64 // Atomic counter for truncation trigger
-	truncateInterval int   // Truncate file every N appends
+	passive          bool // Opened for a CLI command: loading writes nothing (see newStore)
+	appendCounter    int64 // Atomic counter for the pending delete flush
+	truncateInterval int   // Flush pending deletes every N appends
 }
 
 // New creates a new store
 func New(configDir string, cfg *config.Config) (*Store, error) {
+	return newStore(configDir, cfg, false)
+}
+
+// newStore creates a store, watching its rules directory unless passive is set
+// A passive store (for a CLI command) leaves the workspace as it found it: rule IDs
+// aren't written back, the first load isn't versioned, traffic isn't migrated to the
+// configured backend, and retention and truncation aren't applied
+func newStore(configDir string, cfg *config.Config, passive bool) (*Store, error) {
 	s := &Store{
 		configDir:        configDir,
 		config:           cfg,
 		rules:            make(map[string][]models.Rule),
+		settings:         make(map[string]*models.ServiceSettings),
+		includes:         make(map[string][]models.Include),
+		fileSettings:     make(map[string]*models.ServiceSettings),
+		profiles:         models.Profiles{Profiles: make(map[string]models.Profile)},
+		loadErrors:       make(map[string]models.RuleLoadError),
+		hits:             make(map[string]int),
+		usedUp:           make(map[string]usedUpRule),
+		historyHeads:     make(map[string]*historyHead),
 		traffic:          make([]models.TrafficEntry, 0, cfg.MaxTrafficEntries),
+		serviceTraffic:   make(map[string]*serviceTraffic),
+		unwritten:        make(map[string]bool),
 		subscribers:      make(map[chan models.TrafficEntry]struct{}),
 		appendCounter:    0,
-		truncateInterval: 5000, // Truncate file every 5000 appends
+		truncateInterval: 5000, // Flush deletes (rewriting traffic.ndjson) every 5000 appends
+		passive:          passive,
 	}
 
 	// Ensure config directory exists
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	if !passive {
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create config directory: %w", err)
+		}
 	}
 
 	// Load rules from files
 	if err := s.loadAllRules(); err != nil {
 		return nil, fmt.Errorf("failed to load rules: %w", err)
 	}
+	s.loadHits()
 
-	// Load traffic history from file
-	if err := s.loadTrafficFromFile(); err != nil {
+	// Load traffic history from the configured backend
+	backend, err := openTrafficBackend(configDir, cfg, passive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open traffic storage: %w", err)
+	}
+	s.backend = backend
+	s.retention = loadWorkspaceMetadata(configDir).Retention
+	if err := s.loadTraffic(); err != nil {
 		fmt.Printf("Note: Could not load traffic history: %v\n", err)
 	}
+	s.recorder = newRecorder(s, cfg.TrafficRecording)
+
+	if passive {
+		return s, nil
+	}
 
 	// Start file watcher for _rules directory
 	rulesDir := filepath.Join(configDir, "_rules")
@@ -74,13 +129,73 @@ func New(configDir string, cfg *config.Config) (*Store, error) {
 	return s, nil
 }
 
+// attach connects the store to its workspace manager's change events and shared library
+func (s *Store) attach(onChange func(models.ChangeEvent), library *Library) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = onChange
+	s.library = library
+}
+
+// Name returns the workspace name (the store directory's base name)
+func (s *Store) Name() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return filepath.Base(s.configDir)
+}
+
+// relocate moves the store directory to newDir and restarts the file watcher
+// Rules, traffic and SSE subscribers are kept, so open streams survive a rename
+func (s *Store) relocate(newDir string) error {
+	// The backend is reopened at the new location
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	if s.backend != nil {
+		s.backend.Close()
+	}
+
+	// History is written outside mu, so the directory only moves under historyMu too
+	s.mu.Lock()
+	s.historyMu.Lock()
+	if err := os.Rename(s.configDir, newDir); err != nil {
+		s.historyMu.Unlock()
+		s.mu.Unlock()
+		s.reopenBackend(s.configDir)
+		return err
+	}
+	s.configDir = newDir
+	s.historyMu.Unlock()
+	oldWatcher := s.watcher
+	s.mu.Unlock()
+
+	if oldWatcher != nil {
+		oldWatcher.Close()
+	}
+
+	watcher, err := NewWatcher(filepath.Join(newDir, "_rules"), s.onFileChange)
+	if err != nil {
+		return fmt.Errorf("failed to restart file watcher: %w", err)
+	}
+
+	s.mu.Lock()
+	s.watcher = watcher
+	s.mu.Unlock()
+
+	if err := s.reopenBackend(newDir); err != nil {
+		return fmt.Errorf("failed to reopen traffic storage: %w", err)
+	}
+	return nil
+}
+
 // loadAllRules loads all YAML rule files from the _rules subdirectory
 func (s *Store) loadAllRules() error {
 	rulesDir := filepath.Join(s.configDir, "_rules")
 
 	// Create _rules directory if it doesn't exist
-	if err := os.MkdirAll(rulesDir, 0755); err != nil {
-		return fmt.Errorf("failed to create rules directory: %w", err)
+	if !s.passive {
+		if err := os.MkdirAll(rulesDir, 0755); err != nil {
+			return fmt.Errorf("failed to create rules directory: %w", err)
+		}
 	}
 
 	files, err := filepath.Glob(filepath.Join(rulesDir, "*.yaml"))
@@ -89,12 +204,22 @@ func (s *Store) loadAllRules() error {
 	}
 
 	for _, file := range files {
+		if !isRulesFile(file) {
+			continue
+		}
 		service := getServiceName(file)
 		if err := s.loadRulesFromFile(service, file); err != nil {
 			fmt.Printf("Warning: Failed to load rules from %s: %v\n", file, err)
 		}
 	}
 
+	if err := s.loadServiceSettingsFile(); err != nil {
+		fmt.Printf("Warning: Failed to load %s: %v\n", serviceSettingsFile, err)
+	}
+	if err := s.loadProfilesFile(); err != nil {
+		fmt.Printf("Warning: Failed to load %s: %v\n", profilesFile, err)
+	}
+
 	return nil
 }
 
@@ -105,22 +230,84 @@ func (s *Store) loadRulesFromFile(service, filePath string) error {
 		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// On a parse error keep the last good rules and remember the error
 	var serviceRules models.ServiceRules
 	if err := yaml.Unmarshal(data, &serviceRules); err != nil {
-		return fmt.Errorf("failed to parse YAML: %w", err)
+		s.loadErrors[service] = models.RuleLoadError{
+			Service: service,
+			File:    filepath.Base(filePath),
+			Error:   err.Error(),
+			Time:    time.Now(),
+		}
+		s.emit(EventRulesError, service, HistorySourceFile, err.Error())
+		return fmt.Errorf("failed to parse YAML (keeping last good rules): %w", err)
 	}
+	delete(s.loadErrors, service)
 
-	s.mu.Lock()
-	s.rules[service] = serviceRules.Rules
-	s.mu.Unlock()
+	// Give rules without an ID a persistent one, writing it back to the file
+	// (the resulting watcher reload finds nothing left to assign)
+	if withIDs, changed, err := assignRuleIDs(data); err == nil && changed {
+		if err := yaml.Unmarshal(withIDs, &serviceRules); err != nil {
+			return fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		if !s.passive {
+			if err := writeFileAtomic(filePath, withIDs, 0644); err != nil {
+				fmt.Printf("Warning: Failed to save rule IDs for %s: %v\n", service, err)
+			}
+			data = withIDs
+		}
+	}
+
+	// Changes made on disk (including the first load) are versioned too
+	if !s.passive {
+		s.recordHistory(service, string(data), HistorySourceFile)
+	}
+
+	_, existed := s.rules[service]
+	before := s.serviceETag(service)
+
+	s.setServiceRules(service, serviceRules)
+
+	// Reloads of our own API writes change nothing and aren't reported
+	if !existed || s.serviceETag(service) != before {
+		s.emit(EventRulesChanged, service, HistorySourceFile, "")
+	}
 
 	fmt.Printf("Loaded %d rule(s) for service '%s'\n", len(serviceRules.Rules), service)
 	return nil
 }
 
-// onFileChange is called when a file changes
+// onFileChange is called when a file changes, is created, removed or renamed
 func (s *Store) onFileChange(filePath string) {
+	if filepath.Base(filePath) == serviceSettingsFile {
+		fmt.Printf("Reloading %s\n", serviceSettingsFile)
+		if err := s.loadServiceSettingsFile(); err != nil {
+			fmt.Printf("Error reloading %s: %v\n", serviceSettingsFile, err)
+		}
+		return
+	}
+	if filepath.Base(filePath) == profilesFile {
+		fmt.Printf("Reloading %s\n", profilesFile)
+		if err := s.loadProfilesFile(); err != nil {
+			fmt.Printf("Error reloading %s: %v\n", profilesFile, err)
+		}
+		return
+	}
+	if !isRulesFile(filePath) {
+		return
+	}
+
 	service := getServiceName(filePath)
+
+	// Removed or renamed away: drop its rules
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		s.reconcileRules()
+		return
+	}
+
 	fmt.Printf("Reloading rules for service '%s'\n", service)
 
 	if err := s.loadRulesFromFile(service, filePath); err != nil {
@@ -150,6 +337,82 @@ func (s *Store) GetRules(service string) []models.Rule {
 	return []models.Rule{}
 }
 
+// GetServiceRules returns a service's rules file contents (settings, includes and own rules)
+func (s *Store) GetServiceRules(service string) models.ServiceRules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	serviceRules := s.serviceRules(service)
+	rules := make([]models.Rule, len(serviceRules.Rules))
+	copy(rules, serviceRules.Rules)
+	serviceRules.Rules = rules
+	return serviceRules
+}
+
+// serviceRules assembles the in-memory contents of a service's rules file
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) serviceRules(service string) models.ServiceRules {
+	return models.ServiceRules{
+		Settings: s.settings[service],
+		Include:  s.includes[service],
+		Rules:    s.rules[service],
+	}
+}
+
+// setServiceRules replaces a service's in-memory rules, settings and includes
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) setServiceRules(service string, serviceRules models.ServiceRules) {
+	s.rules[service] = serviceRules.Rules
+	if serviceRules.Settings != nil {
+		s.settings[service] = serviceRules.Settings
+	} else {
+		delete(s.settings, service)
+	}
+	if len(serviceRules.Include) > 0 {
+		s.includes[service] = serviceRules.Include
+	} else {
+		delete(s.includes, service)
+	}
+}
+
+// forgetService drops everything held in memory for a service
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) forgetService(service string) {
+	delete(s.rules, service)
+	delete(s.settings, service)
+	delete(s.includes, service)
+	delete(s.loadErrors, service)
+	for key := range s.hits {
+		if strings.HasPrefix(key, service+"\x00") {
+			delete(s.hits, key)
+			delete(s.usedUp, key)
+			s.hitsDirty = true
+		}
+	}
+}
+
+// GetServiceSettings returns the effective settings for a service (its _service.yaml entry
+// overlaid with its own settings: block), or nil if it has none
+func (s *Store) GetServiceSettings(service string) *models.ServiceSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mergeServiceSettings(s.fileSettings[service], s.settings[service])
+}
+
+// GetLoadErrors returns the services whose rules file failed to load
+// (their last good rules stay active)
+func (s *Store) GetLoadErrors() map[string]models.RuleLoadError {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]models.RuleLoadError, len(s.loadErrors))
+	for service, loadErr := range s.loadErrors {
+		result[service] = loadErr
+	}
+	return result
+}
+
 // GetAllRules returns all rules grouped by service
 func (s *Store) GetAllRules() map[string][]models.Rule {
 	s.mu.RLock()
@@ -166,24 +429,52 @@ func (s *Store) GetAllRules() map[string][]models.Rule {
 }
 
 // AddRule adds a rule to a service (adds at the beginning for highest priority)
-func (s *Store) AddRule(service string, rule models.Rule) error {
+// A rule without an ID is given one; the rule's ID is returned
+// ifMatch, if set, must match the service's current ETag
+func (s *Store) AddRule(service string, rule models.Rule, ifMatch string) (string, error) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return "", err
+	}
+
+	taken := ruleIDs(s.rules[service])
+	if rule.ID == "" {
+		rule.ID = newRuleID(taken)
+	} else if taken[rule.ID] {
+		return "", fmt.Errorf("%w: %s", ErrRuleIDExists, rule.ID)
+	}
+
 	s.rules[service] = append([]models.Rule{rule}, s.rules[service]...)
-	rules := s.rules[service]
-	s.mu.Unlock()
 
 	// Save to file
-	return s.saveRulesToFile(service, rules)
+	return rule.ID, s.saveRulesToFile(service, s.rules[service])
 }
 
 // UpdateRule updates a rule at a specific index
-func (s *Store) UpdateRule(service string, index int, rule models.Rule) error {
+func (s *Store) UpdateRule(service string, index int, rule models.Rule, ifMatch string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+	return s.updateRule(service, index, rule)
+}
+
+// updateRule replaces a rule, keeping its ID unless a new unique one is given
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) updateRule(service string, index int, rule models.Rule) error {
 	rules, ok := s.rules[service]
 	if !ok || index < 0 || index >= len(rules) {
-		return fmt.Errorf("rule not found")
+		return ErrRuleNotFound
+	}
+
+	if rule.ID == "" {
+		rule.ID = rules[index].ID
+	} else if rule.ID != rules[index].ID && s.ruleIndex(service, rule.ID) >= 0 {
+		return fmt.Errorf("%w: %s", ErrRuleIDExists, rule.ID)
 	}
 
 	rules[index] = rule
@@ -191,13 +482,22 @@ func (s *Store) UpdateRule(service string, index int, rule models.Rule) error {
 }
 
 // DeleteRule deletes a rule at a specific index
-func (s *Store) DeleteRule(service string, index int) error {
+func (s *Store) DeleteRule(service string, index int, ifMatch string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+	return s.deleteRule(service, index)
+}
+
+// deleteRule removes a rule
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) deleteRule(service string, index int) error {
 	rules, ok := s.rules[service]
 	if !ok || index < 0 || index >= len(rules) {
-		return fmt.Errorf("rule not found")
+		return ErrRuleNotFound
 	}
 
 	// Remove rule
@@ -208,13 +508,22 @@ func (s *Store) DeleteRule(service string, index int) error {
 }
 
 // MoveRule moves a rule up or down
-func (s *Store) MoveRule(service string, index int, direction string) error {
+func (s *Store) MoveRule(service string, index int, direction, ifMatch string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+	return s.moveRule(service, index, direction)
+}
+
+// moveRule swaps a rule with its neighbour
+// Note: This method assumes the mutex is already held by the caller
+func (s *Store) moveRule(service string, index int, direction string) error {
 	rules, ok := s.rules[service]
 	if !ok || index < 0 || index >= len(rules) {
-		return fmt.Errorf("rule not found")
+		return ErrRuleNotFound
 	}
 
 	var newIndex int
@@ -240,10 +549,14 @@ func (s *Store) MoveRule(service string, index int, direction string) error {
 }
 
 // DisableService disables a service by renaming its YAML file with a .disabled-timestamp extension
-func (s *Store) DisableService(service string) error {
+func (s *Store) DisableService(service, ifMatch string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.checkETag(service, ifMatch); err != nil {
+		return err
+	}
+
 	// Check if service exists
 	if _, ok := s.rules[service]; !ok {
 		return fmt.Errorf("service not found: %s", service)
@@ -269,14 +582,17 @@ func (s *Store) DisableService(service string) error {
 	}
 
 	// Remove from in-memory store
-	delete(s.rules, service)
+	s.forgetService(service)
+	s.emit(EventRulesRemoved, service, HistorySourceAPI, "")
 
 	return nil
 }
 
 // saveRulesToFile saves rules to a YAML file in the _rules subdirectory
+// Note: This method assumes the mutex is already held by the caller
 func (s *Store) saveRulesToFile(service string, rules []models.Rule) error {
-	serviceRules := models.ServiceRules{Rules: rules}
+	serviceRules := s.serviceRules(service)
+	serviceRules.Rules = rules
 
 	data, err := yaml.Marshal(serviceRules)
 	if err != nil {
@@ -290,15 +606,27 @@ func (s *Store) saveRulesToFile(service string, rules []models.Rule) error {
 	}
 
 	filePath := filepath.Join(rulesDir, service+".yaml")
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := writeFileAtomic(filePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
+	s.recordHistory(service, string(data), HistorySourceAPI)
+	s.emit(EventRulesChanged, service, HistorySourceAPI, "")
 	return nil
 }
 
 // AddTraffic adds a traffic entry
 func (s *Store) AddTraffic(entry models.TrafficEntry) {
+	s.RecordTraffic(entry, nil)
+}
+
+// RecordTraffic adds a traffic entry under its service's recording policy, which may
+// skip it, strip its bodies or cap how much of the service's traffic is kept
+func (s *Store) RecordTraffic(entry models.TrafficEntry, policy *models.RecordingPolicy) {
+	if !applyRecordingPolicy(&entry, policy) {
+		return
+	}
+
 	// Get request Content-Type header for smart truncation
 	reqContentType := ""
 	if ct, ok := entry.Headers["Content-Type"]; ok && len(ct) > 0 {
@@ -319,29 +647,32 @@ func (s *Store) AddTraffic(entry models.TrafficEntry) {
 	}
 
 	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	// Add to list
 	s.traffic = append(s.traffic, entry)
+	s.countEntry(&s.traffic[len(s.traffic)-1], 1)
 
-	// Keep only last N entries (use config value)
+	// Keep only last N entries in memory (use config value, or the workspace's retention if
+	// lower); the ndjson backend drops them at the next flush, sqlite keeps them
 	maxEntries := s.config.MaxTrafficEntries
+	if s.retention != nil && s.retention.MaxEntries > 0 && s.retention.MaxEntries < maxEntries {
+		maxEntries = s.retention.MaxEntries
+	}
 	if len(s.traffic) > maxEntries {
+		for i := range s.traffic[:len(s.traffic)-maxEntries] {
+			dropped := &s.traffic[i]
+			s.countEntry(dropped, -1)
+			if !s.keepsHistory() {
+				s.pendingDeletes = append(s.pendingDeletes, dropped.ID)
+			}
+			delete(s.sizes, dropped.ID)
+		}
 		s.traffic = s.traffic[len(s.traffic)-maxEntries:]
 	}
-
-	// Immediately append to disk (eager write)
-	if err := s.appendTrafficEntry(entry); err != nil {
-		fmt.Printf("Warning: Failed to append traffic entry to disk: %v\n", err)
-	}
-
-	// Check if we need to truncate the file (every N appends)
-	count := atomic.AddInt64(&s.appendCounter, 1)
-	if count%int64(s.truncateInterval) == 0 {
-		// Truncate synchronously (mutex already held, safe to do inline)
-		if err := s.truncateTrafficFile(); err != nil {
-			fmt.Printf("Warning: Failed to truncate traffic file: %v\n", err)
-		}
+	if policy != nil && !s.trimService(entry.Service, policy.Retention, entry.ID) {
+		// The entry alone is over the service's limits, so it's neither shown nor stored
+		s.mu.Unlock()
+		return
 	}
 
 	// Broadcast to all SSE subscribers (non-blocking)
@@ -354,6 +685,21 @@ func (s *Store) AddTraffic(entry models.TrafficEntry) {
 			}
 		}
 	}
+	s.unwritten[entry.ID] = true
+	s.mu.Unlock()
+
+	// Persisted in the background
+	s.persist(entry)
+}
+
+// persist hands an entry marked unwritten to the recorder, unmarking it if the
+// recorder turns it away (so deletes of it aren't held back for good)
+func (s *Store) persist(entry models.TrafficEntry) {
+	if !s.recorder.enqueue(entry) {
+		s.mu.Lock()
+		delete(s.unwritten, entry.ID)
+		s.mu.Unlock()
+	}
 }
 
 // GetTraffic returns recent traffic entries
@@ -396,16 +742,22 @@ func (s *Store) GetTotalTrafficCount(service string) int {
 // GetTrafficByID returns a specific traffic entry
 func (s *Store) GetTrafficByID(id string) *models.TrafficEntry {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	for i := range s.traffic {
 		if s.traffic[i].ID == id {
 			entry := s.traffic[i]
+			s.mu.RUnlock()
 			return &entry
 		}
 	}
+	s.mu.RUnlock()
 
-	return nil
+	// Older entries may still be in the backend's history
+	var entry *models.TrafficEntry
+	s.withHistory(func(history *sqliteBackend) (err error) {
+		entry, err = history.get(id)
+		return err
+	})
+	return entry
 }
 
 // SubscribeTraffic creates a new channel for traffic updates
@@ -423,15 +775,21 @@ func (s *Store) UnsubscribeTraffic(ch <-chan models.TrafficEntry) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Convert to bidirectional channel for deletion
-	if writeCh, ok := interface{}(ch).(chan models.TrafficEntry); ok {
-		delete(s.subscribers, writeCh)
-		close(writeCh)
+	// Find the bidirectional channel for deletion
+	// (channels already closed by Close are no longer subscribed)
+	for writeCh := range s.subscribers {
+		if (<-chan models.TrafficEntry)(writeCh) == ch {
+			delete(s.subscribers, writeCh)
+			close(writeCh)
+			return
+		}
 	}
 }
 
 // Close closes the store and stops the file watcher
 func (s *Store) Close() error {
+	s.flushHits()
+
 	s.mu.Lock()
 	if !s.closed {
 		s.closed = true
@@ -441,12 +799,29 @@ func (s *Store) Close() error {
 		}
 		s.subscribers = make(map[chan models.TrafficEntry]struct{})
 	}
+	watcher := s.watcher
 	s.mu.Unlock()
 
-	if s.watcher != nil {
-		return s.watcher.Close()
+	// Write queued traffic before closing the backend
+	s.recorder.stop()
+
+	s.backendMu.Lock()
+	if s.backend != nil {
+		if err := s.backend.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close traffic storage: %v\n", err)
+		}
+		s.backend = nil
 	}
-	return nil
+	s.backendMu.Unlock()
+
+	var err error
+	if watcher != nil {
+		err = watcher.Close()
+	}
+
+	// Write rule versions queued by saves and reloads
+	s.flushHistory()
+	return err
 }
 
 // isTextContent checks if the content type is text-based (JSON, XML, HTML, plain text, etc.)
@@ -533,151 +908,74 @@ func truncateBody(data interface{}, contentType string) interface{} {
 	return bodyStr[:maxSize] + "...[truncated]"
 }
 
-// loadTrafficFromFile loads traffic history from traffic.ndjson
-func (s *Store) loadTrafficFromFile() error {
-	trafficPath := filepath.Join(s.configDir, "traffic.ndjson")
-
-	file, err := os.Open(trafficPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // File doesn't exist yet, start with empty traffic
-		}
-		return err
-	}
-	defer file.Close()
-
-	var traffic []models.TrafficEntry
-	scanner := bufio.NewScanner(file)
-
-	// Increase buffer size to handle large bodies (up to 2MB + overhead for JSON structure)
-	// Default maxTokenSize is 64KB, but we need to support 2MB bodies
-	maxScanTokenSize := maxTextBodySizeBytes + (512 * 1024) // 2MB + 512KB overhead
-	buf := make([]byte, 0, maxScanTokenSize)
-	scanner.Buffer(buf, maxScanTokenSize)
-
-	lineNum := 0
-
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		if line == "" {
-			continue // Skip empty lines
-		}
-
-		var entry models.TrafficEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			fmt.Printf("Warning: Skipping invalid traffic entry at line %d: %v\n", lineNum, err)
-			continue
+// loadTraffic loads traffic history from the backend
+func (s *Store) loadTraffic() error {
+	if history, ok := s.backend.(*sqliteBackend); ok && !s.passive {
+		// History recorded before a tighter retention policy was set
+		if limits := parseRetention(s.retention); limits != nil {
+			if _, err := history.retain(nil, limits, time.Now()); err != nil {
+				fmt.Printf("Warning: Failed to apply retention to traffic history: %v\n", err)
+			}
 		}
-
-		traffic = append(traffic, entry)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read traffic.ndjson: %w", err)
+	traffic, err := s.backend.Load(s.config.MaxTrafficEntries)
+	if err != nil {
+		return err
 	}
 
-	// Auto-truncate if file has more entries than configured limit
-	needsTruncation := false
-	if len(traffic) > s.config.MaxTrafficEntries {
-		fmt.Printf("Traffic file has %d entries, truncating to %d\n", len(traffic), s.config.MaxTrafficEntries)
-		traffic = traffic[len(traffic)-s.config.MaxTrafficEntries:]
-		needsTruncation = true
-	}
+	// Imported traffic (HAR) is stored after what was recorded before it
+	sort.SliceStable(traffic, func(i, j int) bool {
+		return traffic[i].Timestamp.Before(traffic[j].Timestamp)
+	})
 
 	s.mu.Lock()
 	s.traffic = traffic
-	s.mu.Unlock()
-
-	// If we truncated in-memory, rewrite the file
-	if needsTruncation {
-		if err := s.truncateTrafficFile(); err != nil {
-			fmt.Printf("Warning: Failed to truncate traffic file on startup: %v\n", err)
-		}
+	// History recorded before a tighter retention policy was set
+	if !s.passive {
+		s.applyRetention(nil, parseRetention(s.retention), time.Now())
 	}
+	s.recountTraffic()
+	s.mu.Unlock()
 
 	fmt.Printf("Loaded %d traffic entries from history\n", len(traffic))
 	return nil
 }
 
-// appendTrafficEntry appends a single traffic entry to traffic.ndjson
-func (s *Store) appendTrafficEntry(entry models.TrafficEntry) error {
-	// Marshal entry to compact JSON (no indentation)
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("failed to marshal traffic entry: %w", err)
-	}
+// keepsHistory reports whether the backend keeps traffic after it drops out of memory
+// (sqlite does, so only retention deletes from it; ndjson holds only what's in memory)
+func (s *Store) keepsHistory() bool {
+	return s.config.TrafficStorage == config.TrafficStorageSQLite
+}
 
-	// Open file in append mode (create if doesn't exist)
-	trafficPath := filepath.Join(s.configDir, "traffic.ndjson")
-	file, err := os.OpenFile(trafficPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open traffic file: %w", err)
+// withHistory runs fn with the backend's whole traffic history, reporting false if the
+// backend holds only what's in memory; errors are logged and returned
+func (s *Store) withHistory(fn func(history *sqliteBackend) error) (bool, error) {
+	if !s.keepsHistory() {
+		return false, nil
 	}
-	defer file.Close()
-
-	// Write JSON line + newline
-	if _, err := file.Write(data); err != nil {
-		return fmt.Errorf("failed to write traffic entry: %w", err)
+	s.backendMu.Lock()
+	defer s.backendMu.Unlock()
+	history, ok := s.backend.(*sqliteBackend)
+	if !ok {
+		return false, nil
 	}
-	if _, err := file.WriteString("\n"); err != nil {
-		return fmt.Errorf("failed to write newline: %w", err)
+	if err := fn(history); err != nil {
+		fmt.Printf("Warning: Failed to read traffic history: %v\n", err)
+		return true, err
 	}
-
-	return nil
+	return true, nil
 }
 
-// truncateTrafficFile truncates the traffic.ndjson file to keep only the last MaxTrafficEntries
-// Note: This method assumes the mutex is already held by the caller (from AddTraffic)
-func (s *Store) truncateTrafficFile() error {
-	trafficPath := filepath.Join(s.configDir, "traffic.ndjson")
-	tempPath := trafficPath + ".tmp"
-
-	// Get entries to keep from in-memory slice (mutex already held)
-	entriesToKeep := s.traffic
-	if len(entriesToKeep) > s.config.MaxTrafficEntries {
-		entriesToKeep = entriesToKeep[len(entriesToKeep)-s.config.MaxTrafficEntries:]
-	}
-
-	// Create temp file
-	file, err := os.Create(tempPath)
+// reopenBackend opens the traffic backend in dir, e.g. after the store directory moved
+// Note: This method assumes backendMu is already held by the caller
+func (s *Store) reopenBackend(dir string) error {
+	backend, err := openTrafficBackend(dir, s.config, s.passive)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-
-	// Write all entries
-	for _, entry := range entriesToKeep {
-		data, err := json.Marshal(entry)
-		if err != nil {
-			file.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to marshal entry: %w", err)
-		}
-
-		if _, err := file.Write(data); err != nil {
-			file.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to write entry: %w", err)
-		}
-		if _, err := file.WriteString("\n"); err != nil {
-			file.Close()
-			os.Remove(tempPath)
-			return fmt.Errorf("failed to write newline: %w", err)
-		}
-	}
-
-	if err := file.Close(); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
-
-	// Atomic rename
-	if err := os.Rename(tempPath, trafficPath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
+		s.backend = nil
+		return err
 	}
-
-	fmt.Printf("Truncated traffic file to %d entries\n", len(entriesToKeep))
+	s.backend = backend
 	return nil
 }
 
@@ -0,0 +1,333 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+const (
+	trafficNDJSONFile = "traffic.ndjson"
+	trafficSQLiteFile = "traffic.db"
+)
+
+// TrafficBackend persists a workspace's traffic history
+// The store keeps the most recent entries in memory and mirrors them to its backend;
+// ndjson holds only those entries, while sqlite keeps the whole history (see keepsHistory)
+type TrafficBackend interface {
+	// Load returns the newest limit entries, oldest first (ndjson discards any older ones)
+	Load(limit int) ([]models.TrafficEntry, error)
+	// Append persists new entries, in the order given
+	Append(entries []models.TrafficEntry) error
+	// Delete removes entries by ID
+	Delete(ids []string) error
+	// Sync flushes appended entries to stable storage (fsync)
+	Sync() error
+	// Close releases the backend
+	Close() error
+}
+
+// openTrafficBackend opens the traffic backend selected by the config's traffic_storage
+func openTrafficBackend(dir string, cfg *config.Config, passive bool) (TrafficBackend, error) {
+	switch cfg.TrafficStorage {
+	case "", config.TrafficStorageNDJSON:
+		return &ndjsonBackend{path: filepath.Join(dir, trafficNDJSONFile), passive: passive}, nil
+	case config.TrafficStorageSQLite:
+		if passive {
+			return openPassiveSQLiteBackend(dir)
+		}
+		backend, err := openSQLiteBackend(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := backend.migrateNDJSON(dir); err != nil {
+			backend.Close()
+			return nil, fmt.Errorf("failed to move traffic.ndjson into traffic.db: %w", err)
+		}
+		return backend, nil
+	}
+	return nil, fmt.Errorf("unknown traffic storage %q", cfg.TrafficStorage)
+}
+
+// openPassiveSQLiteBackend opens traffic.db for a CLI command without migrating
+// traffic.ndjson into it; until the server has created the database (and moved the
+// traffic over) traffic is read from, and appended to, traffic.ndjson
+func openPassiveSQLiteBackend(dir string) (TrafficBackend, error) {
+	if _, err := os.Stat(filepath.Join(dir, trafficSQLiteFile)); err != nil {
+		return &ndjsonBackend{path: filepath.Join(dir, trafficNDJSONFile), passive: true}, nil
+	}
+	return openSQLiteBackend(dir)
+}
+
+// readTrafficNDJSON returns a workspace directory's traffic as ndjson, whichever backend
+// the config selects (used for bundles, which always carry traffic.ndjson)
+func readTrafficNDJSON(dir string, cfg *config.Config) ([]byte, error) {
+	backend, err := openStoredSQLite(dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if backend != nil {
+		defer backend.Close()
+		entries, err := backend.entries()
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal traffic entry: %w", err)
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+
+	return os.ReadFile(filepath.Join(dir, trafficNDJSONFile))
+}
+
+// countTraffic counts the traffic entries stored in a workspace directory by the backend
+// the config selects
+func countTraffic(dir string, cfg *config.Config) int {
+	backend, err := openStoredSQLite(dir, cfg)
+	if err != nil {
+		return 0
+	}
+	if backend != nil {
+		defer backend.Close()
+		return backend.count()
+	}
+
+	file, err := os.Open(filepath.Join(dir, trafficNDJSONFile))
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		count++
+	}
+	return count
+}
+
+// ndjsonBackend stores traffic as one JSON entry per line in traffic.ndjson
+// Appends are cheap; deletes rewrite the whole file, so callers batch them
+type ndjsonBackend struct {
+	path    string
+	file    *os.File // Kept open for appending between rewrites
+	passive bool     // Opened for a CLI command: Load leaves an over-long file alone
+}
+
+// Load reads traffic.ndjson, rewriting it if it holds more than limit entries
+func (b *ndjsonBackend) Load(limit int) ([]models.TrafficEntry, error) {
+	file, err := os.Open(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // File doesn't exist yet, start with empty traffic
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var traffic []models.TrafficEntry
+	scanner := newTrafficScanner(file)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue // Skip empty lines
+		}
+
+		var entry models.TrafficEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			fmt.Printf("Warning: Skipping invalid traffic entry at line %d: %v\n", lineNum, err)
+			continue
+		}
+
+		traffic = append(traffic, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read traffic.ndjson: %w", err)
+	}
+
+	// Auto-truncate if file has more entries than configured limit
+	if len(traffic) > limit {
+		if b.passive {
+			return traffic[len(traffic)-limit:], nil
+		}
+		fmt.Printf("Traffic file has %d entries, truncating to %d\n", len(traffic), limit)
+		traffic = traffic[len(traffic)-limit:]
+		if err := b.rewrite(traffic); err != nil {
+			fmt.Printf("Warning: Failed to truncate traffic file on startup: %v\n", err)
+		}
+	}
+
+	return traffic, nil
+}
+
+// Append appends entries to traffic.ndjson
+func (b *ndjsonBackend) Append(entries []models.TrafficEntry) error {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		// Marshal entry to compact JSON (no indentation)
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal traffic entry: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	// Open file in append mode (create if doesn't exist)
+	if b.file == nil {
+		file, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open traffic file: %w", err)
+		}
+		b.file = file
+	}
+
+	if _, err := b.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write traffic entry: %w", err)
+	}
+	return nil
+}
+
+// Delete rewrites traffic.ndjson without the given entries
+func (b *ndjsonBackend) Delete(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	remove := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		remove[id] = true
+	}
+
+	file, err := os.Open(b.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	tempPath := b.path + ".tmp"
+	temp, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	writer := bufio.NewWriter(temp)
+
+	kept := 0
+	scanner := newTrafficScanner(file)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var entry struct {
+			ID string `json:"id"`
+		}
+		if len(line) == 0 || json.Unmarshal(line, &entry) != nil || remove[entry.ID] {
+			continue
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+		kept++
+	}
+	if err := scanner.Err(); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to read traffic.ndjson: %w", err)
+	}
+
+	return b.replace(temp, writer, kept)
+}
+
+// Sync fsyncs traffic.ndjson
+func (b *ndjsonBackend) Sync() error {
+	if b.file == nil {
+		return nil
+	}
+	return b.file.Sync()
+}
+
+// Close closes traffic.ndjson
+func (b *ndjsonBackend) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+// rewrite replaces traffic.ndjson with the given entries
+func (b *ndjsonBackend) rewrite(entries []models.TrafficEntry) error {
+	tempPath := b.path + ".tmp"
+	temp, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	writer := bufio.NewWriter(temp)
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			temp.Close()
+			os.Remove(tempPath)
+			return fmt.Errorf("failed to marshal entry: %w", err)
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+
+	return b.replace(temp, writer, len(entries))
+}
+
+// replace flushes a temp file written by rewrite or Delete and renames it over traffic.ndjson
+func (b *ndjsonBackend) replace(temp *os.File, writer *bufio.Writer, count int) error {
+	tempPath := temp.Name()
+	if err := writer.Flush(); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	// Atomic rename (reopening for appends afterwards)
+	b.Close()
+	if err := os.Rename(tempPath, b.path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	fmt.Printf("Truncated traffic file to %d entries\n", count)
+	return nil
+}
+
+// newTrafficScanner returns a line scanner able to read entries with large bodies
+func newTrafficScanner(file *os.File) *bufio.Scanner {
+	scanner := bufio.NewScanner(file)
+
+	// Increase buffer size to handle large bodies (up to 2MB + overhead for JSON structure)
+	// Default maxTokenSize is 64KB, but we need to support 2MB bodies
+	maxScanTokenSize := maxTextBodySizeBytes + (512 * 1024) // 2MB + 512KB overhead
+	buf := make([]byte, 0, maxScanTokenSize)
+	scanner.Buffer(buf, maxScanTokenSize)
+	return scanner
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/verify"
+)
+
+func TestTrafficBackends(t *testing.T) {
+	entries := make([]models.TrafficEntry, 6)
+	for i := range entries {
+		entries[i] = models.TrafficEntry{
+			ID:        fmt.Sprintf("req-%d", i),
+			Timestamp: time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC),
+			Service:   "servicex",
+			Method:    "GET",
+			Path:      "/servicex/users",
+			Response:  &models.Response{StatusCode: 200},
+		}
+	}
+	ids := func(entries []models.TrafficEntry) []string {
+		var result []string
+		for _, entry := range entries {
+			result = append(result, entry.ID)
+		}
+		return result
+	}
+
+	// ndjson only holds what's loaded into memory, sqlite keeps the whole history
+	stored := map[string]int{config.TrafficStorageNDJSON: 3, config.TrafficStorageSQLite: 5}
+
+	for _, storage := range []string{config.TrafficStorageNDJSON, config.TrafficStorageSQLite} {
+		t.Run(storage, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{TrafficStorage: storage}
+
+			backend, err := openTrafficBackend(dir, cfg, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.Append(entries[:4]); err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.Append(entries[4:]); err != nil {
+				t.Fatal(err)
+			}
+			if err := backend.Delete([]string{"req-1", "req-unknown"}); err != nil {
+				t.Fatal(err)
+			}
+			backend.Close()
+
+			// Reopening loads the newest entries
+			backend, err = openTrafficBackend(dir, cfg, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := backend.Load(3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(ids(loaded)); got != "[req-3 req-4 req-5]" {
+				t.Errorf("Load(3) = %s", got)
+			}
+			if loaded[0].Response == nil || loaded[0].Response.StatusCode != 200 {
+				t.Errorf("loaded entry = %+v", loaded[0])
+			}
+			backend.Close()
+
+			if count := countTraffic(dir, cfg); count != stored[storage] {
+				t.Errorf("countTraffic() = %d, expected %d", count, stored[storage])
+			}
+			data, err := readTrafficNDJSON(dir, cfg)
+			if err != nil || len(data) == 0 {
+				t.Errorf("readTrafficNDJSON() = %d bytes, %v", len(data), err)
+			}
+		})
+	}
+}
+
+func TestSQLiteMigratesNDJSON(t *testing.T) {
+	configDir := t.TempDir()
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 100}
+
+	st, err := New(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		st.AddTraffic(models.TrafficEntry{ID: fmt.Sprintf("req-%d", i), Timestamp: time.Now(), Service: "servicex"})
+	}
+	st.Close()
+
+	// Switching to sqlite moves the history into traffic.db
+	cfg.TrafficStorage = config.TrafficStorageSQLite
+	st, err = New(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if traffic := st.GetTraffic(10, ""); len(traffic) != 3 || traffic[0].ID != "req-2" {
+		t.Errorf("GetTraffic() after migration = %+v", traffic)
+	}
+	if _, err := os.Stat(filepath.Join(configDir, trafficNDJSONFile)); !os.IsNotExist(err) {
+		t.Errorf("traffic.ndjson should be removed after migration: %v", err)
+	}
+
+	st.AddTraffic(models.TrafficEntry{ID: "req-3", Timestamp: time.Now(), Service: "servicex"})
+	st.FlushTraffic()
+	if count := countTraffic(configDir, cfg); count != 4 {
+		t.Errorf("countTraffic() = %d, expected 4", count)
+	}
+
+	// Counting follows the config, not whichever files are left in the directory,
+	// and doesn't create a database that isn't there
+	if count := countTraffic(configDir, &config.Config{TrafficStorage: config.TrafficStorageNDJSON}); count != 0 {
+		t.Errorf("countTraffic(ndjson) = %d, expected 0", count)
+	}
+	emptyDir := t.TempDir()
+	if count := countTraffic(emptyDir, cfg); count != 0 {
+		t.Errorf("countTraffic() of an empty workspace = %d", count)
+	}
+	if _, err := os.Stat(filepath.Join(emptyDir, trafficSQLiteFile)); !os.IsNotExist(err) {
+		t.Errorf("countTraffic() created traffic.db: %v", err)
+	}
+}
+
+func TestSQLiteKeepsHistory(t *testing.T) {
+	configDir := t.TempDir()
+	cfg := &config.Config{ConfigDir: configDir, MaxTrafficEntries: 3, TrafficStorage: config.TrafficStorageSQLite}
+	st, err := New(configDir, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	// Alternating servicex (200) and servicey (500) entries, one minute apart, oldest first
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 8; i++ {
+		service, status := "servicex", 200
+		if i%2 == 1 {
+			service, status = "servicey", 500
+		}
+		st.AddTraffic(models.TrafficEntry{
+			ID:        fmt.Sprintf("req-%d", i),
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			Service:   service,
+			Method:    "GET",
+			Path:      "/" + service + "/users",
+			Response:  &models.Response{StatusCode: status},
+		})
+	}
+
+	// Only the newest entries are kept in memory, the rest stay in traffic.db
+	if count := st.GetTotalTrafficCount(""); count != 3 {
+		t.Errorf("GetTotalTrafficCount() = %d, expected 3", count)
+	}
+	st.FlushTraffic()
+	if count := countTraffic(configDir, cfg); count != 8 {
+		t.Errorf("countTraffic() = %d, expected 8", count)
+	}
+
+	// Searches page through the whole history
+	q, err := query.Parse("status:5xx", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	opts := query.Options{Limit: 3}
+	for {
+		page, err := st.SearchTraffic(q, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range page.Entries {
+			found = append(found, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	if got := fmt.Sprint(found); got != "[req-7 req-5 req-3 req-1]" {
+		t.Errorf("search found %s", got)
+	}
+
+	if entry := st.GetTrafficByID("req-0"); entry == nil || entry.Service != "servicex" {
+		t.Errorf("GetTrafficByID(req-0) = %+v", entry)
+	}
+	if exported := st.FilterTraffic("servicex", nil, 0); len(exported) != 4 || exported[0].ID != "req-0" {
+		t.Errorf("FilterTraffic() = %d entries", len(exported))
+	}
+	if result := st.VerifyTraffic(verify.Request{Service: "servicey", Match: models.MatchCondition{Path: "/servicey/users"}}); result.Count != 4 {
+		t.Errorf("VerifyTraffic() count = %d, expected 4", result.Count)
+	}
+
+	// Retention deletes from the whole history, and from memory
+	st.SetRetention(&models.Retention{MaxEntries: 4})
+	if dropped := st.ApplyRetention(map[string]*models.Retention{"servicex": {MaxEntries: 1}}, time.Now()); dropped != 4 {
+		t.Errorf("ApplyRetention() = %d, expected 4", dropped)
+	}
+	var kept []string
+	for _, entry := range st.FilterTraffic("", nil, 0) {
+		kept = append(kept, entry.ID)
+	}
+	if got := fmt.Sprint(kept); got != "[req-3 req-5 req-6 req-7]" {
+		t.Errorf("history after retention = %s", got)
+	}
+	if count := st.GetTotalTrafficCount(""); count != 3 {
+		t.Errorf("GetTotalTrafficCount() after retention = %d, expected 3", count)
+	}
+}
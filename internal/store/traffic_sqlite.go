@@ -0,0 +1,487 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+
+	_ "modernc.org/sqlite" // Pure Go SQLite driver (no cgo)
+)
+
+// sqliteSchema creates the traffic table; the indexed columns are copied out of the
+// JSON entry so retention and searches don't need to parse it
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS traffic (
+	seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+	id        TEXT NOT NULL UNIQUE,
+	timestamp INTEGER NOT NULL,
+	service   TEXT NOT NULL,
+	status    INTEGER NOT NULL,
+	rule_id   TEXT NOT NULL,
+	size      INTEGER NOT NULL,
+	entry     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS traffic_timestamp ON traffic(timestamp);
+CREATE INDEX IF NOT EXISTS traffic_service ON traffic(service, timestamp);
+CREATE INDEX IF NOT EXISTS traffic_status ON traffic(status);
+CREATE INDEX IF NOT EXISTS traffic_rule ON traffic(rule_id);
+`
+
+// sqliteDeleteBatch is how many IDs are deleted per statement (SQLite limits bound parameters)
+const sqliteDeleteBatch = 500
+
+// sqliteBackend stores traffic in an embedded SQLite database (traffic.db)
+// It keeps the whole history: entries falling out of memory stay in the database until
+// retention deletes them, and searches, verification and exports read from it
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+// openSQLiteBackend opens (creating if needed) a workspace directory's traffic.db
+func openSQLiteBackend(dir string) (*sqliteBackend, error) {
+	path := filepath.Join(dir, trafficSQLiteFile)
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open traffic database: %w", err)
+	}
+	// A single connection serialises writers, which SQLite requires anyway
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create traffic table: %w", err)
+	}
+	return &sqliteBackend{db: db}, nil
+}
+
+// openStoredSQLite opens a workspace directory's traffic.db read-only (no schema setup),
+// for reading traffic without loading the workspace
+// Returns nil if the config stores traffic as ndjson, or the database hasn't been
+// created yet (so its traffic is still in traffic.ndjson)
+func openStoredSQLite(dir string, cfg *config.Config) (*sqliteBackend, error) {
+	switch cfg.TrafficStorage {
+	case "", config.TrafficStorageNDJSON:
+		return nil, nil
+	case config.TrafficStorageSQLite:
+		path := filepath.Join(dir, trafficSQLiteFile)
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+		db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open traffic database: %w", err)
+		}
+		db.SetMaxOpenConns(1)
+		return &sqliteBackend{db: db}, nil
+	}
+	return nil, fmt.Errorf("unknown traffic storage %q", cfg.TrafficStorage)
+}
+
+// migrateNDJSON moves an existing traffic.ndjson into the database, e.g. after switching
+// traffic_storage to sqlite or importing a bundle
+func (b *sqliteBackend) migrateNDJSON(dir string) error {
+	path := filepath.Join(dir, trafficNDJSONFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	entries, err := (&ndjsonBackend{path: path}).Load(math.MaxInt)
+	if err != nil {
+		return err
+	}
+	if err := b.Append(entries); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove migrated traffic.ndjson: %w", err)
+	}
+
+	fmt.Printf("Moved %d traffic entries from traffic.ndjson to traffic.db\n", len(entries))
+	return nil
+}
+
+// Load returns the newest limit entries (older ones stay in the database)
+func (b *sqliteBackend) Load(limit int) ([]models.TrafficEntry, error) {
+	rows, err := b.db.Query(`SELECT seq, entry FROM traffic ORDER BY seq DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read traffic: %w", err)
+	}
+	defer rows.Close()
+
+	var traffic []models.TrafficEntry
+	for rows.Next() {
+		var seq int64
+		var data string
+		if err := rows.Scan(&seq, &data); err != nil {
+			return nil, fmt.Errorf("failed to read traffic: %w", err)
+		}
+		var entry models.TrafficEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			fmt.Printf("Warning: Skipping invalid traffic entry %d: %v\n", seq, err)
+			continue
+		}
+		traffic = append(traffic, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read traffic: %w", err)
+	}
+
+	// Oldest first
+	for i, j := 0, len(traffic)-1; i < j; i, j = i+1, j-1 {
+		traffic[i], traffic[j] = traffic[j], traffic[i]
+	}
+	return traffic, nil
+}
+
+// Append inserts entries in a single transaction
+func (b *sqliteBackend) Append(entries []models.TrafficEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO traffic (id, timestamp, service, status, rule_id, size, entry) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to marshal traffic entry: %w", err)
+		}
+		status := 0
+		if entry.Response != nil {
+			status = entry.Response.StatusCode
+		}
+		if _, err := stmt.Exec(entry.ID, entry.Timestamp.UnixNano(), entry.Service, status, entry.MatchedRuleID, len(data), string(data)); err != nil {
+			return fmt.Errorf("failed to insert traffic entry: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit traffic: %w", err)
+	}
+	return nil
+}
+
+// Delete removes entries by ID
+func (b *sqliteBackend) Delete(ids []string) error {
+	for start := 0; start < len(ids); start += sqliteDeleteBatch {
+		end := start + sqliteDeleteBatch
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		if _, err := b.db.Exec(`DELETE FROM traffic WHERE id IN (`+placeholders+`)`, args...); err != nil {
+			return fmt.Errorf("failed to delete traffic: %w", err)
+		}
+	}
+	return nil
+}
+
+// Sync checkpoints the write-ahead log, fsyncing the database
+func (b *sqliteBackend) Sync() error {
+	if _, err := b.db.Exec(`PRAGMA wal_checkpoint(FULL)`); err != nil {
+		return fmt.Errorf("failed to sync traffic database: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
+
+// entries returns every stored entry, oldest first
+func (b *sqliteBackend) entries() ([]models.TrafficEntry, error) {
+	rows, err := b.db.Query(`SELECT entry FROM traffic ORDER BY seq`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read traffic: %w", err)
+	}
+	defer rows.Close()
+
+	var traffic []models.TrafficEntry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read traffic: %w", err)
+		}
+		var entry models.TrafficEntry
+		if err := json.Unmarshal([]byte(data), &entry); err == nil {
+			traffic = append(traffic, entry)
+		}
+	}
+	return traffic, rows.Err()
+}
+
+// count returns the number of stored entries
+func (b *sqliteBackend) count() int {
+	var count int
+	if err := b.db.QueryRow(`SELECT COUNT(*) FROM traffic`).Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+// get returns a stored entry by ID, or nil if there's none
+func (b *sqliteBackend) get(id string) (*models.TrafficEntry, error) {
+	var data string
+	err := b.db.QueryRow(`SELECT entry FROM traffic WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read traffic: %w", err)
+	}
+	var entry models.TrafficEntry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return nil, fmt.Errorf("invalid traffic entry %s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+// services returns the services with stored traffic
+func (b *sqliteBackend) services() ([]string, error) {
+	rows, err := b.db.Query(`SELECT DISTINCT service FROM traffic`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read traffic services: %w", err)
+	}
+	defer rows.Close()
+
+	var services []string
+	for rows.Next() {
+		var service string
+		if err := rows.Scan(&service); err != nil {
+			return nil, fmt.Errorf("failed to read traffic services: %w", err)
+		}
+		services = append(services, service)
+	}
+	return services, rows.Err()
+}
+
+// search returns one page of the stored entries matching a query, in timestamp order like
+// query.Search; the query's bounds are applied with the indexes and the rest per entry
+func (b *sqliteBackend) search(q *query.Query, opts query.Options) (*query.Page, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = query.DefaultLimit
+	}
+	order, after := "DESC", "<"
+	if opts.Ascending {
+		order, after = "ASC", ">"
+	}
+
+	where, args := boundsWhere(q.Bounds())
+	if opts.Cursor != "" {
+		cursorTime, cursorID, err := query.DecodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var seq, timestamp int64
+		err = b.db.QueryRow(`SELECT seq, timestamp FROM traffic WHERE id = ?`, cursorID).Scan(&seq, &timestamp)
+		switch {
+		case err == nil:
+			where = append(where, fmt.Sprintf("(timestamp %s ? OR (timestamp = ? AND seq %s ?))", after, after))
+			args = append(args, timestamp, timestamp, seq)
+		case errors.Is(err, sql.ErrNoRows):
+			// The cursor's entry has since been dropped, so continue from its timestamp
+			where = append(where, "timestamp "+after+" ?")
+			args = append(args, cursorTime.UnixNano())
+		default:
+			return nil, fmt.Errorf("failed to read traffic: %w", err)
+		}
+	}
+
+	page := &query.Page{Entries: []models.TrafficEntry{}}
+	err := b.scan(where, args, "timestamp "+order+", seq "+order, func(entry *models.TrafficEntry) bool {
+		if !q.Match(entry) {
+			return true
+		}
+		if len(page.Entries) == limit {
+			// There's at least one more match, so there's another page
+			last := page.Entries[limit-1]
+			page.NextCursor = query.EncodeCursor(last.Timestamp, last.ID)
+			return false
+		}
+		page.Entries = append(page.Entries, *entry)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// filter returns the stored entries within bounds that match (nil matches everything),
+// oldest first, keeping the newest limit entries (0 for all)
+func (b *sqliteBackend) filter(bounds query.Bounds, match func(*models.TrafficEntry) bool, limit int) ([]models.TrafficEntry, error) {
+	where, args := boundsWhere(bounds)
+
+	var result []models.TrafficEntry
+	err := b.scan(where, args, "timestamp DESC, seq DESC", func(entry *models.TrafficEntry) bool {
+		if match == nil || match(entry) {
+			result = append(result, *entry)
+		}
+		return limit <= 0 || len(result) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, nil
+}
+
+// scan calls fn with each stored entry satisfying the conditions, in the given order,
+// until fn returns false (entries that can't be parsed are skipped)
+func (b *sqliteBackend) scan(where []string, args []interface{}, order string, fn func(*models.TrafficEntry) bool) error {
+	stmt := `SELECT entry FROM traffic`
+	if len(where) > 0 {
+		stmt += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	rows, err := b.db.Query(stmt+` ORDER BY `+order, args...)
+	if err != nil {
+		return fmt.Errorf("failed to read traffic: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("failed to read traffic: %w", err)
+		}
+		var entry models.TrafficEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			continue
+		}
+		if !fn(&entry) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// boundsWhere turns query bounds into conditions on the indexed columns
+func boundsWhere(bounds query.Bounds) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if bounds.Service != "" {
+		where = append(where, "service = ?")
+		args = append(args, bounds.Service)
+	}
+	if bounds.RuleID != "" {
+		where = append(where, "rule_id = ?")
+		args = append(args, bounds.RuleID)
+	}
+	if bounds.MaxStatus != 0 {
+		where = append(where, "status BETWEEN ? AND ?")
+		args = append(args, bounds.MinStatus, bounds.MaxStatus)
+	}
+	if !bounds.Since.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, bounds.Since.UnixNano())
+	}
+	if !bounds.Until.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, bounds.Until.UnixNano())
+	}
+	return where, args
+}
+
+// retain deletes the stored entries outside each service's retention limits, then outside
+// the workspace limits, and returns their IDs
+func (b *sqliteBackend) retain(services map[string]*retentionLimits, workspace *retentionLimits, now time.Time) ([]string, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deleted []string
+	for service, limits := range services {
+		ids, err := deleteOutside(tx, limits, "service = ?", []interface{}{service}, now)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, ids...)
+	}
+	if workspace != nil {
+		ids, err := deleteOutside(tx, workspace, "1", nil, now)
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, ids...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit retention: %w", err)
+	}
+	return deleted, nil
+}
+
+// deleteOutside deletes the entries satisfying where that are older than the limits' max
+// age, or beyond their max entries or max bytes counting newest first, returning their IDs
+func deleteOutside(tx *sql.Tx, limits *retentionLimits, where string, args []interface{}, now time.Time) ([]string, error) {
+	var outside []string
+	if limits.maxAge > 0 {
+		outside = append(outside, "timestamp < ?")
+		args = append(args, now.Add(-limits.maxAge).UnixNano())
+	}
+	if limits.maxEntries > 0 {
+		outside = append(outside, "position > ?")
+		args = append(args, limits.maxEntries)
+	}
+	if limits.maxBytes > 0 {
+		outside = append(outside, "total > ?")
+		args = append(args, limits.maxBytes)
+	}
+
+	rows, err := tx.Query(`DELETE FROM traffic WHERE seq IN (
+		SELECT seq FROM (
+			SELECT seq, timestamp,
+				ROW_NUMBER() OVER (ORDER BY timestamp DESC, seq DESC) AS position,
+				SUM(size) OVER (ORDER BY timestamp DESC, seq DESC) AS total
+			FROM traffic WHERE `+where+`
+		) WHERE `+strings.Join(outside, " OR ")+`
+	) RETURNING id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply retention: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to apply retention: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/query"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/verify"
+)
+
+// VerifyTraffic counts the recorded traffic matching a verification request, in the
+// backend's whole history if it keeps one
+func (s *Store) VerifyTraffic(req verify.Request) verify.Result {
+	now := time.Now()
+	if s.keepsHistory() {
+		// Narrow the history to the request's service and time window
+		bounds := query.Bounds{Service: req.Service}
+		if req.Since != nil {
+			bounds.Since = *req.Since
+		}
+		if within, err := time.ParseDuration(req.Within); err == nil && now.Add(-within).After(bounds.Since) {
+			bounds.Since = now.Add(-within)
+		}
+		if req.Until != nil {
+			bounds.Until = *req.Until
+		}
+
+		s.FlushTraffic()
+		var entries []models.TrafficEntry
+		if ok, err := s.withHistory(func(history *sqliteBackend) (err error) {
+			entries, err = history.filter(bounds, nil, 0)
+			return err
+		}); ok && err == nil {
+			return verify.Verify(entries, req, now)
+		}
+	}
+
+	s.mu.RLock()
+	entries := make([]models.TrafficEntry, len(s.traffic))
+	copy(entries, s.traffic)
+	s.mu.RUnlock()
+
+	return verify.Verify(entries, req, now)
+}
@@ -4,16 +4,24 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// watcherDebounce is how long a file must be quiet before its change is reported
+// (editors often write a file in several steps)
+const watcherDebounce = 100 * time.Millisecond
+
 // Watcher watches for file changes in a directory
 type Watcher struct {
 	watcher  *fsnotify.Watcher
 	callback func(string)
 	done     chan bool
 	closed   bool
+	timers   map[string]*time.Timer // Pending debounced callbacks per file
+	timersMu sync.Mutex
 }
 
 // NewWatcher creates a new file watcher
@@ -27,6 +35,7 @@ func NewWatcher(dir string, callback func(string)) (*Watcher, error) {
 		watcher:  fsWatcher,
 		callback: callback,
 		done:     make(chan bool),
+		timers:   make(map[string]*time.Timer),
 	}
 
 	// Add directory to watcher
@@ -50,10 +59,10 @@ func (w *Watcher) watch() {
 				return
 			}
 
-			// Only care about write/create events on .yaml files
-			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+			// Any change to a .yaml file (the callback checks whether it still exists)
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
 				if filepath.Ext(event.Name) == ".yaml" {
-					w.callback(event.Name)
+					w.schedule(event.Name)
 				}
 			}
 
@@ -71,6 +80,30 @@ func (w *Watcher) watch() {
 	}
 }
 
+// schedule runs the callback for a file once it has been quiet for watcherDebounce
+func (w *Watcher) schedule(path string) {
+	w.timersMu.Lock()
+	defer w.timersMu.Unlock()
+
+	if timer, ok := w.timers[path]; ok {
+		timer.Reset(watcherDebounce)
+		return
+	}
+
+	w.timers[path] = time.AfterFunc(watcherDebounce, func() {
+		w.timersMu.Lock()
+		delete(w.timers, path)
+		w.timersMu.Unlock()
+
+		select {
+		case <-w.done:
+			// Closed while waiting
+		default:
+			w.callback(path)
+		}
+	})
+}
+
 // Close stops the watcher
 func (w *Watcher) Close() error {
 	if w.closed {
@@ -78,5 +111,13 @@ func (w *Watcher) Close() error {
 	}
 	w.closed = true
 	close(w.done)
+
+	w.timersMu.Lock()
+	for path, timer := range w.timers {
+		timer.Stop()
+		delete(w.timers, path)
+	}
+	w.timersMu.Unlock()
+
 	return w.watcher.Close()
 }
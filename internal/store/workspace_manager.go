@@ -1,7 +1,6 @@
 package store
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -19,8 +18,12 @@ import (
 
 // WorkspaceMetadata stores workspace configuration
 type WorkspaceMetadata struct {
-	BirdIcon string    `json:"bird_icon"`
-	Created  time.Time `json:"created"`
+	BirdIcon  string            `json:"bird_icon"`
+	Created   time.Time         `json:"created"`
+	Parent    string            `json:"parent,omitempty"`     // Workspace to fall back to when no rule matches (defaults to "default")
+	Ephemeral bool              `json:"ephemeral,omitempty"`  // Created for a single test run
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"` // When an ephemeral workspace is purged (nil = teardown only)
+	Retention *models.Retention `json:"retention,omitempty"`  // How much of the workspace's traffic is kept
 }
 
 // Available bird icons (bird01.svg through bird18.svg)
@@ -32,23 +35,82 @@ var birdIcons = []string{
 
 // WorkspaceManager manages per-workspace Store instances with lazy loading
 type WorkspaceManager struct {
-	configDir string
-	config    *config.Config
-	stores    map[string]*Store
-	mu        sync.RWMutex
+	configDir  string
+	config     *config.Config
+	stores     map[string]*Store
+	deleting   map[string]bool // Workspaces being torn down; GetStore refuses them
+	renaming   map[string]bool // Old and new names of workspaces being renamed; GetStore won't load them
+	mu         sync.RWMutex
+	parents    map[string]string // Cached effective parent per workspace ("" for the root)
+	existing   map[string]bool   // Cached workspaceExists answers
+	generation int               // Bumped whenever the caches are dropped
+	warned     map[string]bool   // Workspaces whose broken chain has been reported since the parents were loaded
+	parentsMu  sync.RWMutex
+	done       chan struct{} // Stops the expiry janitor and workspace watcher
+	closeOnce  sync.Once
+	passive    bool // Opened for a CLI command: no background work, and GetStore won't create workspaces
+
+	eventSubscribers map[chan models.ChangeEvent]struct{} // Admin SSE subscribers for change events
+	eventsMu         sync.Mutex
+
+	library *Library // Shared rule sets services include ({configDir}/_library)
 }
 
 // NewWorkspaceManager creates a new workspace manager
 func NewWorkspaceManager(configDir string, cfg *config.Config) (*WorkspaceManager, error) {
+	wm, err := newWorkspaceManager(configDir, cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purge expired ephemeral workspaces now and periodically
+	wm.expireWorkspaces()
+	go wm.runJanitor()
+
+	// Report workspaces created or removed on disk
+	go wm.watchWorkspaces()
+
+	return wm, nil
+}
+
+// NewCLIWorkspaceManager opens the workspaces for a one-off CLI command (lint, test,
+// export, import...). It runs no janitor (nothing is expired, trimmed or purged),
+// watches no files, loads workspaces without writing to them (see newStore), and
+// GetStore fails for a workspace that doesn't exist rather than creating it
+func NewCLIWorkspaceManager(configDir string, cfg *config.Config) (*WorkspaceManager, error) {
+	return newWorkspaceManager(configDir, cfg, true)
+}
+
+// newWorkspaceManager creates a workspace manager and loads the shared library
+func newWorkspaceManager(configDir string, cfg *config.Config, passive bool) (*WorkspaceManager, error) {
 	wm := &WorkspaceManager{
 		configDir: configDir,
 		config:    cfg,
 		stores:    make(map[string]*Store),
+		deleting:  make(map[string]bool),
+		renaming:  make(map[string]bool),
+		parents:   make(map[string]string),
+		existing:  make(map[string]bool),
+		done:      make(chan struct{}),
+		passive:   passive,
+
+		eventSubscribers: make(map[chan models.ChangeEvent]struct{}),
 	}
 
+	library, err := newLibrary(filepath.Join(configDir, "_library"), wm.publish, !passive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rule library: %w", err)
+	}
+	wm.library = library
+
 	return wm, nil
 }
 
+// Library returns the shared rule library
+func (wm *WorkspaceManager) Library() *Library {
+	return wm.library
+}
+
 // GetStore returns the Store for a workspace, loading it if necessary (lazy loading)
 func (wm *WorkspaceManager) GetStore(workspace string) (*Store, error) {
 	// Fast path: check if already loaded
@@ -68,14 +130,28 @@ func (wm *WorkspaceManager) GetStore(workspace string) (*Store, error) {
 		return store, nil
 	}
 
+	// Loading would recreate the directory of a workspace that is being deleted
+	if wm.deleting[workspace] {
+		return nil, fmt.Errorf("workspace %s is being deleted", workspace)
+	}
+	if wm.renaming[workspace] {
+		return nil, fmt.Errorf("workspace %s is being renamed", workspace)
+	}
+	if wm.passive && !wm.workspaceExists(workspace) {
+		return nil, fmt.Errorf("workspace %s not found", workspace)
+	}
+
 	// Load the workspace
 	workspaceDir := filepath.Join(wm.configDir, "workspaces", workspace)
-	store, err := New(workspaceDir, wm.config)
+	store, err := newStore(workspaceDir, wm.config, wm.passive)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load workspace %s: %w", workspace, err)
 	}
+	store.attach(wm.publish, wm.library)
 
 	wm.stores[workspace] = store
+	// Loading may have created the workspace directory
+	wm.invalidateParents()
 	return store, nil
 }
 
@@ -131,12 +207,22 @@ func (wm *WorkspaceManager) GetWorkspaces() ([]models.Workspace, error) {
 		ruleCount := wm.countWorkspaceRules(name)
 		trafficCount := wm.countWorkspaceTraffic(name)
 
+		// Report a broken inheritance chain (missing parent or cycle)
+		chainError := ""
+		if _, err := wm.Chain(name); err != nil {
+			chainError = err.Error()
+		}
+
 		workspaces = append(workspaces, models.Workspace{
 			Name:         name,
 			Created:      metadata.Created,
 			RuleCount:    ruleCount,
 			TrafficCount: trafficCount,
 			BirdIcon:     metadata.BirdIcon,
+			Parent:       effectiveParent(name, metadata.Parent),
+			Ephemeral:    metadata.Ephemeral,
+			ExpiresAt:    metadata.ExpiresAt,
+			ChainError:   chainError,
 		})
 	}
 
@@ -146,7 +232,7 @@ func (wm *WorkspaceManager) GetWorkspaces() ([]models.Workspace, error) {
 // CreateWorkspace creates a new workspace by copying rules from the default workspace
 func (wm *WorkspaceManager) CreateWorkspace(name string) error {
 	// Validate workspace name
-	if err := validateWorkspaceName(name); err != nil {
+	if err := ValidateWorkspaceName(name); err != nil {
 		return err
 	}
 
@@ -179,6 +265,7 @@ func (wm *WorkspaceManager) CreateWorkspace(name string) error {
 	if err := saveWorkspaceMetadata(newWorkspace, &metadata); err != nil {
 		return fmt.Errorf("failed to save workspace metadata: %w", err)
 	}
+	wm.invalidateParents()
 
 	return nil
 }
@@ -196,7 +283,9 @@ func (wm *WorkspaceManager) DisableWorkspace(name string) error {
 	oldPath := filepath.Join(workspacesDir, name)
 	newPath := filepath.Join(workspacesDir, name+".disabled")
 
-	if err := os.Rename(oldPath, newPath); err != nil {
+	err := os.Rename(oldPath, newPath)
+	wm.invalidateParents()
+	if err != nil {
 		return fmt.Errorf("failed to disable workspace: %w", err)
 	}
 
@@ -209,16 +298,21 @@ func (wm *WorkspaceManager) EnableWorkspace(name string) error {
 	oldPath := filepath.Join(workspacesDir, name+".disabled")
 	newPath := filepath.Join(wm.configDir, "workspaces", name)
 
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("workspace %s already exists", name)
+	}
+
 	if err := os.Rename(oldPath, newPath); err != nil {
 		return fmt.Errorf("failed to enable workspace: %w", err)
 	}
+	wm.invalidateParents()
 
 	return nil
 }
 
 // DuplicateWorkspace creates a copy of an existing workspace
 func (wm *WorkspaceManager) DuplicateWorkspace(source, dest string) error {
-	if err := validateWorkspaceName(dest); err != nil {
+	if err := ValidateWorkspaceName(dest); err != nil {
 		return err
 	}
 
@@ -235,6 +329,7 @@ func (wm *WorkspaceManager) DuplicateWorkspace(source, dest string) error {
 	if err := os.MkdirAll(destPath, 0755); err != nil {
 		return fmt.Errorf("failed to create workspace: %w", err)
 	}
+	defer wm.invalidateParents()
 
 	// Copy rules
 	srcRules := filepath.Join(srcPath, "_rules")
@@ -243,10 +338,11 @@ func (wm *WorkspaceManager) DuplicateWorkspace(source, dest string) error {
 		return fmt.Errorf("failed to copy rules: %w", err)
 	}
 
-	// Copy traffic if it exists
-	srcTraffic := filepath.Join(srcPath, "traffic.ndjson")
-	destTraffic := filepath.Join(destPath, "traffic.ndjson")
-	copyFile(srcTraffic, destTraffic) // Ignore errors if traffic doesn't exist
+	// Copy traffic if it exists (as traffic.ndjson, which a sqlite backend imports on open)
+	wm.flushTraffic(source)
+	if data, err := readTrafficNDJSON(srcPath, wm.config); err == nil {
+		os.WriteFile(filepath.Join(destPath, trafficNDJSONFile), data, 0644) // Ignore errors, traffic is optional
+	}
 
 	// Copy metadata if it exists, otherwise create new one with random bird icon
 	srcMetadata := filepath.Join(srcPath, "metadata.json")
@@ -266,6 +362,12 @@ func (wm *WorkspaceManager) DuplicateWorkspace(source, dest string) error {
 
 // Close closes all loaded workspace stores
 func (wm *WorkspaceManager) Close() error {
+	wm.closeOnce.Do(func() {
+		close(wm.done)
+		wm.library.Close()
+		wm.closeEventSubscribers()
+	})
+
 	wm.mu.Lock()
 	defer wm.mu.Unlock()
 
@@ -282,10 +384,14 @@ func (wm *WorkspaceManager) Close() error {
 
 // Helper functions
 
-func validateWorkspaceName(name string) error {
+// ValidateWorkspaceName checks that a workspace name is safe to use as a directory name
+func ValidateWorkspaceName(name string) error {
 	if name == "" {
 		return fmt.Errorf("workspace name cannot be empty")
 	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("workspace name cannot be %s", name)
+	}
 	if strings.Contains(name, ".disabled") {
 		return fmt.Errorf("workspace name cannot contain .disabled")
 	}
@@ -304,7 +410,7 @@ func (wm *WorkspaceManager) countWorkspaceRules(workspace string) int {
 
 	count := 0
 	for _, file := range files {
-		if strings.HasSuffix(file, ".disabled") {
+		if strings.HasSuffix(file, ".disabled") || !isRulesFile(file) {
 			continue
 		}
 
@@ -326,20 +432,19 @@ func (wm *WorkspaceManager) countWorkspaceRules(workspace string) int {
 }
 
 func (wm *WorkspaceManager) countWorkspaceTraffic(workspace string) int {
-	trafficPath := filepath.Join(wm.configDir, "workspaces", workspace, "traffic.ndjson")
-	file, err := os.Open(trafficPath)
-	if err != nil {
-		return 0
-	}
-	defer file.Close()
+	wm.flushTraffic(workspace)
+	return countTraffic(filepath.Join(wm.configDir, "workspaces", workspace), wm.config)
+}
 
-	count := 0
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		count++
-	}
+// flushTraffic writes a loaded workspace's queued traffic, so its files are up to date
+func (wm *WorkspaceManager) flushTraffic(workspace string) {
+	wm.mu.RLock()
+	st := wm.stores[workspace]
+	wm.mu.RUnlock()
 
-	return count
+	if st != nil {
+		st.FlushTraffic()
+	}
 }
 
 func copyRules(src, dest string) error {
@@ -379,7 +484,7 @@ func saveWorkspaceMetadata(workspaceDir string, metadata *WorkspaceMetadata) err
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
 	}
-	return os.WriteFile(metadataPath, data, 0644)
+	return writeFileAtomic(metadataPath, data, 0644)
 }
 
 // loadWorkspaceMetadata loads workspace metadata from metadata.json
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/config"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestCLIWorkspaceManager(t *testing.T) {
+	wm := newTestWorkspaceManager(t, map[string]string{
+		"default": "rules:\n  - match: {path: /servicex/users}\n    response: \"[200]\"\n    examples:\n      - path: /servicex/users\n",
+	})
+	_, expired, err := wm.CreateEphemeralWorkspace(EphemeralOptions{TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredDir := filepath.Join(wm.configDir, "workspaces", expired)
+	metadata := loadWorkspaceMetadata(expiredDir)
+	past := time.Now().Add(-time.Minute)
+	metadata.ExpiresAt = &past
+	if err := saveWorkspaceMetadata(expiredDir, &metadata); err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := NewCLIWorkspaceManager(wm.configDir, &config.Config{ConfigDir: wm.configDir, MaxTrafficEntries: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	// Nothing is purged by a CLI command
+	if !cli.workspaceExists(expired) {
+		t.Errorf("expired workspace %s was purged", expired)
+	}
+
+	// A typo in the workspace name is an error, not a new empty workspace
+	if _, err := cli.GetStore("missing"); err == nil {
+		t.Errorf("expected an error for a missing workspace")
+	}
+	if cli.workspaceExists("missing") {
+		t.Errorf("GetStore() created the missing workspace")
+	}
+
+	st, err := cli.GetStore("default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := st.TestAll()["servicex"]
+	if len(results) != 1 || !results[0].Passed {
+		t.Errorf("TestAll() = %+v", results)
+	}
+}
+
+func TestCLIWorkspaceManagerWritesNothing(t *testing.T) {
+	old := make([]models.TrafficEntry, 5)
+	for i := range old {
+		old[i] = models.TrafficEntry{ID: fmt.Sprintf("req-%d", i), Timestamp: time.Now().Add(-48 * time.Hour), Service: "servicex"}
+	}
+
+	// snapshot records every file's content and modification time
+	snapshot := func(dir string) map[string]string {
+		files := make(map[string]string)
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files[path] = fmt.Sprintf("%s %x", info.ModTime(), data)
+			return nil
+		})
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		storage string
+		setup   func(dir string) error
+	}{
+		{"ndjson over the entry limit", config.TrafficStorageNDJSON, func(dir string) error {
+			backend := &ndjsonBackend{path: filepath.Join(dir, trafficNDJSONFile)}
+			defer backend.Close()
+			return backend.Append(old)
+		}},
+		{"ndjson awaiting migration to sqlite", config.TrafficStorageSQLite, func(dir string) error {
+			backend := &ndjsonBackend{path: filepath.Join(dir, trafficNDJSONFile)}
+			defer backend.Close()
+			return backend.Append(old)
+		}},
+		{"sqlite outside retention", config.TrafficStorageSQLite, func(dir string) error {
+			backend, err := openSQLiteBackend(dir)
+			if err != nil {
+				return err
+			}
+			defer backend.Close()
+			return backend.Append(old)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rules without IDs, no history yet, and traffic older than the retention policy
+			wm := newTestWorkspaceManager(t, map[string]string{"default": "", "team": ""})
+			wm.Close()
+			teamDir := filepath.Join(wm.configDir, "workspaces", "team")
+			rules := "rules:\n  - match: {path: /servicex/users}\n    response: \"[200]\"\n"
+			if err := os.WriteFile(filepath.Join(teamDir, "_rules", "servicex.yaml"), []byte(rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := saveWorkspaceMetadata(teamDir, &WorkspaceMetadata{Retention: &models.Retention{MaxAge: "24h"}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.setup(teamDir); err != nil {
+				t.Fatal(err)
+			}
+			before := snapshot(wm.configDir)
+
+			cfg := &config.Config{ConfigDir: wm.configDir, MaxTrafficEntries: 3, TrafficStorage: tt.storage}
+			cli, err := NewCLIWorkspaceManager(wm.configDir, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			st, err := cli.GetStore("team")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(st.GetRules("servicex")) != 1 || len(st.GetTraffic(100, "")) != 3 {
+				t.Errorf("loaded %d rules and %d traffic entries", len(st.GetRules("servicex")), len(st.GetTraffic(100, "")))
+			}
+			st.TestAll()
+			if err := cli.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if after := snapshot(wm.configDir); !reflect.DeepEqual(before, after) {
+				for path := range after {
+					if before[path] != after[path] {
+						t.Errorf("%s was written", path)
+					}
+				}
+				for path := range before {
+					if _, ok := after[path]; !ok {
+						t.Errorf("%s was removed", path)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Package verify checks recorded traffic against expected request counts,
+// for assertions in integration tests
+package verify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/matcher"
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+// maxClosest is how many near misses are reported when verification fails
+const maxClosest = 5
+
+// Request describes the traffic to count and how many requests are expected
+// With no count, at_least or at_most, at least one request is expected
+type Request struct {
+	Match   models.MatchCondition `json:"match"`              // Same shape as a rule's match
+	Service string                `json:"service,omitempty"`  // Only count this service's traffic
+	Session string                `json:"session,omitempty"`  // Only count traffic tagged with this X-Mockingbird-Session
+	Since   *time.Time            `json:"since,omitempty"`    // Only count traffic at or after this time
+	Until   *time.Time            `json:"until,omitempty"`    // Only count traffic before this time
+	Within  string                `json:"within,omitempty"`   // Only count traffic from the last duration, e.g. "30s"
+	Count   *int                  `json:"count,omitempty"`    // Exactly this many requests
+	AtLeast *int                  `json:"at_least,omitempty"` // At least this many requests
+	AtMost  *int                  `json:"at_most,omitempty"`  // At most this many requests
+}
+
+// NearMiss is a request that failed some of the match conditions
+type NearMiss struct {
+	ID         string    `json:"id"`
+	Timestamp  time.Time `json:"timestamp"`
+	Service    string    `json:"service"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Mismatches []string  `json:"mismatches"` // Conditions it failed ("method", "path", "header <name>", "body", "query <name>")
+}
+
+// Result is the outcome of a verification
+type Result struct {
+	Passed   bool       `json:"passed"`
+	Count    int        `json:"count"`             // Requests that matched
+	Expected string     `json:"expected"`          // e.g. "exactly 2", "at least 1", "between 1 and 3"
+	Matches  []string   `json:"matches"`           // IDs of the matching requests, oldest first
+	Closest  []NearMiss `json:"closest,omitempty"` // Closest non-matching requests (when verification fails)
+}
+
+// Validate checks a request's counts and time window
+func (req *Request) Validate() error {
+	if (req.Count != nil && *req.Count < 0) || (req.AtLeast != nil && *req.AtLeast < 0) || (req.AtMost != nil && *req.AtMost < 0) {
+		return fmt.Errorf("counts must not be negative")
+	}
+	if req.Count != nil && (req.AtLeast != nil || req.AtMost != nil) {
+		return fmt.Errorf("count can't be combined with at_least or at_most")
+	}
+	if req.Within != "" {
+		if _, err := time.ParseDuration(req.Within); err != nil {
+			return fmt.Errorf("invalid within: %w", err)
+		}
+	}
+	return nil
+}
+
+// Verify counts the entries matching a request and checks the count
+// Entries may be in any order
+func Verify(entries []models.TrafficEntry, req Request, now time.Time) Result {
+	since := req.Since
+	if req.Within != "" {
+		if within, err := time.ParseDuration(req.Within); err == nil {
+			start := now.Add(-within)
+			if since == nil || start.After(*since) {
+				since = &start
+			}
+		}
+	}
+
+	var matched []models.TrafficEntry
+	var misses []NearMiss
+	for _, entry := range entries {
+		if req.Service != "" && entry.Service != req.Service {
+			continue
+		}
+		if req.Session != "" && entry.Session != req.Session {
+			continue
+		}
+		if since != nil && entry.Timestamp.Before(*since) {
+			continue
+		}
+		if req.Until != nil && !entry.Timestamp.Before(*req.Until) {
+			continue
+		}
+
+		mismatches := matcher.Mismatches(&req.Match, requestContext(entry))
+		if len(mismatches) == 0 {
+			matched = append(matched, entry)
+			continue
+		}
+		misses = append(misses, NearMiss{
+			ID:         entry.ID,
+			Timestamp:  entry.Timestamp,
+			Service:    entry.Service,
+			Method:     entry.Method,
+			Path:       entry.Path,
+			Mismatches: mismatches,
+		})
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Timestamp.Before(matched[j].Timestamp)
+	})
+	result := Result{Count: len(matched), Matches: make([]string, len(matched))}
+	for i, entry := range matched {
+		result.Matches[i] = entry.ID
+	}
+
+	result.Passed, result.Expected = check(req, len(matched))
+	if !result.Passed {
+		// Fewest failed conditions first, then most recent
+		sort.SliceStable(misses, func(i, j int) bool {
+			if len(misses[i].Mismatches) != len(misses[j].Mismatches) {
+				return len(misses[i].Mismatches) < len(misses[j].Mismatches)
+			}
+			return misses[i].Timestamp.After(misses[j].Timestamp)
+		})
+		if len(misses) > maxClosest {
+			misses = misses[:maxClosest]
+		}
+		result.Closest = misses
+	}
+
+	return result
+}
+
+// check compares a count with the expected count and describes the expectation
+func check(req Request, count int) (bool, string) {
+	switch {
+	case req.Count != nil:
+		return count == *req.Count, fmt.Sprintf("exactly %d", *req.Count)
+	case req.AtLeast != nil && req.AtMost != nil:
+		return count >= *req.AtLeast && count <= *req.AtMost, fmt.Sprintf("between %d and %d", *req.AtLeast, *req.AtMost)
+	case req.AtMost != nil:
+		return count <= *req.AtMost, fmt.Sprintf("at most %d", *req.AtMost)
+	case req.AtLeast != nil:
+		return count >= *req.AtLeast, fmt.Sprintf("at least %d", *req.AtLeast)
+	}
+	return count >= 1, "at least 1"
+}
+
+// requestContext rebuilds the matcher's view of a recorded request
+func requestContext(entry models.TrafficEntry) *models.RequestContext {
+	return &models.RequestContext{
+		Method:       entry.Method,
+		Path:         entry.Path,
+		PathSegments: strings.Split(strings.Trim(entry.Path, "/"), "/"),
+		QueryParams:  entry.QueryParams,
+		Headers:      entry.Headers,
+		Body:         entry.Body,
+	}
+}
@@ -0,0 +1,107 @@
+package verify
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/theproductiveprogrammer/mockingbird.git/internal/models"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(id, method, path, session string, ago time.Duration, body interface{}) models.TrafficEntry {
+		return models.TrafficEntry{
+			ID:        id,
+			Timestamp: now.Add(-ago),
+			Service:   "servicex",
+			Session:   session,
+			Method:    method,
+			Path:      path,
+			Headers:   map[string][]string{"Content-Type": {"application/json"}},
+			Body:      body,
+		}
+	}
+	entries := []models.TrafficEntry{
+		entry("a", "POST", "/servicex/users", "run1", 5*time.Minute, map[string]interface{}{"name": "Ann"}),
+		entry("b", "POST", "/servicex/users", "run2", 10*time.Second, map[string]interface{}{"name": "Bob"}),
+		entry("c", "GET", "/servicex/users", "run2", 20*time.Second, nil),
+		entry("d", "POST", "/servicex/orders", "run2", 30*time.Second, nil),
+	}
+	createUser := models.MatchCondition{Method: []string{"POST"}, Path: "/servicex/users"}
+	n := func(i int) *int { return &i }
+
+	tests := []struct {
+		name     string
+		req      Request
+		passed   bool
+		expected string
+		matches  []string
+		closest  []string
+	}{
+		{"default expects at least one", Request{Match: createUser}, true, "at least 1", []string{"a", "b"}, nil},
+		{"exact count", Request{Match: createUser, Count: n(2)}, true, "exactly 2", []string{"a", "b"}, nil},
+		{"exact count fails", Request{Match: createUser, Count: n(1)}, false, "exactly 1", []string{"a", "b"}, []string{"c", "d"}},
+		{"at most", Request{Match: createUser, AtMost: n(1)}, false, "at most 1", []string{"a", "b"}, []string{"c", "d"}},
+		{"between", Request{Match: createUser, AtLeast: n(1), AtMost: n(3)}, true, "between 1 and 3", []string{"a", "b"}, nil},
+		{"session", Request{Match: createUser, Session: "run2", Count: n(1)}, true, "exactly 1", []string{"b"}, nil},
+		{"within", Request{Match: createUser, Within: "1m", Count: n(1)}, true, "exactly 1", []string{"b"}, nil},
+		{"until", Request{Match: createUser, Until: timePtr(now.Add(-time.Minute)), Count: n(1)}, true, "exactly 1", []string{"a"}, nil},
+		{
+			"body condition",
+			Request{Match: models.MatchCondition{Method: []string{"POST"}, Path: "/servicex/users", Body: &models.BodyMatch{Matches: `"name":\s*"Cy"`}}},
+			false, "at least 1", []string{}, []string{"b", "a", "c", "d"},
+		},
+		{"other service", Request{Match: createUser, Service: "servicey", AtMost: n(0)}, true, "at most 0", []string{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Verify(entries, tt.req, now)
+			if result.Passed != tt.passed || result.Expected != tt.expected || result.Count != len(tt.matches) {
+				t.Errorf("Verify() = passed %v, %q, count %d; expected %v, %q, %d",
+					result.Passed, result.Expected, result.Count, tt.passed, tt.expected, len(tt.matches))
+			}
+			if !reflect.DeepEqual(result.Matches, tt.matches) {
+				t.Errorf("matches = %v, expected %v", result.Matches, tt.matches)
+			}
+			var closest []string
+			for _, miss := range result.Closest {
+				closest = append(closest, miss.ID)
+			}
+			if !reflect.DeepEqual(closest, tt.closest) {
+				t.Errorf("closest = %v, expected %v", closest, tt.closest)
+			}
+		})
+	}
+
+	// Near misses report which conditions failed
+	result := Verify(entries, Request{Match: createUser, Count: n(0)}, now)
+	if got := result.Closest[1].Mismatches; !reflect.DeepEqual(got, []string{"path"}) {
+		t.Errorf("mismatches for d = %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	n := func(i int) *int { return &i }
+	tests := []struct {
+		name  string
+		req   Request
+		valid bool
+	}{
+		{"empty", Request{}, true},
+		{"range", Request{AtLeast: n(1), AtMost: n(2)}, true},
+		{"count with range", Request{Count: n(1), AtLeast: n(1)}, false},
+		{"negative", Request{AtMost: n(-1)}, false},
+		{"bad within", Request{Within: "soon"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.req.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
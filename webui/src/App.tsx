@@ -12,6 +12,7 @@ import { PluginsView } from './components/plugins/PluginsView';
 import { WorkspaceSplash } from './components/workspaces/WorkspaceSplash';
 import { useAppStore } from './stores/appStore';
 import { useTrafficSSE } from './hooks/useTrafficSSE';
+import { useRuleEvents } from './hooks/useRuleEvents';
 import { api } from './utils/api';
 
 // Workspace UI wrapper - contains Header, FilterBar, and all workspace-specific views
@@ -40,6 +41,9 @@ function WorkspaceUI() {
   // Connect to SSE stream
   useTrafficSSE();
 
+  // Refetch rules when they change elsewhere
+  useRuleEvents();
+
   // Load config on app startup
   useEffect(() => {
     api.getConfig().then(setConfig).catch(console.error);
@@ -1,6 +1,6 @@
 import { useEffect, useState } from 'react';
 import { useAppStore } from '../../stores/appStore';
-import { api } from '../../utils/api';
+import { api, ConflictError } from '../../utils/api';
 import { Tag } from '../ui/Tag';
 import { Button } from '../ui/Button';
 import { RuleEditor } from './RuleEditor';
@@ -12,13 +12,17 @@ import toast from 'react-hot-toast';
 export function RulesView() {
   const { serviceRules, setServiceRules, highlightedRule, setHighlightedRule } = useAppStore();
   const [expandedServices, setExpandedServices] = useState<Set<string>>(new Set());
+  // The service's ETag is kept from when the dialog opened so a save is rejected
+  // (412) if the rules changed in the meantime
   const [editingRule, setEditingRule] = useState<{
     service: string;
     rule: RuleWithIndex;
+    etag?: string;
   } | null>(null);
   const [deletingRule, setDeletingRule] = useState<{
     service: string;
     rule: RuleWithIndex;
+    etag?: string;
   } | null>(null);
   const [deletingService, setDeletingService] = useState<string | null>(null);
   const [creatingRuleForService, setCreatingRuleForService] = useState<string | null>(null);
@@ -56,11 +60,24 @@ export function RulesView() {
     }
   }, [highlightedRule, setHighlightedRule]);
 
+  const etagFor = (service: string) => serviceRules[service]?.etag;
+
+  // Explains a 412 conflict (the service's rules changed since they were loaded, e.g. in
+  // another tab or by editing the file) and reloads them; returns null for other errors
+  const reloadOnConflict = async (error: unknown, service: string) => {
+    if (!(error instanceof ConflictError)) return null;
+
+    const newRules = await api.getAllRules();
+    setServiceRules(newRules);
+    toast.error(`${service}.yaml was changed elsewhere, the latest rules have been reloaded`);
+    return newRules;
+  };
+
   const handleSaveRule = async (updatedRule: Rule) => {
     if (!editingRule) return;
 
     try {
-      await api.updateRule(editingRule.service, editingRule.rule.index, updatedRule);
+      await api.updateRule(editingRule.service, editingRule.rule.index, updatedRule, editingRule.etag);
       toast.success('Rule updated successfully');
 
       // Refresh rules
@@ -68,6 +85,12 @@ export function RulesView() {
       setServiceRules(newRules);
       setEditingRule(null);
     } catch (error) {
+      const newRules = await reloadOnConflict(error, editingRule.service);
+      if (newRules) {
+        // Keep the editor open so the change isn't lost; saving again overwrites the newer rules
+        setEditingRule({ ...editingRule, etag: newRules[editingRule.service]?.etag });
+        return;
+      }
       toast.error('Failed to update rule');
       console.error(error);
     }
@@ -77,7 +100,7 @@ export function RulesView() {
     if (!creatingRuleForService) return;
 
     try {
-      await api.createRule(creatingRuleForService, newRule);
+      await api.createRule(creatingRuleForService, newRule, etagFor(creatingRuleForService));
       toast.success('Rule created successfully');
 
       // Refresh rules
@@ -85,6 +108,7 @@ export function RulesView() {
       setServiceRules(newRules);
       setCreatingRuleForService(null);
     } catch (error) {
+      if (await reloadOnConflict(error, creatingRuleForService)) return;
       toast.error('Failed to create rule');
       console.error(error);
     }
@@ -92,13 +116,14 @@ export function RulesView() {
 
   const handleMoveRule = async (service: string, index: number, direction: 'up' | 'down') => {
     try {
-      await api.moveRule(service, index, direction);
+      await api.moveRule(service, index, direction, etagFor(service));
       toast.success('Rule moved successfully');
 
       // Refresh rules
       const newRules = await api.getAllRules();
       setServiceRules(newRules);
     } catch (error) {
+      if (await reloadOnConflict(error, service)) return;
       toast.error('Failed to move rule');
       console.error(error);
     }
@@ -108,7 +133,7 @@ export function RulesView() {
     if (!deletingRule) return;
 
     try {
-      await api.deleteRule(deletingRule.service, deletingRule.rule.index);
+      await api.deleteRule(deletingRule.service, deletingRule.rule.index, deletingRule.etag);
       toast.success('Rule deleted successfully');
 
       // Refresh rules
@@ -116,6 +141,10 @@ export function RulesView() {
       setServiceRules(newRules);
       setDeletingRule(null);
     } catch (error) {
+      if (await reloadOnConflict(error, deletingRule.service)) {
+        setDeletingRule(null);
+        return;
+      }
       toast.error('Failed to delete rule');
       console.error(error);
     }
@@ -125,7 +154,7 @@ export function RulesView() {
     if (!deletingService) return;
 
     try {
-      await api.deleteService(deletingService);
+      await api.deleteService(deletingService, etagFor(deletingService));
       toast.success('Service deleted successfully');
 
       // Refresh rules
@@ -133,6 +162,10 @@ export function RulesView() {
       setServiceRules(newRules);
       setDeletingService(null);
     } catch (error) {
+      if (await reloadOnConflict(error, deletingService)) {
+        setDeletingService(null);
+        return;
+      }
       toast.error('Failed to delete service');
       console.error(error);
     }
@@ -148,13 +181,14 @@ export function RulesView() {
       const { index, ...ruleWithoutIndex } = rule;
       const updatedRule = { ...ruleWithoutIndex, enabled: newEnabled };
 
-      await api.updateRule(service, rule.index, updatedRule);
+      await api.updateRule(service, rule.index, updatedRule, etagFor(service));
       toast.success(newEnabled ? 'Rule enabled' : 'Rule disabled');
 
       // Refresh rules
       const newRules = await api.getAllRules();
       setServiceRules(newRules);
     } catch (error) {
+      if (await reloadOnConflict(error, service)) return;
       toast.error('Failed to toggle rule');
       console.error(error);
     }
@@ -267,6 +301,11 @@ export function RulesView() {
                     <span className="text-gray-800 font-medium">{serviceName}.yaml</span>
                     <span className="text-gray-500">·</span>
                     <span className="text-gray-600">{service.rules.length} rules</span>
+                    {service.load_error && (
+                      <span className="text-red-600 truncate" title={service.load_error}>
+                        · failed to load, using last good rules: {service.load_error}
+                      </span>
+                    )}
                   </button>
                   <div className="flex gap-1">
                     <Button
@@ -355,7 +394,7 @@ export function RulesView() {
                             className={`flex items-center gap-2 flex-1 cursor-pointer ${
                               !isEnabled ? 'opacity-50 line-through' : ''
                             }`}
-                            onClick={() => setEditingRule({ service: serviceName, rule })}
+                            onClick={() => setEditingRule({ service: serviceName, rule, etag: service.etag })}
                           >
                             {/* Rule # and Path */}
                             <span className="text-gray-500">Rule #{rule.index + 1}</span>
@@ -403,7 +442,7 @@ export function RulesView() {
                               className="text-xs px-2 py-0"
                               onClick={(e) => {
                                 e.stopPropagation();
-                                setEditingRule({ service: serviceName, rule });
+                                setEditingRule({ service: serviceName, rule, etag: service.etag });
                               }}
                             >
                               edit
@@ -414,7 +453,7 @@ export function RulesView() {
                               className="text-xs px-2 py-0 text-red-600 hover:text-red-800"
                               onClick={(e) => {
                                 e.stopPropagation();
-                                setDeletingRule({ service: serviceName, rule });
+                                setDeletingRule({ service: serviceName, rule, etag: service.etag });
                               }}
                             >
                               delete
@@ -344,8 +344,13 @@ ${responseBodyStr}`;
     toast.success('Copied cURL command to clipboard!');
   };
 
+  // Rules included from a shared library aren't in the service's rule list
+  const matchedLibrary = entry?.current_matched_rule_origin?.startsWith('library:')
+    ? entry.current_matched_rule_origin.slice('library:'.length)
+    : undefined;
+
   const handleGoToRule = () => {
-    if (!entry || entry.current_matched_rule === undefined) return;
+    if (!entry || entry.current_matched_rule === undefined || matchedLibrary) return;
 
     // Use the workspace where the rule actually matched
     const ruleWorkspace = entry.current_matched_workspace || workspace;
@@ -377,6 +382,7 @@ ${responseBodyStr}`;
                 title="Go to rule"
               >
                 Currently matches: Rule #{entry.current_matched_rule + 1}
+                {matchedLibrary && <span className="text-gray-500"> of library {matchedLibrary}</span>}
                 {entry.current_matched_workspace && entry.current_matched_workspace !== workspace && (
                   <span className="text-gray-500"> (from {entry.current_matched_workspace})</span>
                 )}
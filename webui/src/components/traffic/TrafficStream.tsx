@@ -2,6 +2,19 @@ import { useEffect, useRef, useState } from "react";
 import { useAppStore } from "../../stores/appStore";
 import { api } from "../../utils/api";
 import { TrafficEntry } from "./TrafficEntry";
+import { TrafficEntry as TrafficEntryData } from "../../types/api";
+
+// Filters written in the server's query language (e.g. status:5xx, $.user.id:42, since:1h)
+// are searched on the server across the whole history; other filters apply in the browser
+const QUERY_TERM =
+  /^-?(method|path|status|type|rule|service|session|body|since|until|header\.[^:\s]+|\$[^:\s]*):/;
+
+interface SearchResults {
+  query: string;
+  entries: TrafficEntryData[];
+  nextCursor: string;
+  error: string | null;
+}
 
 export function TrafficStream() {
   const {
@@ -21,6 +34,46 @@ export function TrafficStream() {
   const scrollContainerRef = useRef<HTMLDivElement>(null);
   const [isNearTop, setIsNearTop] = useState(true);
   const previousTrafficLength = useRef(traffic.length);
+  const [search, setSearch] = useState<SearchResults | null>(null);
+
+  const searchQuery = filters.filter((f) => QUERY_TERM.test(f)).join(" ");
+  const clientFilters = filters.filter((f) => !QUERY_TERM.test(f));
+
+  // Run server-side searches when the query terms change
+  useEffect(() => {
+    if (!searchQuery) {
+      setSearch(null);
+      return;
+    }
+
+    let cancelled = false;
+    api
+      .searchTraffic(searchQuery)
+      .then((page) => {
+        if (!cancelled) setSearch({ query: searchQuery, ...page, error: null });
+      })
+      .catch((error: Error) => {
+        if (!cancelled) setSearch({ query: searchQuery, entries: [], nextCursor: "", error: error.message });
+      });
+    return () => {
+      cancelled = true;
+    };
+  }, [searchQuery]);
+
+  // Fetch the next page of search results using the cursor from the last page
+  const loadMoreSearch = async () => {
+    if (!search?.nextCursor) return;
+    try {
+      const page = await api.searchTraffic(search.query, search.nextCursor);
+      setSearch((current) =>
+        current && current.query === search.query
+          ? { ...current, entries: [...current.entries, ...page.entries], nextCursor: page.nextCursor }
+          : current,
+      );
+    } catch (error) {
+      setSearch((current) => current && { ...current, error: (error as Error).message });
+    }
+  };
 
   // Load initial traffic on mount
   useEffect(() => {
@@ -68,8 +121,11 @@ export function TrafficStream() {
   // Convert clear timestamp to Date for proper comparison (handles timezone differences)
   const clearDate = clearedBeforeTimestamp ? new Date(clearedBeforeTimestamp).getTime() : null;
 
+  // Search results replace the live list while query terms are set
+  const source = search ? search.entries : traffic;
+
   // Filter traffic: by clear timestamp, selected services, then by text filters
-  const filteredTraffic = traffic.filter((entry) => {
+  const filteredTraffic = source.filter((entry) => {
     // First check: is it after the clear timestamp?
     if (clearDate && new Date(entry.timestamp).getTime() <= clearDate) {
       return false; // Entry is at or before the clear marker, hide it
@@ -81,10 +137,10 @@ export function TrafficStream() {
     }
 
     // Third check: apply text filters
-    if (filters.length === 0) return true;
+    if (clientFilters.length === 0) return true;
 
     // Entry must match ALL filters (AND logic)
-    return filters.every((filter) => {
+    return clientFilters.every((filter) => {
       // Parse filter type
       let isNegative = false;
       let actualFilter = filter;
@@ -196,7 +252,8 @@ export function TrafficStream() {
     filteredTraffic.length,
   );
 
-  const hasMore = traffic.length < totalAvailable;
+  const hasMore = search ? search.nextCursor !== "" : traffic.length < totalAvailable;
+  const loadMore = search ? loadMoreSearch : loadMoreTraffic;
 
   // Helper function to check if we should show a time divider
   const shouldShowTimeDivider = (
@@ -237,6 +294,13 @@ export function TrafficStream() {
       )}
 
       <div ref={scrollContainerRef} className="h-full overflow-y-auto">
+        {search && (
+          <div className={`px-4 py-2 text-xs border-b border-gray-200 ${search.error ? "text-red-600" : "text-gray-500"}`}>
+            {search.error
+              ? `Search failed: ${search.error}`
+              : `Searching all traffic for ${search.query} (live updates paused)`}
+          </div>
+        )}
         {filteredTraffic.length === 0 ? (
           <div className="flex flex-col items-center justify-center h-full text-gray-600">
             <div className="text-center">
@@ -275,10 +339,12 @@ export function TrafficStream() {
                   />
                 )}
                 <button
-                  onClick={loadMoreTraffic}
+                  onClick={loadMore}
                   className="px-4 py-2 text-sm text-gray-700 bg-gray-100 hover:bg-gray-200 rounded-md font-medium transition-colors"
                 >
-                  Load 100 More (showing {traffic.length} of {totalAvailable})
+                  {search
+                    ? `Load 100 More (searched ${search.entries.length} matches so far)`
+                    : `Load 100 More (showing ${traffic.length} of ${totalAvailable})`}
                 </button>
               </div>
             )}
@@ -321,17 +387,18 @@ export function TrafficStream() {
                   />
                 )}
                 <button
-                  onClick={loadMoreTraffic}
+                  onClick={loadMore}
                   className="text-sm text-gray-600 hover:text-gray-900 font-medium"
                 >
-                  Showing {filteredTraffic.length} of {totalAvailable} • Load
-                  100 More
+                  {search
+                    ? `Showing ${filteredTraffic.length} matches • Load 100 More`
+                    : `Showing ${filteredTraffic.length} of ${totalAvailable} • Load 100 More`}
                 </button>
               </div>
             )}
 
             {/* Show count even when no more to load */}
-            {!hasMore && totalAvailable > 0 && (
+            {!hasMore && (search ? search.entries.length > 0 : totalAvailable > 0) && (
               <div className="flex items-center justify-center gap-2 py-4 border-t border-gray-200 text-sm text-gray-500">
                 {workspaceBirdIcon && (
                   <img
@@ -340,7 +407,9 @@ export function TrafficStream() {
                     className="w-5 h-5"
                   />
                 )}
-                Showing {filteredTraffic.length} of {totalAvailable} messages
+                {search
+                  ? `Showing ${filteredTraffic.length} matches`
+                  : `Showing ${filteredTraffic.length} of ${totalAvailable} messages`}
               </div>
             )}
           </>
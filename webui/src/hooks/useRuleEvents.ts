@@ -0,0 +1,65 @@
+import { useEffect } from 'react';
+import toast from 'react-hot-toast';
+import { useAppStore } from '../stores/appStore';
+import { api } from '../utils/api';
+import { ChangeEvent } from '../types/api';
+
+// Rule events that mean the rules shown may be out of date
+const RULE_EVENTS: ChangeEvent['type'][] = ['rules.changed', 'rules.removed', 'rules.error'];
+
+// useRuleEvents keeps the rules in sync with changes made elsewhere (another tab,
+// the API or editing the files) and reports rule files that fail to load
+export function useRuleEvents() {
+  // Reconnect when switching workspace, as the stream is per workspace
+  const { workspace, setServiceRules } = useAppStore();
+
+  useEffect(() => {
+    let eventSource: EventSource | null = null;
+    let reconnectTimeout: ReturnType<typeof setTimeout> | null = null;
+    let refetchTimeout: ReturnType<typeof setTimeout> | null = null;
+
+    // Coalesce bursts of events (e.g. saving several files) into one refetch
+    const refetch = () => {
+      if (refetchTimeout) clearTimeout(refetchTimeout);
+      refetchTimeout = setTimeout(() => {
+        api.getAllRules().then(setServiceRules).catch(console.error);
+      }, 200);
+    };
+
+    const handleEvent = (message: MessageEvent) => {
+      try {
+        const event: ChangeEvent = JSON.parse(message.data);
+        if (event.type === 'rules.error') {
+          const file = event.library ? `library ${event.library}` : `${event.service}.yaml`;
+          toast.error(`Failed to load ${file}: ${event.error}`);
+        }
+        refetch();
+      } catch (error) {
+        console.error('Failed to parse change event:', error);
+      }
+    };
+
+    const connect = () => {
+      eventSource = new EventSource(api.getEventStreamUrl());
+      RULE_EVENTS.forEach((type) => eventSource?.addEventListener(type, handleEvent));
+
+      eventSource.onerror = () => {
+        eventSource?.close();
+
+        // Reconnect after 2 seconds, refetching in case events were missed
+        reconnectTimeout = setTimeout(() => {
+          connect();
+          refetch();
+        }, 2000);
+      };
+    };
+
+    connect();
+
+    return () => {
+      if (reconnectTimeout) clearTimeout(reconnectTimeout);
+      if (refetchTimeout) clearTimeout(refetchTimeout);
+      eventSource?.close();
+    };
+  }, [workspace, setServiceRules]);
+}
@@ -10,8 +10,12 @@ export interface TrafficEntry {
   body: any;
   response?: MockResponse;
   matched_rule?: number; // Historical matched rule (may be stale)
+  matched_rule_id?: string; // Stable ID of the matched rule
+  matched_rule_origin?: string; // "service" or "library:<name>" (the index is within that file)
   matched_workspace?: string; // Workspace where rule matched (may differ from request workspace)
   current_matched_rule?: number; // Current match with active rules
+  current_matched_rule_id?: string; // Stable ID of the current match
+  current_matched_rule_origin?: string; // Origin of the current match
   current_matched_workspace?: string; // Current match workspace
   rule_type: "mock" | "proxy" | "timeout";
 }
@@ -24,11 +28,13 @@ export interface MockResponse {
 }
 
 export interface Rule {
+  id?: string;
   match: MatchCondition;
   proxyto?: string;
   headers?: Record<string, string>;
   response?: string;
   enabled?: boolean;
+  tags?: string[]; // Profiles enable or disable rules by tag
 }
 
 export interface MatchCondition {
@@ -47,6 +53,19 @@ export interface ServiceRules {
   service: string;
   file?: string;
   rules: RuleWithIndex[];
+  etag?: string; // Sent back as If-Match when changing the service's rules
+  load_error?: string; // Set when the rule file failed to load (the last good rules stay active)
+}
+
+// Rule and workspace change event (sent on the events stream, named by type)
+export interface ChangeEvent {
+  type: 'rules.changed' | 'rules.removed' | 'rules.error' | 'workspace.created' | 'workspace.removed';
+  workspace: string;
+  service?: string;
+  source?: string; // "api", "file" or "rollback:<version>"
+  library?: string;
+  error?: string;
+  timestamp: string;
 }
 
 export interface RuleWithIndex extends Rule {
@@ -48,6 +48,32 @@ export interface PluginUI {
   items: PluginUIItem[];
 }
 
+// ConflictError is thrown when a rule change is rejected with 412 because the
+// service's rules changed since they were fetched (the If-Match ETag is stale)
+export class ConflictError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'ConflictError';
+  }
+}
+
+// Helper to build headers for a rule change, sending If-Match when an ETag is known
+function ruleHeaders(etag?: string, json = false): Record<string, string> {
+  const headers: Record<string, string> = {};
+  if (json) headers['Content-Type'] = 'application/json';
+  if (etag) headers['If-Match'] = etag;
+  return headers;
+}
+
+// Helper to turn a failed rule change into an error, using ConflictError for 412
+async function ruleError(response: Response, fallback: string): Promise<Error> {
+  const error = await response.json().catch(() => ({}));
+  if (response.status === 412) {
+    return new ConflictError(error.error || 'Rules were changed by someone else');
+  }
+  return new Error(error.error || fallback);
+}
+
 class ApiClient {
   // Workspace Management APIs (root level - no workspace in path)
   async getWorkspaces(): Promise<Workspace[]> {
@@ -118,6 +144,22 @@ class ApiClient {
     };
   }
 
+  // Searches the whole traffic history on the server (see the query language in the API docs)
+  async searchTraffic(q: string, cursor?: string, limit = 100): Promise<{ entries: TrafficEntry[]; nextCursor: string }> {
+    const params = new URLSearchParams({ q, limit: limit.toString() });
+    if (cursor) params.append('cursor', cursor);
+
+    const response = await fetch(`${getApiBase()}/traffic/search?${params}`);
+    const data = await response.json();
+    if (!response.ok) {
+      throw new Error(data.error || 'Failed to search traffic');
+    }
+    return {
+      entries: data.entries || [],
+      nextCursor: data.next_cursor || '',
+    };
+  }
+
   async getTrafficById(id: string): Promise<TrafficEntry> {
     const response = await fetch(`${getApiBase()}/traffic/${id}`);
     return response.json();
@@ -134,59 +176,61 @@ class ApiClient {
     return response.json();
   }
 
-  async createRule(service: string, rule: Rule): Promise<void> {
+  async createRule(service: string, rule: Rule, etag?: string): Promise<void> {
     const response = await fetch(`${getApiBase()}/rules/${service}`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: ruleHeaders(etag, true),
       body: JSON.stringify(rule),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to create rule');
+      throw await ruleError(response, 'Failed to create rule');
     }
   }
 
-  async updateRule(service: string, index: number, rule: Rule): Promise<void> {
+  async updateRule(service: string, index: number, rule: Rule, etag?: string): Promise<void> {
     const response = await fetch(`${getApiBase()}/rules/${service}/${index}`, {
       method: 'PUT',
-      headers: { 'Content-Type': 'application/json' },
+      headers: ruleHeaders(etag, true),
       body: JSON.stringify(rule),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to update rule');
+      throw await ruleError(response, 'Failed to update rule');
     }
   }
 
-  async deleteRule(service: string, index: number): Promise<void> {
+  async deleteRule(service: string, index: number, etag?: string): Promise<void> {
     const response = await fetch(`${getApiBase()}/rules/${service}/${index}`, {
       method: 'DELETE',
+      headers: ruleHeaders(etag),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to delete rule');
+      throw await ruleError(response, 'Failed to delete rule');
     }
   }
 
-  async deleteService(service: string): Promise<void> {
+  async deleteService(service: string, etag?: string): Promise<void> {
     const response = await fetch(`${getApiBase()}/rules/${service}`, {
       method: 'DELETE',
+      headers: ruleHeaders(etag),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to delete service');
+      throw await ruleError(response, 'Failed to delete service');
     }
   }
 
-  async moveRule(service: string, index: number, direction: 'up' | 'down'): Promise<void> {
+  async moveRule(service: string, index: number, direction: 'up' | 'down', etag?: string): Promise<void> {
     const response = await fetch(`${getApiBase()}/rules/${service}/${index}/move`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: ruleHeaders(etag, true),
       body: JSON.stringify({ direction }),
     });
 
     if (!response.ok) {
-      throw new Error('Failed to move rule');
+      throw await ruleError(response, 'Failed to move rule');
     }
   }
 
@@ -226,6 +270,10 @@ class ApiClient {
     return `${getApiBase()}/traffic/stream`;
   }
 
+  getEventStreamUrl(): string {
+    return `${getApiBase()}/events`;
+  }
+
   // Plugin APIs
   async getPlugins(): Promise<Plugin[]> {
     const response = await fetch(`${getApiBase()}/plugins`);